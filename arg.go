@@ -19,3 +19,13 @@ type Arg struct {
 func (a *Arg) isRemaining() bool {
 	return a.value.Type().Kind() == reflect.Slice
 }
+
+// usageName returns the name of the argument as shown in the help, with an
+// ellipsis for the trailing slice argument, which takes any number of values.
+func (a *Arg) usageName() string {
+	if a.isRemaining() {
+		return a.Name + "..."
+	}
+
+	return a.Name
+}
@@ -1,6 +1,10 @@
 package flags
 
 import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -51,3 +55,126 @@ func TestPositionalRequired(t *testing.T) {
 
 	assertError(t, err, ErrRequired, "the required argument `Filename` was not provided")
 }
+
+type hostPort struct {
+	Host string
+	Port int
+}
+
+func (h *hostPort) UnmarshalFlag(value string) error {
+	parts := strings.SplitN(value, ":", 2)
+
+	if len(parts) != 2 {
+		return fmt.Errorf("expected host:port but got `%s'", value)
+	}
+
+	port, err := strconv.Atoi(parts[1])
+
+	if err != nil {
+		return err
+	}
+
+	h.Host = parts[0]
+	h.Port = port
+
+	return nil
+}
+
+func TestPositionalUnmarshalerSlice(t *testing.T) {
+	var opts = struct {
+		Positional struct {
+			Name  string
+			Hosts []hostPort
+		} `positional-args:"yes"`
+	}{}
+
+	ret := assertParseSuccess(t, &opts, "test", "localhost:80", "example.com:8080")
+
+	assertStringArray(t, ret, []string{})
+	assertString(t, opts.Positional.Name, "test")
+
+	expected := []hostPort{{"localhost", 80}, {"example.com", 8080}}
+
+	if !reflect.DeepEqual(opts.Positional.Hosts, expected) {
+		t.Errorf("Expected %v but got %v", expected, opts.Positional.Hosts)
+	}
+
+	assertParseFail(t, ErrMarshal, "invalid value `localhost' for positional argument `Hosts' at position 2 (expected flags.hostPort): expected host:port but got `localhost'", &opts, "test", "localhost")
+
+	var ptropts = struct {
+		Positional struct {
+			Hosts []*hostPort
+		} `positional-args:"yes"`
+	}{}
+
+	assertParseSuccess(t, &ptropts, "localhost:80")
+
+	if len(ptropts.Positional.Hosts) != 1 || *ptropts.Positional.Hosts[0] != expected[0] {
+		t.Errorf("Expected [%v] but got %v", expected[0], ptropts.Positional.Hosts)
+	}
+}
+
+func TestPositionalConversionError(t *testing.T) {
+	var opts = struct {
+		Positional struct {
+			File  string
+			Num   int   `name:"num"`
+			Level uint8 `name:"level"`
+			Rest  []int `name:"rest"`
+		} `positional-args:"yes"`
+	}{}
+
+	assertParseFail(t, ErrMarshal, "invalid value `abc' for positional argument `num' at position 2 (expected int): strconv.ParseInt: parsing \"abc\": invalid syntax", &opts, "file", "abc")
+	assertParseFail(t, ErrRange, "invalid value `300' for positional argument `level' at position 3 (expected uint8): strconv.ParseUint: parsing \"300\": value out of range", &opts, "file", "1", "300")
+	assertParseFail(t, ErrMarshal, "invalid value `x' for positional argument `rest' at position 4 (expected int): strconv.ParseInt: parsing \"x\": invalid syntax", &opts, "file", "1", "2", "3", "x")
+
+	// Positional arguments before the failing one are still converted
+	assertString(t, opts.Positional.File, "file")
+
+	if opts.Positional.Num != 1 || opts.Positional.Level != 2 {
+		t.Errorf("Expected num 1 and level 2 but got %d and %d", opts.Positional.Num, opts.Positional.Level)
+	}
+}
+
+func TestDisallowExtraArgs(t *testing.T) {
+	var opts = struct {
+		Value bool `short:"v"`
+
+		Positional struct {
+			Source string
+			Target string
+		} `positional-args:"yes"`
+	}{}
+
+	p := NewParser(&opts, DisallowExtraArgs)
+
+	_, err := p.ParseArgs([]string{"a", "b", "c", "-v", "d"})
+	assertError(t, err, ErrExtraArgs, "unexpected arguments `c' and `d'")
+
+	_, err = p.ParseArgs([]string{"a", "b", "c"})
+	assertError(t, err, ErrExtraArgs, "unexpected argument `c'")
+
+	if _, err := p.ParseArgs([]string{"a", "b"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	p.Options |= PassDoubleDash
+
+	ret, err := p.ParseArgs([]string{"a", "b", "--", "c"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertStringArray(t, ret, []string{"c"})
+
+	p.Options = None
+
+	ret, err = p.ParseArgs([]string{"a", "b", "c"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertStringArray(t, ret, []string{"c"})
+}
@@ -0,0 +1,116 @@
+package flags
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// bitName is a named bit (or set of bits) of an option with the bits tag.
+type bitName struct {
+	name  string
+	value uint64
+}
+
+// parseBits parses the value of a bits tag (e.g. cache=1,compression=2).
+func parseBits(tag string) ([]bitName, bool) {
+	var ret []bitName
+
+	for _, item := range strings.Split(tag, ",") {
+		parts := strings.SplitN(item, "=", 2)
+
+		if len(parts) != 2 {
+			return nil, false
+		}
+
+		value, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 0, 64)
+
+		if err != nil || value == 0 {
+			return nil, false
+		}
+
+		ret = append(ret, bitName{name: strings.TrimSpace(parts[0]), value: value})
+	}
+
+	return ret, true
+}
+
+// formatBits formats the value of an option with the bits tag as the names
+// of its bits separated by commas. Bits which do not have a name are
+// appended as a number.
+func formatBits(value uint64, tag string) string {
+	bits, _ := parseBits(tag)
+
+	var names []string
+
+	for _, bit := range bits {
+		if value&bit.value == bit.value {
+			names = append(names, bit.name)
+			value &^= bit.value
+		}
+	}
+
+	if value != 0 {
+		names = append(names, strconv.FormatUint(value, 10))
+	}
+
+	return strings.Join(names, ",")
+}
+
+// setBits sets the bits named by value (a comma separated list of names) in
+// the option value. Numbers are accepted as well, as long as they only
+// contain named bits.
+func (option *Option) setBits(value string) error {
+	bits, _ := parseBits(option.tag.Get("bits"))
+
+	var defined uint64
+
+	for _, bit := range bits {
+		defined |= bit.value
+	}
+
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+
+		if len(name) == 0 {
+			continue
+		}
+
+		var mask uint64
+
+		for _, bit := range bits {
+			if bit.name == name {
+				mask = bit.value
+				break
+			}
+		}
+
+		if mask == 0 {
+			n, err := strconv.ParseUint(name, 0, 64)
+
+			if err != nil || n&^defined != 0 {
+				return option.checkChoice(name)
+			}
+
+			mask = n
+		}
+
+		switch option.value.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if mask > math.MaxInt64 || option.value.OverflowInt(int64(mask)) {
+				return newErrorf(ErrRange, "value `%s' for flag `%s' is out of range", name, option)
+			}
+
+			option.value.SetInt(option.value.Int() | int64(mask))
+		default:
+			if option.value.OverflowUint(mask) {
+				return newErrorf(ErrRange, "value `%s' for flag `%s' is out of range", name, option)
+			}
+
+			option.value.SetUint(option.value.Uint() | mask)
+		}
+	}
+
+	return nil
+}
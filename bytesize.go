@@ -0,0 +1,129 @@
+package flags
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ByteSize is an option value type representing a size in bytes. Values can
+// be specified as a number, optionally followed by a decimal (KB, MB, GB, TB)
+// or binary (KiB, MiB, GiB, TiB) unit, for example 512, 10MB or 1.5GiB. Units
+// are case insensitive and K, M, G and T are accepted as short forms of the
+// decimal units. A ByteSize is converted back to a string (for example when
+// written to an ini file) using the largest unit representing the size
+// exactly.
+type ByteSize uint64
+
+// Units of byte sizes.
+const (
+	Byte ByteSize = 1
+
+	Kilobyte = 1000 * Byte
+	Megabyte = 1000 * Kilobyte
+	Gigabyte = 1000 * Megabyte
+	Terabyte = 1000 * Gigabyte
+
+	Kibibyte = 1024 * Byte
+	Mebibyte = 1024 * Kibibyte
+	Gibibyte = 1024 * Mebibyte
+	Tebibyte = 1024 * Gibibyte
+)
+
+var byteSizeUnits = []struct {
+	name string
+	size ByteSize
+}{
+	{"TiB", Tebibyte},
+	{"TB", Terabyte},
+	{"GiB", Gibibyte},
+	{"GB", Gigabyte},
+	{"MiB", Mebibyte},
+	{"MB", Megabyte},
+	{"KiB", Kibibyte},
+	{"KB", Kilobyte},
+}
+
+// String returns the size using the largest unit which represents the size
+// exactly.
+func (b ByteSize) String() string {
+	if b != 0 {
+		for _, unit := range byteSizeUnits {
+			if b%unit.size == 0 {
+				return strconv.FormatUint(uint64(b/unit.size), 10) + unit.name
+			}
+		}
+	}
+
+	return strconv.FormatUint(uint64(b), 10) + "B"
+}
+
+// MarshalFlag marshals the size to its string representation.
+func (b ByteSize) MarshalFlag() (string, error) {
+	return b.String(), nil
+}
+
+// UnmarshalFlag parses a size with an optional unit.
+func (b *ByteSize) UnmarshalFlag(value string) error {
+	s := strings.TrimSpace(value)
+	i := 0
+
+	for i < len(s) && (s[i] == '.' || (s[i] >= '0' && s[i] <= '9')) {
+		i++
+	}
+
+	num, unit := s[:i], strings.TrimSpace(s[i:])
+
+	if len(num) == 0 {
+		return fmt.Errorf("invalid byte size `%s'", value)
+	}
+
+	size := Byte
+
+	switch strings.ToLower(unit) {
+	case "", "b":
+	case "k", "kb":
+		size = Kilobyte
+	case "m", "mb":
+		size = Megabyte
+	case "g", "gb":
+		size = Gigabyte
+	case "t", "tb":
+		size = Terabyte
+	case "kib":
+		size = Kibibyte
+	case "mib":
+		size = Mebibyte
+	case "gib":
+		size = Gibibyte
+	case "tib":
+		size = Tebibyte
+	default:
+		return fmt.Errorf("invalid unit `%s' in byte size `%s'", unit, value)
+	}
+
+	// Sizes which do not fit are reported as a range error of strconv,
+	// such that they result in an error of type ErrRange
+	if n, err := strconv.ParseUint(num, 10, 64); err == nil {
+		if n > ^uint64(0)/uint64(size) {
+			return &strconv.NumError{Func: "ParseUint", Num: value, Err: strconv.ErrRange}
+		}
+
+		*b = ByteSize(n) * size
+		return nil
+	}
+
+	f, err := strconv.ParseFloat(num, 64)
+
+	if err != nil {
+		return fmt.Errorf("invalid byte size `%s'", value)
+	}
+
+	// float64(^uint64(0)) rounds up to 2^64, which is out of range
+	if f*float64(size) >= float64(^uint64(0)) {
+		return &strconv.NumError{Func: "ParseFloat", Num: value, Err: strconv.ErrRange}
+	}
+
+	*b = ByteSize(f * float64(size))
+	return nil
+}
@@ -1,5 +1,9 @@
 package flags
 
+import (
+	"context"
+)
+
 // Command represents an application command. Commands can be added to the
 // parser (which itself is a command) and are selected/executed when its name
 // is specified on the command line. The Command type embeds a Group and
@@ -23,9 +27,25 @@ type Command struct {
 	// Whether positional arguments are required
 	ArgsRequired bool
 
+	// Whether an unknown subcommand is passed through, together with all
+	// the arguments following it, as remaining command line arguments
+	// instead of generating an error
+	Passthrough bool
+
+	// Whether the option groups of parent commands are hidden from the
+	// help of this command. The options of these groups can still be
+	// specified on the command line
+	HideInheritedGroups bool
+
+	// Whether the command is hidden from the help, man page, completions
+	// and command suggestions (see also Parser.ShowHidden). The command
+	// can still be invoked
+	Hidden bool
+
 	commands            []*Command
 	hasBuiltinHelpGroup bool
 	args                []*Arg
+	requires            []*Option
 }
 
 // Commander is an interface which can be implemented by any command added in
@@ -39,6 +59,22 @@ type Commander interface {
 	Execute(args []string) error
 }
 
+// CommanderContext is like Commander, for commands which are executed with
+// a context (see Parser.Context).
+type CommanderContext interface {
+	// Execute will be called for the last active (sub)command with the
+	// context of the parser and the remaining command line arguments.
+	Execute(ctx context.Context, args []string) error
+}
+
+// CommanderParser is like Commander, for commands which need access to the
+// parser when executed, e.g. to write the help message.
+type CommanderParser interface {
+	// Execute will be called for the last active (sub)command with the
+	// parser and the remaining command line arguments.
+	Execute(p *Parser, args []string) error
+}
+
 // Usage is an interface which can be implemented to show a custom usage string
 // in the help message shown for a command.
 type Usage interface {
@@ -68,16 +104,18 @@ func (c *Command) AddCommand(command string, shortDescription string, longDescri
 // data needs to be a pointer to a struct from which the fields indicate which
 // options are in the group.
 func (c *Command) AddGroup(shortDescription string, longDescription string, data interface{}) (*Group, error) {
-	group := newGroup(shortDescription, longDescription, data)
-
-	group.parent = c
-
-	if err := group.scanType(c.scanSubcommandHandler(group)); err != nil {
-		return nil, err
-	}
+	return c.addGroup(shortDescription, longDescription, "", data)
+}
 
-	c.groups = append(c.groups, group)
-	return group, nil
+// AddGroupPrefixed adds a new group to the command like AddGroup, prefixing
+// the long names of all the options in the group (and its subgroups) with
+// the given prefix followed by a dash, and their env keys with the prefix
+// followed by an underscore. This allows the same options struct to be added
+// multiple times, e.g. for a source and a destination. Short names are not
+// affected by the prefix. Namespaces of subgroups are composed with the
+// prefix (e.g. prefix-namespace.name).
+func (c *Command) AddGroupPrefixed(shortDescription string, longDescription string, prefix string, data interface{}) (*Group, error) {
+	return c.addGroup(shortDescription, longDescription, prefix, data)
 }
 
 // Commands returns a list of subcommands of this command.
@@ -97,6 +135,44 @@ func (c *Command) Find(name string) *Command {
 	return nil
 }
 
+// Execute calls the Execute method of the data of the command with the given
+// arguments. The data can implement CommanderParser, CommanderContext or
+// Commander, which are checked in this order. An error of type ErrUnknown is
+// returned if the data implements none of them. Note that ParseArgs already
+// executes the active command, unless Parser.DeferExecute is set.
+func (c *Command) Execute(args []string) error {
+	switch cmd := c.data.(type) {
+	case CommanderParser:
+		return cmd.Execute(c.parser(), args)
+	case CommanderContext:
+		return cmd.Execute(c.context(), args)
+	case Commander:
+		return cmd.Execute(args)
+	}
+
+	return newErrorf(ErrUnknown, "command `%s' does not implement Commander", c.Name)
+}
+
+// Require makes the options with the given long names (including
+// namespaces) required when the command is active, e.g. a global --config
+// option which is optional, except for a deploy command. The options can
+// belong to the command itself or to any of its parent commands. An error of
+// type ErrUnknownFlag is returned if no such option exists. Required options
+// cannot be removed (see Group.RemoveOption and Parser.RemoveGroup).
+func (c *Command) Require(longNames ...string) error {
+	for _, name := range longNames {
+		option := c.findLongOption(name)
+
+		if option == nil {
+			return newErrorf(ErrUnknownFlag, "unknown flag `%s'", name)
+		}
+
+		c.requires = append(c.requires, option)
+	}
+
+	return nil
+}
+
 // Args returns a list of positional arguments associated with this command.
 func (c *Command) Args() []*Arg {
 	ret := make([]*Arg, len(c.args))
@@ -1,6 +1,7 @@
 package flags
 
 import (
+	"context"
 	"reflect"
 	"sort"
 	"strings"
@@ -21,6 +22,20 @@ func newCommand(name string, shortDescription string, longDescription string, da
 	}
 }
 
+func (c *Command) addGroup(shortDescription string, longDescription string, prefix string, data interface{}) (*Group, error) {
+	group := newGroup(shortDescription, longDescription, data)
+
+	group.parent = c
+	group.Prefix = prefix
+
+	if err := group.scanType(c.scanSubcommandHandler(group)); err != nil {
+		return nil, err
+	}
+
+	c.groups = append(c.groups, group)
+	return group, nil
+}
+
 func (c *Command) scanSubcommandHandler(parentg *Group) scanHandler {
 	f := func(realval reflect.Value, sfield *reflect.StructField) (bool, error) {
 		mtag := newMultiTag(string(sfield.Tag))
@@ -43,6 +58,10 @@ func (c *Command) scanSubcommandHandler(parentg *Group) scanHandler {
 					return true, err
 				}
 
+				if isIgnoredField(m) {
+					continue
+				}
+
 				name := m.Get("name")
 
 				if len(name) == 0 {
@@ -75,6 +94,9 @@ func (c *Command) scanSubcommandHandler(parentg *Group) scanHandler {
 			shortDescription := mtag.Get("description")
 			longDescription := mtag.Get("long-description")
 			subcommandsOptional := mtag.Get("subcommands-optional")
+			passthrough := mtag.Get("passthrough")
+			hideInheritedGroups := mtag.Get("hide-inherited-groups")
+			hidden := mtag.Get("hidden")
 			aliases := mtag.GetMany("alias")
 
 			subc, err := c.AddCommand(subcommand, shortDescription, longDescription, ptrval.Interface())
@@ -87,6 +109,18 @@ func (c *Command) scanSubcommandHandler(parentg *Group) scanHandler {
 				subc.SubcommandsOptional = true
 			}
 
+			if len(passthrough) > 0 {
+				subc.Passthrough = true
+			}
+
+			if len(hideInheritedGroups) > 0 {
+				subc.HideInheritedGroups = true
+			}
+
+			if len(hidden) > 0 {
+				subc.Hidden = true
+			}
+
 			if len(aliases) > 0 {
 				subc.Aliases = aliases
 			}
@@ -126,6 +160,26 @@ func (c *Command) eachActiveGroup(f func(cc *Command, g *Group)) {
 	}
 }
 
+// setHelpNames sets the short and long name of the built-in help option as
+// configured in the parser.
+func (c *Command) setHelpNames(option *Option) {
+	p := c.parser()
+
+	if p == nil {
+		return
+	}
+
+	if p.HelpShort < 0 {
+		option.ShortName = 0
+	} else if p.HelpShort != 0 {
+		option.ShortName = p.HelpShort
+	}
+
+	if len(p.HelpLong) != 0 {
+		option.LongName = p.HelpLong
+	}
+}
+
 func (c *Command) addHelpGroups(showHelp func() error) {
 	if !c.hasBuiltinHelpGroup {
 		c.addHelpGroup(showHelp)
@@ -146,6 +200,12 @@ func (c *Command) makeLookup() lookup {
 
 	c.eachGroup(func(g *Group) {
 		for _, option := range g.options {
+			// Options which can only be set from the environment cannot
+			// be specified on the command line
+			if option.isEnvOnly() {
+				continue
+			}
+
 			if option.ShortName != 0 {
 				ret.shortNames[string(option.ShortName)] = option
 			}
@@ -176,9 +236,17 @@ func (c *Command) groupByName(name string) *Group {
 		prefix := subc.Name + "."
 
 		if strings.HasPrefix(name, prefix) {
-			if grp := subc.groupByName(name[len(prefix):]); grp != nil {
+			rest := name[len(prefix):]
+
+			if grp := subc.groupByName(rest); grp != nil {
 				return grp
 			}
+
+			// The options of the command itself are written to ini files
+			// in a section named after the command description
+			if strings.ToLower(rest) == strings.ToLower(subc.ShortDescription) {
+				return subc.Group
+			}
 		} else if name == subc.Name {
 			return subc.Group
 		}
@@ -209,6 +277,22 @@ func (c *Command) sortedCommands() []*Command {
 	return []*Command(ret)
 }
 
+// visibleCommands returns the sorted subcommands which are not hidden.
+func (c *Command) visibleCommands() []*Command {
+	p := c.Group.parser()
+	showHidden := p != nil && p.ShowHidden
+
+	ret := make([]*Command, 0, len(c.commands))
+
+	for _, cmd := range c.sortedCommands() {
+		if !cmd.Hidden || showHidden {
+			ret = append(ret, cmd)
+		}
+	}
+
+	return ret
+}
+
 func (c *Command) match(name string) bool {
 	if c.Name == name {
 		return true
@@ -232,7 +316,7 @@ func (c *Command) hasCliOptions() bool {
 		}
 
 		for _, opt := range g.options {
-			if opt.canCli() {
+			if opt.isVisible() {
 				ret = true
 			}
 		}
@@ -241,10 +325,129 @@ func (c *Command) hasCliOptions() bool {
 	return ret
 }
 
+func (c *Command) suggestCommands(name string) []string {
+	type suggestion struct {
+		name string
+		dist int
+	}
+
+	var suggestions []suggestion
+
+	for _, cmd := range c.visibleCommands() {
+		l := levenshtein(name, cmd.Name)
+
+		if float32(l)/float32(len(cmd.Name)) < 0.5 {
+			suggestions = append(suggestions, suggestion{cmd.Name, l})
+		}
+	}
+
+	// Insertion sort keeps commands with an equal distance sorted by name
+	for i := 1; i < len(suggestions); i++ {
+		for j := i; j > 0 && suggestions[j].dist < suggestions[j-1].dist; j-- {
+			suggestions[j], suggestions[j-1] = suggestions[j-1], suggestions[j]
+		}
+	}
+
+	ret := make([]string, len(suggestions))
+
+	for i, s := range suggestions {
+		ret[i] = s.name
+	}
+
+	return ret
+}
+
+// checkRequiredBy returns an error of type ErrRequired if any of the
+// options is required by the command or one of its subcommands (see
+// Command.Require).
+func (c *Command) checkRequiredBy(options []*Option) error {
+	var err error
+
+	c.eachCommand(func(cc *Command) {
+		if err != nil {
+			return
+		}
+
+		for _, required := range cc.requires {
+			for _, option := range options {
+				if required == option {
+					err = newErrorf(ErrRequired, "option `%s' is required by the `%s' command", option, cc.Name)
+					return
+				}
+			}
+		}
+	}, true)
+
+	return err
+}
+
+// isExecutable returns whether the data of the command implements one of
+// the Commander interfaces (see Command.Execute).
+func (c *Command) isExecutable() bool {
+	switch c.data.(type) {
+	case CommanderParser, CommanderContext, Commander:
+		return true
+	}
+
+	return false
+}
+
+// context returns the context with which the command is executed.
+func (c *Command) context() context.Context {
+	if p := c.parser(); p != nil && p.Context != nil {
+		return p.Context
+	}
+
+	return context.Background()
+}
+
+func (c *Command) parentCommand() *Command {
+	if parent, ok := c.parent.(*Command); ok {
+		return parent
+	}
+
+	return nil
+}
+
+// findLongOption finds the option with the given long name (including
+// namespaces) in the command or any of its parent commands.
+func (c *Command) findLongOption(name string) *Option {
+	var ret *Option
+
+	for ; c != nil && ret == nil; c = c.parentCommand() {
+		c.eachGroup(func(g *Group) {
+			for _, option := range g.options {
+				if ret == nil && option.LongNameWithNamespace() == name {
+					ret = option
+				}
+			}
+		})
+	}
+
+	return ret
+}
+
+func (c *Command) activeCommand() *Command {
+	for c.Active != nil {
+		c = c.Active
+	}
+
+	return c
+}
+
+// hidesInheritedGroup returns whether the group grp of the (parent) command
+// owner is hidden from the help of c.
+func (c *Command) hidesInheritedGroup(owner *Command, grp *Group) bool {
+	return c.HideInheritedGroups && owner != c && !grp.isBuiltinHelp
+}
+
 func (c *Command) fillParseState(s *parseState) {
 	s.positional = make([]*Arg, len(c.args))
 	copy(s.positional, c.args)
 
 	s.lookup = c.makeLookup()
 	s.command = c
+
+	// Reset the active subcommand of a previous parse
+	c.Active = nil
 }
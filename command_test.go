@@ -1,7 +1,9 @@
 package flags
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -152,6 +154,139 @@ func TestCommandExecute(t *testing.T) {
 	assertStringArray(t, opts.Command.EArgs, []string{"a", "b"})
 }
 
+func TestCommandDeferExecute(t *testing.T) {
+	var opts = struct {
+		Value bool `short:"v"`
+
+		Command testCommand `command:"cmd"`
+	}{}
+
+	p := NewParser(&opts, Default)
+	p.DeferExecute = true
+
+	ret, err := p.ParseArgs([]string{"cmd", "-g", "a", "b"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if opts.Command.Executed {
+		t.Errorf("Expected command not to be executed while parsing")
+	}
+
+	if err := p.RunActiveCommand(ret); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !opts.Command.Executed {
+		t.Errorf("Did not execute command")
+	}
+
+	assertStringArray(t, opts.Command.EArgs, []string{"a", "b"})
+
+	p.Name = "app"
+	assertError(t, p.Command.Execute(nil), ErrUnknown, "command `app' does not implement Commander")
+}
+
+type testParserCommand struct {
+	parser *Parser
+	args   []string
+}
+
+func (c *testParserCommand) Execute(p *Parser, args []string) error {
+	c.parser = p
+	c.args = args
+
+	return nil
+}
+
+type testContextKey struct{}
+
+type testContextCommand struct {
+	value interface{}
+	args  []string
+}
+
+func (c *testContextCommand) Execute(ctx context.Context, args []string) error {
+	c.value = ctx.Value(testContextKey{})
+	c.args = args
+
+	return nil
+}
+
+func TestCommandExecuteInterfaces(t *testing.T) {
+	var opts = struct {
+		Value bool `short:"v"`
+
+		Remote struct {
+			Add testParserCommand `command:"add"`
+		} `command:"remote"`
+
+		Fetch testContextCommand `command:"fetch"`
+	}{}
+
+	p := NewParser(&opts, Default)
+
+	_, err := p.ParseArgs([]string{"remote", "add", "a", "b"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if opts.Remote.Add.parser != p {
+		t.Errorf("Expected command to be executed with the parser")
+	}
+
+	assertStringArray(t, opts.Remote.Add.args, []string{"a", "b"})
+
+	_, err = p.ParseArgs([]string{"fetch", "c"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if ctx := context.Background(); opts.Fetch.value != ctx.Value(testContextKey{}) {
+		t.Errorf("Expected command to be executed with the background context")
+	}
+
+	assertStringArray(t, opts.Fetch.args, []string{"c"})
+
+	p.Context = context.WithValue(context.Background(), testContextKey{}, "value")
+
+	_, err = p.ParseArgs([]string{"fetch"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if opts.Fetch.value != "value" {
+		t.Errorf("Expected command to be executed with the context of the parser, but got %v", opts.Fetch.value)
+	}
+
+	p.DeferExecute = true
+	opts.Remote.Add.parser = nil
+
+	_, err = p.ParseArgs([]string{"remote", "add"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if opts.Remote.Add.parser != nil {
+		t.Errorf("Did not expect command to be executed")
+	}
+
+	if err := p.RunActiveCommand([]string{"d"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if opts.Remote.Add.parser != p {
+		t.Errorf("Expected command to be executed with the parser")
+	}
+
+	assertStringArray(t, opts.Remote.Add.args, []string{"d"})
+}
+
 func TestCommandClosest(t *testing.T) {
 	var opts = struct {
 		Value bool `short:"v"`
@@ -215,6 +350,60 @@ func TestCommandAdd(t *testing.T) {
 	}
 }
 
+func TestCommandAddNested(t *testing.T) {
+	var opts = struct {
+		Value bool `short:"v"`
+	}{}
+
+	var remote struct{}
+	var add testCommand
+
+	p := NewNamedParser("TestCommandAddNested", HelpFlag)
+	p.AddGroup("Application Options", "", &opts)
+
+	c, err := p.AddCommand("remote", "Manage remotes", "", &remote)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	cc, err := c.AddCommand("add", "Add a remote", "", &add)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ret, err := p.ParseArgs([]string{"-v", "remote", "add", "-g", "origin"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertStringArray(t, ret, []string{"origin"})
+
+	if !add.Executed || !add.G {
+		t.Errorf("Expected nested command to be executed with -g")
+	}
+
+	assertStringArray(t, add.EArgs, []string{"origin"})
+
+	if p.Active != c || c.Active != cc || c.Find("add") != cc {
+		t.Errorf("Expected nested command to be active")
+	}
+
+	_, err = p.ParseArgs([]string{"remote", "--help"})
+
+	if e, ok := err.(*Error); !ok || e.Type != ErrHelp {
+		t.Fatalf("Expected ErrHelp but got %v", err)
+	}
+
+	for _, s := range []string{"TestCommandAddNested [OPTIONS] remote <add>", "Available commands:\n  add  Add a remote"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("Expected help to contain %q but got:\n\n%s", s, err)
+		}
+	}
+}
+
 func TestCommandNestedInline(t *testing.T) {
 	var opts = struct {
 		Value bool `short:"v"`
@@ -282,6 +471,51 @@ func TestRequiredAllOnCommand(t *testing.T) {
 	assertParseFail(t, ErrRequired, fmt.Sprintf("the required flags `%smissing' and `%cv' were not specified", defaultLongOptDelimiter, defaultShortOptDelimiter), &opts, "cmd")
 }
 
+func TestCommandRequire(t *testing.T) {
+	var opts = struct {
+		Config string `long:"config"`
+
+		Deploy struct {
+			Target string `long:"target"`
+		} `command:"deploy"`
+
+		Status struct{} `command:"status"`
+	}{}
+
+	p := NewParser(&opts, None)
+
+	deploy := p.Find("deploy")
+
+	if err := deploy.Require("config", "target"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertError(t, deploy.Require("missing"), ErrUnknownFlag, "unknown flag `missing'")
+
+	if _, err := p.ParseArgs([]string{"status"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, err := p.ParseArgs([]string{"deploy", "--target", "prod"})
+	assertError(t, err, ErrRequired, fmt.Sprintf("the flag `%sconfig' is required for the `deploy' command", defaultLongOptDelimiter))
+
+	_, err = p.ParseArgs([]string{"deploy"})
+	assertError(t, err, ErrRequired, fmt.Sprintf("the flags `%sconfig' and `%starget' are required for the `deploy' command", defaultLongOptDelimiter, defaultLongOptDelimiter))
+
+	if _, err := p.ParseArgs([]string{"--config", "c.ini", "deploy", "--target", "prod"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Required options cannot be removed
+	config := p.Groups()[0].Options()[0]
+
+	err = p.Groups()[0].RemoveOption(config)
+	assertError(t, err, ErrRequired, fmt.Sprintf("option `%sconfig' is required by the `deploy' command", defaultLongOptDelimiter))
+
+	_, err = p.ParseArgs([]string{"deploy", "--target", "prod"})
+	assertError(t, err, ErrRequired, fmt.Sprintf("the flag `%sconfig' is required for the `deploy' command", defaultLongOptDelimiter))
+}
+
 func TestDefaultOnCommand(t *testing.T) {
 	var opts = struct {
 		Command struct {
@@ -335,3 +569,323 @@ func TestCommandAlias(t *testing.T) {
 		t.Errorf("Expected G to be true")
 	}
 }
+
+type testPassthroughCommand struct {
+	G        bool `short:"g"`
+	Executed bool
+	EArgs    []string
+
+	List struct {
+	} `command:"list"`
+}
+
+func (c *testPassthroughCommand) Execute(args []string) error {
+	c.Executed = true
+	c.EArgs = args
+
+	return nil
+}
+
+func TestCommandPassthrough(t *testing.T) {
+	var opts = struct {
+		Value bool `short:"v"`
+
+		Plugin testPassthroughCommand `command:"plugin" passthrough:"yes"`
+	}{}
+
+	assertParseSuccess(t, &opts, "-v", "plugin", "-g", "foo", "--bar", "-v", "baz")
+
+	if !opts.Plugin.Executed {
+		t.Errorf("Did not execute command")
+	}
+
+	if !opts.Plugin.G {
+		t.Errorf("Expected Plugin.G to be true")
+	}
+
+	assertStringArray(t, opts.Plugin.EArgs, []string{"foo", "--bar", "-v", "baz"})
+}
+
+func TestCommandPassthroughKnown(t *testing.T) {
+	var opts = struct {
+		Plugin testPassthroughCommand `command:"plugin" passthrough:"yes"`
+	}{}
+
+	p, ret := assertParserSuccess(t, &opts, "plugin", "list", "a")
+
+	if opts.Plugin.Executed {
+		t.Errorf("Did not expect passthrough command to be executed")
+	}
+
+	if p.Active == nil || p.Active.Active == nil || p.Active.Active.Name != "list" {
+		t.Errorf("Expected list command to be active")
+	}
+
+	assertStringArray(t, ret, []string{"a"})
+}
+
+func TestCommandPassthroughMissing(t *testing.T) {
+	var opts = struct {
+		Plugin testPassthroughCommand `command:"plugin" passthrough:"yes"`
+	}{}
+
+	assertParseFail(t, ErrCommandRequired, "Please specify the list command", &opts, "plugin")
+}
+
+func TestUnknownCommandHandler(t *testing.T) {
+	var opts = struct {
+		Value bool `short:"v"`
+
+		Cmd1 struct {
+		} `command:"remove"`
+
+		Cmd2 struct {
+		} `command:"add"`
+
+		Cmd3 struct {
+		} `command:"adapt"`
+	}{}
+
+	p := NewParser(&opts, None)
+
+	var name string
+	var args []string
+	var suggestions []string
+
+	p.UnknownCommandHandler = func(n string, a []string) error {
+		name, args = n, a
+		suggestions = p.SuggestCommands(n)
+
+		return nil
+	}
+
+	ret, err := p.ParseArgs([]string{"-v", "adf", "x", "y"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertString(t, name, "adf")
+	assertStringArray(t, args, []string{"x", "y"})
+	assertStringArray(t, ret, []string{"adf", "x", "y"})
+	assertStringArray(t, suggestions, []string{"add", "adapt"})
+
+	p.UnknownCommandHandler = func(n string, a []string) error {
+		return newErrorf(ErrUnknownCommand, "no such command `%s'", n)
+	}
+
+	_, err = p.ParseArgs([]string{"-v", "adf"})
+	assertError(t, err, ErrUnknownCommand, "no such command `adf'")
+
+	_, err = p.ParseArgs([]string{"-v"})
+	assertError(t, err, ErrCommandRequired, "Please specify one command of: adapt, add or remove")
+}
+
+func TestDoubleDashPerCommand(t *testing.T) {
+	var opts = struct {
+		Verbose bool `short:"v"`
+
+		Exec struct {
+			Interactive bool `short:"i"`
+
+			Args struct {
+				Pod     string
+				Command []string
+			} `positional-args:"yes"`
+		} `command:"exec"`
+
+		Remote struct {
+			Force bool `short:"f"`
+
+			Add struct {
+				Name bool `short:"n"`
+
+				Args struct {
+					Rest []string
+				} `positional-args:"yes"`
+			} `command:"add"`
+		} `command:"remote"`
+	}{}
+
+	p := NewParser(&opts, DoubleDashPerCommand|PassDoubleDash)
+	ret, err := p.ParseArgs([]string{"-v", "exec", "-i", "pod", "--", "ls", "-la", "--", "-i"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	assertStringArray(t, ret, []string{})
+	assertString(t, p.Active.Name, "exec")
+	assertString(t, opts.Exec.Args.Pod, "pod")
+	assertStringArray(t, opts.Exec.Args.Command, []string{"ls", "-la", "--", "-i"})
+
+	if !opts.Verbose || !opts.Exec.Interactive {
+		t.Errorf("Expected Verbose and Interactive to be true")
+	}
+
+	// Options of a subcommand are parsed again after the double dash of
+	// its parent, and the subcommand can have a double dash of its own
+	p = NewParser(&opts, DoubleDashPerCommand)
+	ret, err = p.ParseArgs([]string{"remote", "--", "add", "-n", "--", "-f", "x"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	assertStringArray(t, ret, []string{})
+	assertString(t, p.Active.Active.Name, "add")
+
+	if !opts.Remote.Add.Name {
+		t.Errorf("Expected Name to be true")
+	}
+
+	if opts.Remote.Force {
+		t.Errorf("Expected Force to be false")
+	}
+
+	assertStringArray(t, opts.Remote.Add.Args.Rest, []string{"-f", "x"})
+
+	// With PassDoubleDash only, the double dash ends option parsing for
+	// all commands
+	p = NewParser(&opts, PassDoubleDash)
+	_, err = p.ParseArgs([]string{"remote", "--", "add"})
+
+	if e, ok := err.(*Error); !ok || e.Type != ErrUnknownCommand {
+		t.Errorf("Expected unknown command error but got %v", err)
+	}
+}
+
+type SharedCommandOptions struct {
+	Verbose bool `short:"v" long:"verbose"`
+
+	Output struct {
+		Format string `long:"format" default:"text"`
+	} `group:"Output Options" namespace:"output"`
+}
+
+type commonCommandOptions struct {
+	Force bool `short:"f" long:"force"`
+
+	Retry struct {
+		Count int `long:"count"`
+	} `group:"Retry Options" namespace:"retry"`
+}
+
+func TestCommandEmbeddedOptions(t *testing.T) {
+	var opts = struct {
+		Add struct {
+			SharedCommandOptions
+			commonCommandOptions
+
+			Name string `long:"name"`
+		} `command:"add"`
+
+		Remove struct {
+			*SharedCommandOptions
+			commonCommandOptions
+		} `command:"rm"`
+	}{}
+
+	p, ret := assertParserSuccess(t, &opts, "add", "-v", "--output.format", "json", "-f", "--retry.count", "3", "--name", "x", "rest")
+
+	assertStringArray(t, ret, []string{"rest"})
+	assertString(t, p.Active.Name, "add")
+
+	if !opts.Add.Verbose || !opts.Add.Force {
+		t.Errorf("Expected Verbose and Force to be true")
+	}
+
+	assertString(t, opts.Add.Output.Format, "json")
+	assertString(t, opts.Add.Name, "x")
+
+	if opts.Add.Retry.Count != 3 {
+		t.Errorf("Expected Retry.Count to be 3 but got %d", opts.Add.Retry.Count)
+	}
+
+	for _, name := range []string{"Output Options", "Retry Options"} {
+		if p.Active.Group.Find(name) == nil {
+			t.Errorf("Expected group %s of the add command", name)
+		}
+	}
+
+	_, ret = assertParserSuccess(t, &opts, "rm", "--verbose", "--force", "--retry.count=2")
+
+	assertStringArray(t, ret, []string{})
+
+	if !opts.Remove.Verbose || !opts.Remove.Force || opts.Remove.Retry.Count != 2 {
+		t.Errorf("Unexpected values %+v", opts.Remove)
+	}
+
+	assertString(t, opts.Remove.Output.Format, "text")
+
+	if opts.Add.Retry.Count != 3 {
+		t.Errorf("Expected options of the add command to be unaffected")
+	}
+}
+
+func TestParseUntilCommand(t *testing.T) {
+	var opts = struct {
+		Verbose bool `short:"v" long:"verbose"`
+
+		Remote struct {
+			Name bool `short:"n"`
+
+			Add struct {
+				Force bool `short:"f"`
+			} `command:"add"`
+		} `command:"remote"`
+	}{}
+
+	p := NewParser(&opts, None)
+
+	ret, name, args, err := p.ParseUntilCommand([]string{"-v", "plugin", "--flag", "-v", "x"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	assertStringArray(t, ret, []string{})
+	assertString(t, name, "plugin")
+	assertStringArray(t, args, []string{"--flag", "-v", "x"})
+
+	if !opts.Verbose {
+		t.Errorf("Expected Verbose to be true")
+	}
+
+	// Known commands are selected, parsing stops at an unknown subcommand
+	ret, name, args, err = p.ParseUntilCommand([]string{"remote", "-n", "prune", "-f"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	assertStringArray(t, ret, []string{})
+	assertString(t, name, "prune")
+	assertStringArray(t, args, []string{"-f"})
+	assertString(t, p.Active.Name, "remote")
+
+	if !opts.Remote.Name {
+		t.Errorf("Expected Name to be true")
+	}
+
+	ret, name, args, err = p.ParseUntilCommand([]string{"remote", "add", "-f", "origin"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	assertStringArray(t, ret, []string{"origin"})
+	assertString(t, name, "")
+	assertStringArray(t, args, nil)
+
+	if !opts.Remote.Add.Force {
+		t.Errorf("Expected Force to be true")
+	}
+
+	_, _, _, err = p.ParseUntilCommand([]string{"--unknown", "plugin"})
+	assertError(t, err, ErrUnknownFlag, "unknown flag `unknown'")
+
+	// ParseArgs is not affected
+	_, err = p.ParseArgs([]string{"plugin"})
+	assertError(t, err, ErrUnknownCommand, "Unknown command `plugin'. You should use the remote command")
+}
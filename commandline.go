@@ -0,0 +1,126 @@
+package flags
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// CommandLine returns a command line, quoted for POSIX shells, which
+// reproduces the effective values of the options of the last parse, e.g.
+// app --level=3 deploy --target='my host'. It consists of the name of the
+// parser, followed by the options of the parser and the names and options of
+// the active commands. Only options which did not get their default value
+// (i.e. which were specified on the command line, in the environment or in
+// an ini file) are included, using their long name if they have one. The
+// values of slice and map options are written as repeated options, and bool
+// options are only written when true. Positional arguments, function options
+// and options with the secret tag are not included.
+func (p *Parser) CommandLine() string {
+	words := []string{p.Name}
+
+	for c := p.Command; c != nil; c = c.Active {
+		if c != p.Command {
+			words = append(words, c.Name)
+		}
+
+		c.eachGroup(func(g *Group) {
+			for _, option := range g.options {
+				words = append(words, option.commandLineArgs()...)
+			}
+		})
+	}
+
+	for i, word := range words {
+		words[i] = shellWord(word)
+	}
+
+	return strings.Join(words, " ")
+}
+
+// commandLineArgs returns the command line arguments which set the option
+// to its current value (see Parser.CommandLine).
+func (option *Option) commandLineArgs() []string {
+	if !option.isSpecified() && option.source != SourceIni {
+		return nil
+	}
+
+	if option.isFunc() || len(option.tag.Get("secret")) != 0 {
+		return nil
+	}
+
+	var name string
+
+	if len(option.LongName) != 0 {
+		name = defaultLongOptDelimiter + option.LongNameWithNamespace()
+	} else if option.ShortName != 0 {
+		name = string(defaultShortOptDelimiter) + string(option.ShortName)
+	} else {
+		return nil
+	}
+
+	val := reflect.Indirect(option.value)
+
+	if !val.IsValid() {
+		return nil
+	}
+
+	var ret []string
+
+	if option.isBool() {
+		if val.Kind() == reflect.Slice {
+			for i := 0; i < val.Len(); i++ {
+				if val.Index(i).Bool() {
+					ret = append(ret, name)
+				}
+			}
+		} else if val.Bool() {
+			ret = append(ret, name)
+		}
+
+		return ret
+	}
+
+	var values []string
+
+	switch val.Kind() {
+	case reflect.Slice:
+		for i := 0; i < val.Len(); i++ {
+			v, _ := convertToString(val.Index(i), option.tag)
+			values = append(values, v)
+		}
+	case reflect.Map:
+		for _, k := range val.MapKeys() {
+			ks, _ := convertToString(k, option.tag)
+			vs, _ := convertToString(val.MapIndex(k), option.tag)
+
+			values = append(values, ks+keyValueDelimiter(option.tag)+vs)
+		}
+
+		sort.Strings(values)
+	default:
+		v, _ := convertToString(val, option.tag)
+		values = append(values, v)
+	}
+
+	for _, v := range values {
+		ret = append(ret, name+string(defaultNameArgDelimiter)+v)
+	}
+
+	return ret
+}
+
+// shellWord quotes a word for POSIX shells, if necessary.
+func shellWord(word string) string {
+	if len(word) == 0 {
+		return "''"
+	}
+
+	for _, r := range word {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("_@%+=:,./-", r)) {
+			return shellQuote(word)
+		}
+	}
+
+	return word
+}
@@ -0,0 +1,54 @@
+package flags
+
+import (
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestCommandLine(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("option delimiters differ on windows")
+	}
+
+	oldEnv := NewEnvSnapshot()
+	defer oldEnv.Restore()
+
+	var opts struct {
+		Verbose  []bool            `short:"v" long:"verbose"`
+		Quiet    bool              `long:"quiet"`
+		Level    int               `long:"level" default:"1" env:"TEST_LEVEL"`
+		Name     string            `short:"n"`
+		Tags     []string          `long:"tag"`
+		Labels   map[string]string `long:"label"`
+		Password string            `long:"password" secret:"yes"`
+		Format   string            `long:"format" default:"text"`
+
+		Deploy struct {
+			Target string `long:"target"`
+			Force  bool   `long:"force"`
+		} `command:"deploy"`
+	}
+
+	os.Setenv("TEST_LEVEL", "3")
+
+	p := NewNamedParser("app", None)
+	p.AddGroup("Application Options", "", &opts)
+
+	_, err := p.ParseArgs([]string{"-vv", "-n", "it's", "--tag", "a b", "--tag", "c", "--label", "y:2", "--label", "x:1",
+		"--password", "secret", "deploy", "--target", "my host", "--force"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := "app --verbose --verbose --level=3 '-n=it'\\''s' '--tag=a b' --tag=c --label=x:1 --label=y:2 deploy '--target=my host' --force"
+
+	assertString(t, p.CommandLine(), expected)
+
+	if _, err := p.ParseArgs([]string{"deploy", "--target="}); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	assertString(t, p.CommandLine(), "app --level=3 deploy --target=")
+}
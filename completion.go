@@ -2,6 +2,8 @@ package flags
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"path/filepath"
 	"reflect"
 	"sort"
@@ -45,6 +47,9 @@ type completion struct {
 	parser *Parser
 
 	ShowDescriptions bool `short:"d" long:"show-descriptions" description:"Show descriptions next to completion items"`
+	TabSeparated     bool `short:"t" long:"tab-separated" description:"Show each completion item and its description separated by a tab"`
+	Cursor           int  `long:"cursor" default:"-1" description:"The index of the argument to complete (defaults to the last argument)"`
+	ValueSuffix      bool `long:"value-suffix" description:"Append the name/argument delimiter to completed long options which require a value"`
 }
 
 // Filename is a string alias which provides filename completion.
@@ -67,6 +72,22 @@ func (f *Filename) Complete(match string) []Completion {
 	return completionsWithoutDescriptions(ret)
 }
 
+// Complete returns the completions, sorted by item, of the argument current
+// following the given (complete) command line arguments, as they would be
+// offered by the shell completion of the application (see the Completion
+// section of the package documentation). This does not require the
+// GO_FLAGS_COMPLETION environment variable to be set, which makes it
+// possible to test custom completers or to offer completions in other user
+// interfaces. The values of the options are not modified.
+func (p *Parser) Complete(args []string, current string) []Completion {
+	c := &completion{parser: p}
+
+	all := make([]string, 0, len(args)+1)
+	all = append(all, args...)
+
+	return c.complete(append(all, current))
+}
+
 func (c *completion) skipPositional(s *parseState, n int) {
 	if n >= len(s.positional) {
 		s.positional = nil
@@ -79,10 +100,10 @@ func (c *completion) completeOptionNames(names map[string]*Option, prefix string
 	n := make([]Completion, 0, len(names))
 
 	for k, opt := range names {
-		if strings.HasPrefix(k, match) {
+		if strings.HasPrefix(k, match) && opt.isVisible() {
 			n = append(n, Completion{
 				Item:        prefix + k,
-				Description: opt.Description,
+				Description: opt.description(),
 			})
 		}
 	}
@@ -91,7 +112,17 @@ func (c *completion) completeOptionNames(names map[string]*Option, prefix string
 }
 
 func (c *completion) completeLongNames(s *parseState, prefix string, match string) []Completion {
-	return c.completeOptionNames(s.lookup.longNames, prefix, match)
+	ret := c.completeOptionNames(s.lookup.longNames, prefix, match)
+
+	if c.ValueSuffix {
+		for i, v := range ret {
+			if opt := s.lookup.longNames[strings.TrimPrefix(v.Item, prefix)]; opt.canArgument() && !opt.OptionalArgument {
+				ret[i].Item += string(defaultNameArgDelimiter)
+			}
+		}
+	}
+
+	return ret
 }
 
 func (c *completion) completeShortNames(s *parseState, prefix string, match string) []Completion {
@@ -109,7 +140,7 @@ func (c *completion) completeShortNames(s *parseState, prefix string, match stri
 func (c *completion) completeCommands(s *parseState, match string) []Completion {
 	n := make([]Completion, 0, len(s.command.commands))
 
-	for _, cmd := range s.command.commands {
+	for _, cmd := range s.command.visibleCommands() {
 		if cmd.data != c && strings.HasPrefix(cmd.Name, match) {
 			n = append(n, Completion{
 				Item:        cmd.Name,
@@ -157,15 +188,15 @@ func (c *completion) complete(args []string) []Completion {
 	for len(s.args) > 1 {
 		arg := s.pop()
 
-		if (c.parser.Options&PassDoubleDash) != None && arg == "--" {
+		if (c.parser.Options&PassDoubleDash) != None && arg == c.parser.argsSeparator() {
 			opt = nil
 			c.skipPositional(s, len(s.args)-1)
 
 			break
 		}
 
-		if argumentIsOption(arg) {
-			prefix, optname, islong := stripOptionPrefix(arg)
+		if c.parser.argumentIsOption(arg) {
+			prefix, optname, islong := c.parser.stripOptionPrefix(arg)
 			optname, _, argument := splitOption(prefix, optname, islong)
 
 			if argument == nil {
@@ -220,9 +251,9 @@ func (c *completion) complete(args []string) []Completion {
 	if opt != nil {
 		// Completion for the argument of 'opt'
 		ret = c.completeValue(opt.value, "", lastarg)
-	} else if argumentIsOption(lastarg) {
+	} else if c.parser.argumentIsOption(lastarg) {
 		// Complete the option
-		prefix, optname, islong := stripOptionPrefix(lastarg)
+		prefix, optname, islong := c.parser.stripOptionPrefix(lastarg)
 		optname, split, argument := splitOption(prefix, optname, islong)
 
 		if argument == nil && !islong {
@@ -261,10 +292,29 @@ func (c *completion) complete(args []string) []Completion {
 	return ret
 }
 
+func (c *completion) completeCursor(args []string) []Completion {
+	if c.Cursor >= 0 {
+		if c.Cursor < len(args) {
+			args = args[:c.Cursor+1]
+		} else {
+			args = append(args, "")
+		}
+	}
+
+	return c.complete(args)
+}
+
 func (c *completion) Execute(args []string) error {
-	ret := c.complete(args)
+	c.print(os.Stdout, c.completeCursor(args))
+	return nil
+}
 
-	if c.ShowDescriptions && len(ret) > 1 {
+func (c *completion) print(wr io.Writer, ret []Completion) {
+	if c.TabSeparated {
+		for _, v := range ret {
+			fmt.Fprintf(wr, "%s\t%s\n", v.Item, v.Description)
+		}
+	} else if c.ShowDescriptions && len(ret) > 1 {
 		maxl := 0
 
 		for _, v := range ret {
@@ -274,19 +324,68 @@ func (c *completion) Execute(args []string) error {
 		}
 
 		for _, v := range ret {
-			fmt.Printf("%s", v.Item)
+			fmt.Fprintf(wr, "%s", v.Item)
 
 			if len(v.Description) > 0 {
-				fmt.Printf("%s  # %s", strings.Repeat(" ", maxl-len(v.Item)), v.Description)
+				fmt.Fprintf(wr, "%s  # %s", strings.Repeat(" ", maxl-len(v.Item)), v.Description)
 			}
 
-			fmt.Printf("\n")
+			fmt.Fprintf(wr, "\n")
 		}
 	} else {
 		for _, v := range ret {
-			fmt.Println(v.Item)
+			fmt.Fprintln(wr, v.Item)
 		}
 	}
+}
 
-	return nil
+const bashCompletionScript = `_%[1]s_completion() {
+    local IFS=$'\n'
+    local items
+
+    items=($(GO_FLAGS_COMPLETION=1 "${COMP_WORDS[0]}" __complete --value-suffix --tab-separated -- "${COMP_WORDS[@]:1:$COMP_CWORD}"))
+    COMPREPLY=()
+
+    local item
+
+    for item in "${items[@]}"; do
+        if [[ %[3]s -eq 1 && ${#items[@]} -gt 1 && $item == *$'\t'?* ]]; then
+            COMPREPLY+=("${item%%%%$'\t'*}  (${item#*$'\t'})")
+        else
+            COMPREPLY+=("${item%%%%$'\t'*}")
+        fi
+    done
+
+    # Do not add a space after options which require a value
+    if [[ ${#COMPREPLY[@]} -eq 1 && ${COMPREPLY[0]} == *%[4]s ]]; then
+        compopt -o nospace
+    fi
+}
+
+complete -F _%[1]s_completion %[2]s
+`
+
+// WriteBashCompletion writes a bash (4 or later) completion script for the
+// application to the provided writer. The script completes using the builtin
+// completion of the application (see the Completion section of the package
+// documentation). When withDescriptions is true, the descriptions of options
+// and commands are shown next to the candidates when there is more than one
+// candidate. No space is added after a completed long option which requires a
+// value.
+func (p *Parser) WriteBashCompletion(writer io.Writer, withDescriptions bool) {
+	fname := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+
+		return '_'
+	}, p.Name)
+
+	descriptions := "0"
+
+	if withDescriptions {
+		descriptions = "1"
+	}
+
+	fmt.Fprintf(writer, bashCompletionScript, fname, p.Name, descriptions, string(defaultNameArgDelimiter))
 }
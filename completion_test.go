@@ -1,6 +1,8 @@
 package flags
 
 import (
+	"bytes"
+	"os"
 	"path"
 	"path/filepath"
 	"reflect"
@@ -164,3 +166,159 @@ func TestCompletion(t *testing.T) {
 		}
 	}
 }
+
+func TestParserComplete(t *testing.T) {
+	p := NewParser(&completionTestOptions, None)
+
+	args := []string{"rename"}
+	ret := p.Complete(args, "--comp")
+
+	if !reflect.DeepEqual(ret, []Completion{{Item: "--completed"}}) {
+		t.Errorf("Unexpected completions %v", ret)
+	}
+
+	ret = p.Complete(args, "--completed=hello u")
+
+	if !reflect.DeepEqual(ret, []Completion{{Item: "--completed=hello universe"}}) {
+		t.Errorf("Unexpected completions %v", ret)
+	}
+
+	ret = p.Complete([]string{"rename", "-c"}, "hello")
+
+	if !reflect.DeepEqual(ret, []Completion{{Item: "hello multiverse"}, {Item: "hello universe"}, {Item: "hello world"}}) {
+		t.Errorf("Unexpected completions %v", ret)
+	}
+
+	ret = p.Complete(nil, "r")
+
+	if !reflect.DeepEqual(ret, []Completion{{Item: "rename"}, {Item: "rm"}}) {
+		t.Errorf("Unexpected completions %v", ret)
+	}
+
+	assertStringArray(t, args, []string{"rename"})
+}
+
+func TestCompletionHidden(t *testing.T) {
+	var opts helpHiddenOptions
+
+	p := NewParser(&opts, None)
+	c := &completion{parser: p}
+
+	completed := func() []string {
+		ret := c.complete([]string{"--"})
+		items := make([]string, len(ret))
+
+		for i, v := range ret {
+			items[i] = v.Item
+		}
+
+		return items
+	}
+
+	assertStringArray(t, completed(), []string{"--verbose"})
+
+	p.ShowHidden = true
+	assertStringArray(t, completed(), []string{"--debug", "--trace", "--verbose"})
+}
+
+func TestCompletionCommand(t *testing.T) {
+	oldEnv := NewEnvSnapshot()
+	defer oldEnv.Restore()
+
+	os.Setenv("GO_FLAGS_COMPLETION", "1")
+
+	var opts struct {
+		Verbose bool `short:"v" long:"verbose" description:"Show verbose debug information"`
+		Value   bool `long:"value" description:"A value"`
+
+		Add struct {
+		} `command:"add" description:"Add an item"`
+
+		Debug struct {
+		} `command:"debug" hidden:"yes"`
+	}
+
+	p := NewNamedParser("TestCompletionCommand", None)
+	p.AddGroup("Application Options", "The application options", &opts)
+
+	cmd := p.Find("__complete")
+
+	if cmd == nil {
+		t.Fatalf("Expected __complete command")
+	}
+
+	if !cmd.Hidden {
+		t.Errorf("Expected __complete command to be hidden")
+	}
+
+	var buf bytes.Buffer
+	p.WriteHelp(&buf)
+
+	if strings.Contains(buf.String(), "__complete") || strings.Contains(buf.String(), "  debug") {
+		t.Errorf("Expected hidden commands not to be shown in help, but got:\n%s", buf.String())
+	}
+
+	c := cmd.data.(*completion)
+	c.Cursor = 0
+	c.TabSeparated = true
+
+	buf.Reset()
+	c.print(&buf, c.completeCursor([]string{"--v", "add"}))
+
+	assertString(t, buf.String(), "--value\tA value\n--verbose\tShow verbose debug information\n")
+
+	c.Cursor = 1
+	items := c.completeCursor([]string{"--value"})
+
+	if len(items) != 1 || items[0].Item != "add" {
+		t.Errorf("Expected only the add command to be completed, but got %v", items)
+	}
+}
+
+func TestWriteBashCompletion(t *testing.T) {
+	var opts struct {
+		Verbose bool   `short:"v" long:"verbose" description:"Show verbose debug information"`
+		Value   string `long:"value" description:"A value"`
+		Level   int    `long:"level" optional:"yes" optional-value:"1"`
+	}
+
+	p := NewNamedParser("my-app", None)
+	p.AddGroup("Application Options", "", &opts)
+
+	c := &completion{parser: p, ValueSuffix: true}
+
+	ret := c.complete([]string{"--"})
+	items := make([]string, len(ret))
+
+	for i, v := range ret {
+		items[i] = v.Item
+	}
+
+	assertStringArray(t, items, []string{"--level", "--value" + string(defaultNameArgDelimiter), "--verbose"})
+
+	for _, withDescriptions := range []bool{false, true} {
+		var buf bytes.Buffer
+		p.WriteBashCompletion(&buf, withDescriptions)
+
+		script := buf.String()
+
+		expected := []string{
+			"_my_app_completion() {",
+			"__complete --value-suffix --tab-separated -- ",
+			"compopt -o nospace",
+			"complete -F _my_app_completion my-app\n",
+		}
+
+		if withDescriptions {
+			expected = append(expected, "if [[ 1 -eq 1 &&")
+		} else {
+			expected = append(expected, "if [[ 0 -eq 1 &&")
+		}
+
+		for _, s := range expected {
+			if !strings.Contains(script, s) {
+				t.Errorf("Expected completion script to contain %q but got:\n\n%s", s, script)
+			}
+		}
+	}
+}
@@ -6,6 +6,8 @@ package flags
 
 import (
 	"fmt"
+	"os"
+	"os/user"
 	"reflect"
 	"strconv"
 	"strings"
@@ -28,6 +30,16 @@ type Unmarshaler interface {
 	UnmarshalFlag(value string) error
 }
 
+// Normalizer is the interface implemented by types that want to normalize
+// a flag argument (for example by trimming or lowercasing it) before it is
+// checked (e.g. against the choices of the flag) and converted to the value
+// of the flag.
+type Normalizer interface {
+	// Normalize returns the normalized form of a string value
+	// representation, or an error if the value cannot be normalized.
+	Normalize(value string) (string, error)
+}
+
 func getBase(options multiTag, base int) (int, error) {
 	sbase := options.Get("base")
 
@@ -67,6 +79,10 @@ func convertToString(val reflect.Value, options multiTag) (string, error) {
 		return stringer.String(), nil
 	}
 
+	if tp == optDurationType {
+		return optDurationToString(val, options), nil
+	}
+
 	switch tp.Kind() {
 	case reflect.String:
 		return val.String(), nil
@@ -77,23 +93,31 @@ func convertToString(val reflect.Value, options multiTag) (string, error) {
 
 		return "false", nil
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if bits := options.Get("bits"); len(bits) != 0 {
+			return formatBits(uint64(val.Int()), bits), nil
+		}
+
 		base, err := getBase(options, 10)
 
 		if err != nil {
 			return "", err
 		}
 
-		return strconv.FormatInt(val.Int(), base), nil
+		return strconv.FormatInt(val.Int(), base) + baseUnit(options.Get("unit")), nil
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if bits := options.Get("bits"); len(bits) != 0 {
+			return formatBits(val.Uint(), bits), nil
+		}
+
 		base, err := getBase(options, 10)
 
 		if err != nil {
 			return "", err
 		}
 
-		return strconv.FormatUint(val.Uint(), base), nil
+		return strconv.FormatUint(val.Uint(), base) + baseUnit(options.Get("unit")), nil
 	case reflect.Float32, reflect.Float64:
-		return strconv.FormatFloat(val.Float(), 'g', -1, tp.Bits()), nil
+		return strconv.FormatFloat(val.Float(), 'g', -1, tp.Bits()) + baseUnit(options.Get("unit")), nil
 	case reflect.Slice:
 		if val.Len() == 0 {
 			return "", nil
@@ -136,7 +160,7 @@ func convertToString(val reflect.Value, options multiTag) (string, error) {
 				return "", err
 			}
 
-			ret += keyitem + ":" + item
+			ret += keyitem + keyValueDelimiter(options) + item
 		}
 
 		return ret + "}", nil
@@ -169,7 +193,109 @@ func convertUnmarshal(val string, retval reflect.Value) (bool, error) {
 	return false, nil
 }
 
+// normalizeValue normalizes a value using the Normalizer implemented by the
+// type it is converted to, if any. Elements of slices and keys and values of
+// maps are normalized using the Normalizer of their own type.
+func normalizeValue(val string, tp reflect.Type, options multiTag) (string, error) {
+	for tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+
+	if normalizer, ok := reflect.New(tp).Interface().(Normalizer); ok {
+		return normalizer.Normalize(val)
+	}
+
+	switch tp.Kind() {
+	case reflect.Slice:
+		return normalizeValue(val, tp.Elem(), options)
+	case reflect.Map:
+		delim := keyValueDelimiter(options)
+		parts := strings.SplitN(val, delim, 2)
+
+		key, err := normalizeValue(parts[0], tp.Key(), options)
+
+		if err != nil || len(parts) == 1 {
+			return key, err
+		}
+
+		value, err := normalizeValue(parts[1], tp.Elem(), options)
+
+		if err != nil {
+			return "", err
+		}
+
+		return key + delim + value, nil
+	}
+
+	return val, nil
+}
+
+// splitSeparated splits a slice or map option value into its elements using
+// the separator given by the sep tag. Without a separator, the value is a
+// single element.
+func splitSeparated(val string, options multiTag) []string {
+	if sep := options.Get("sep"); len(sep) != 0 {
+		return strings.Split(val, sep)
+	}
+
+	return []string{val}
+}
+
+// keyValueDelimiter returns the delimiter between the key and the value of
+// the elements of a map option, given by the key-value-delimiter tag. The
+// default is a colon.
+func keyValueDelimiter(options multiTag) string {
+	if delim := options.Get("key-value-delimiter"); len(delim) != 0 {
+		return delim
+	}
+
+	return ":"
+}
+
+// expandPath expands a leading ~ or ~user to the home directory of the
+// current or the named user, and $VAR or ${VAR} references to the values
+// of the corresponding environment variables.
+func expandPath(val string) (string, error) {
+	var home string
+
+	if strings.HasPrefix(val, "~") {
+		name := val[1:]
+		rest := ""
+
+		if i := strings.IndexRune(name, '/'); i >= 0 {
+			name, rest = name[:i], name[i:]
+		}
+
+		var u *user.User
+		var err error
+
+		if len(name) == 0 {
+			u, err = user.Current()
+		} else {
+			u, err = user.Lookup(name)
+		}
+
+		if err != nil {
+			if len(name) == 0 {
+				return "", fmt.Errorf("cannot expand `~': %s", err)
+			}
+
+			return "", fmt.Errorf("cannot expand `~%s': unknown user", name)
+		}
+
+		home, val = u.HomeDir, rest
+	}
+
+	return home + os.Expand(val, os.Getenv), nil
+}
+
 func convert(val string, retval reflect.Value, options multiTag) error {
+	// Allocate nil pointers (e.g. elements of a slice of pointers), such
+	// that an Unmarshaler is not called on a nil receiver
+	if retval.Kind() == reflect.Ptr && retval.IsNil() && retval.CanSet() {
+		retval.Set(reflect.New(retval.Type().Elem()))
+	}
+
 	if ok, err := convertUnmarshal(val, retval); ok {
 		return err
 	}
@@ -188,8 +314,22 @@ func convert(val string, retval reflect.Value, options multiTag) error {
 		return nil
 	}
 
+	if tp == optDurationType {
+		return convertOptDuration(val, retval, options)
+	}
+
 	switch tp.Kind() {
 	case reflect.String:
+		if options.Get("expand") != "" {
+			expanded, err := expandPath(val)
+
+			if err != nil {
+				return err
+			}
+
+			val = expanded
+		}
+
 		retval.SetString(val)
 	case reflect.Bool:
 		if val == "" {
@@ -204,7 +344,9 @@ func convert(val string, retval reflect.Value, options multiTag) error {
 			retval.SetBool(b)
 		}
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		base, err := getBase(options, 10)
+		// Without an explicit base, the base is derived from the prefix of
+		// the value (0x, 0o, 0b or 0), like integer literals in Go
+		base, err := getBase(options, 0)
 
 		if err != nil {
 			return err
@@ -218,7 +360,7 @@ func convert(val string, retval reflect.Value, options multiTag) error {
 
 		retval.SetInt(parsed)
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		base, err := getBase(options, 10)
+		base, err := getBase(options, 0)
 
 		if err != nil {
 			return err
@@ -242,43 +384,49 @@ func convert(val string, retval reflect.Value, options multiTag) error {
 	case reflect.Slice:
 		elemtp := tp.Elem()
 
-		elemvalptr := reflect.New(elemtp)
-		elemval := reflect.Indirect(elemvalptr)
+		for _, v := range splitSeparated(val, options) {
+			elemvalptr := reflect.New(elemtp)
+			elemval := reflect.Indirect(elemvalptr)
 
-		if err := convert(val, elemval, options); err != nil {
-			return err
-		}
+			if err := convert(v, elemval, options); err != nil {
+				return err
+			}
 
-		retval.Set(reflect.Append(retval, elemval))
+			retval.Set(reflect.Append(retval, elemval))
+		}
 	case reflect.Map:
-		parts := strings.SplitN(val, ":", 2)
+		for _, v := range splitSeparated(val, options) {
+			// Only the first delimiter separates the key from the
+			// value, such that values can contain the delimiter
+			parts := strings.SplitN(v, keyValueDelimiter(options), 2)
 
-		key := parts[0]
-		var value string
+			key := parts[0]
+			var value string
 
-		if len(parts) == 2 {
-			value = parts[1]
-		}
+			if len(parts) == 2 {
+				value = parts[1]
+			}
 
-		keytp := tp.Key()
-		keyval := reflect.New(keytp)
+			keytp := tp.Key()
+			keyval := reflect.New(keytp)
 
-		if err := convert(key, keyval, options); err != nil {
-			return err
-		}
+			if err := convert(key, keyval, options); err != nil {
+				return err
+			}
 
-		valuetp := tp.Elem()
-		valueval := reflect.New(valuetp)
+			valuetp := tp.Elem()
+			valueval := reflect.New(valuetp)
 
-		if err := convert(value, valueval, options); err != nil {
-			return err
-		}
+			if err := convert(value, valueval, options); err != nil {
+				return err
+			}
 
-		if retval.IsNil() {
-			retval.Set(reflect.MakeMap(tp))
-		}
+			if retval.IsNil() {
+				retval.Set(reflect.MakeMap(tp))
+			}
 
-		retval.SetMapIndex(reflect.Indirect(keyval), reflect.Indirect(valueval))
+			retval.SetMapIndex(reflect.Indirect(keyval), reflect.Indirect(valueval))
+		}
 	case reflect.Ptr:
 		if retval.IsNil() {
 			retval.Set(reflect.New(retval.Type().Elem()))
@@ -295,19 +443,27 @@ func convert(val string, retval reflect.Value, options multiTag) error {
 }
 
 func wrapText(s string, l int, prefix string) string {
-	// Basic text wrapping of s at spaces to fit in l
+	return wrapTextFirst(s, l, l, prefix)
+}
+
+// wrapTextFirst wraps s like wrapText, but wraps the first line to fit in
+// first instead of l (e.g. to leave room for text following the first line).
+func wrapTextFirst(s string, first int, l int, prefix string) string {
+	// Basic text wrapping of s at spaces to fit in l. Lines narrower than
+	// two columns cannot fit a character and a hyphen, so the text is left
+	// unwrapped from there
 	var ret string
 
 	s = strings.TrimSpace(s)
 
-	for len(s) > l {
+	for w := first; w > 1 && len(s) > w; w = l {
 		// Try to split on space
 		suffix := ""
 
-		pos := strings.LastIndex(s[:l], " ")
+		pos := strings.LastIndex(s[:w], " ")
 
 		if pos < 0 {
-			pos = l - 1
+			pos = w - 1
 			suffix = "-\n"
 		}
 
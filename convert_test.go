@@ -1,6 +1,9 @@
 package flags
 
 import (
+	"fmt"
+	"os"
+	"os/user"
 	"testing"
 	"time"
 )
@@ -158,6 +161,87 @@ func TestConvertToStringInvalidUintBase(t *testing.T) {
 	assertError(t, err, ErrMarshal, "strconv.ParseInt: parsing \"no\": invalid syntax")
 }
 
+func TestConvertIntPrefixes(t *testing.T) {
+	var opts = struct {
+		Offset int64  `long:"offset"`
+		Mode   uint32 `long:"mode"`
+		Mask   uint8  `long:"mask"`
+		Count  int    `long:"count"`
+		Neg    int    `long:"neg"`
+		Hex    int    `long:"hex" base:"16"`
+	}{}
+
+	ret := assertParseSuccess(t, &opts,
+		"--offset=0x1000",
+		"--mode=0755",
+		"--mask=0b1010",
+		"--count=0o17",
+		"--neg=-42",
+		"--hex=ff",
+	)
+
+	assertStringArray(t, ret, []string{})
+
+	if opts.Offset != 0x1000 {
+		t.Errorf("Expected Offset to be 0x1000 but got %#x", opts.Offset)
+	}
+
+	if opts.Mode != 0755 {
+		t.Errorf("Expected Mode to be 0755 but got %#o", opts.Mode)
+	}
+
+	if opts.Mask != 10 {
+		t.Errorf("Expected Mask to be 10 but got %d", opts.Mask)
+	}
+
+	if opts.Count != 15 {
+		t.Errorf("Expected Count to be 15 but got %d", opts.Count)
+	}
+
+	if opts.Neg != -42 {
+		t.Errorf("Expected Neg to be -42 but got %d", opts.Neg)
+	}
+
+	if opts.Hex != 255 {
+		t.Errorf("Expected Hex to be 255 but got %d", opts.Hex)
+	}
+
+	assertParseFail(t, ErrMarshal, fmt.Sprintf("invalid argument for flag `%soffset' (expected int64): strconv.ParseInt: parsing \"0xzz\": invalid syntax", defaultLongOptDelimiter), &opts, "--offset=0xzz")
+}
+
+func TestConvertExpand(t *testing.T) {
+	u, err := user.Current()
+
+	if err != nil {
+		t.Skipf("Cannot determine current user: %s", err)
+	}
+
+	var opts = struct {
+		Path  string   `long:"path" expand:"yes"`
+		Paths []string `long:"paths" expand:"yes"`
+		Plain string   `long:"plain"`
+	}{}
+
+	oldEnv := NewEnvSnapshot()
+	defer oldEnv.Restore()
+
+	os.Setenv("TEST_EXPAND", "value")
+
+	assertParseSuccess(t, &opts, "--path", "~/$TEST_EXPAND", "--paths", "~", "--paths", "${TEST_EXPAND}/~", "--plain", "~/$TEST_EXPAND")
+
+	assertString(t, opts.Path, u.HomeDir+"/value")
+	assertStringArray(t, opts.Paths, []string{u.HomeDir, "value/~"})
+	assertString(t, opts.Plain, "~/$TEST_EXPAND")
+}
+
+func TestConvertExpandUnknownUser(t *testing.T) {
+	var opts = struct {
+		Path string `long:"path" expand:"yes"`
+	}{}
+
+	assertParseFail(t, ErrMarshal, "invalid argument for flag `--path' (expected string): cannot expand `~no-such-user-xyz': unknown user", &opts, "--path", "~no-such-user-xyz/file")
+}
+
 func TestWrapText(t *testing.T) {
 	s := "Lorem ipsum dolor sit amet, consectetur adipisicing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua. Ut enim ad minim veniam, quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat. Duis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur. Excepteur sint occaecat cupidatat non proident, sunt in culpa qui officia deserunt mollit anim id est laborum."
 
@@ -181,3 +265,25 @@ func TestWrapText(t *testing.T) {
 		}
 	}
 }
+
+func TestConvertSeparated(t *testing.T) {
+	var opts = struct {
+		Labels map[string]string `long:"label" sep:","`
+		Ints   []int             `long:"int" sep:","`
+		Plain  []string          `long:"plain"`
+	}{}
+
+	assertParseSuccess(t, &opts, "--label", "k1:v1,k2:v2", "--label", "k3:v3", "--int", "1,2", "--int", "3", "--plain", "a,b")
+
+	if len(opts.Labels) != 3 || opts.Labels["k1"] != "v1" || opts.Labels["k2"] != "v2" || opts.Labels["k3"] != "v3" {
+		t.Errorf("Expected labels k1:v1, k2:v2 and k3:v3, but got %v", opts.Labels)
+	}
+
+	if len(opts.Ints) != 3 || opts.Ints[0] != 1 || opts.Ints[1] != 2 || opts.Ints[2] != 3 {
+		t.Errorf("Expected ints [1 2 3], but got %v", opts.Ints)
+	}
+
+	assertStringArray(t, opts.Plain, []string{"a,b"})
+
+	assertParseFail(t, ErrMarshal, "invalid argument for flag `--int' (expected []int): strconv.ParseInt: parsing \"x\": invalid syntax", &opts, "--int", "1,x")
+}
@@ -0,0 +1,96 @@
+package flags
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+type effectiveValue struct {
+	name   string
+	value  string
+	source string
+}
+
+// WriteEffectiveConfig writes the current value of every option of the
+// parser and its commands, together with where the value came from (see
+// Option.Source), as a table to the given writer. Unlike the ini writer, all
+// options are included (also those which cannot be specified in an ini file).
+// This is useful to diagnose which configuration layer (defaults, the
+// environment, ini files or the command line) an option value came from.
+// Values of options with a DefaultMask are shown as the mask, values of
+// secret options and options with a DefaultMask of - are hidden and options
+// of the built-in help group are omitted.
+func (p *Parser) WriteEffectiveConfig(writer io.Writer) {
+	rows := []effectiveValue{{"OPTION", "VALUE", "SOURCE"}}
+
+	p.eachCommand(func(c *Command) {
+		c.eachGroup(func(g *Group) {
+			if g.isBuiltinHelp {
+				return
+			}
+
+			for _, option := range g.options {
+				rows = append(rows, effectiveValue{
+					name:   option.effectiveName(),
+					value:  option.effectiveValue(),
+					source: option.source.String(),
+				})
+			}
+		})
+	}, true)
+
+	var namelen, valuelen int
+
+	for _, row := range rows {
+		if len(row.name) > namelen {
+			namelen = len(row.name)
+		}
+
+		if len(row.value) > valuelen {
+			valuelen = len(row.value)
+		}
+	}
+
+	for _, row := range rows {
+		fmt.Fprintf(writer, "%s%s  %s%s  %s\n",
+			row.name, strings.Repeat(" ", namelen-len(row.name)),
+			row.value, strings.Repeat(" ", valuelen-len(row.value)),
+			row.source)
+	}
+}
+
+func (option *Option) effectiveName() string {
+	if option.isEnvOnly() {
+		return "$" + option.EnvKeyWithNamespace()
+	}
+
+	return option.String()
+}
+
+// hiddenValue is shown instead of the value of secret options and options
+// with a default-mask of -, which are never shown.
+const hiddenValue = "<hidden>"
+
+func (option *Option) effectiveValue() string {
+	if option.DefaultMask == "-" || len(option.tag.Get("secret")) != 0 {
+		return hiddenValue
+	}
+
+	if len(option.DefaultMask) != 0 {
+		return option.DefaultMask
+	}
+
+	switch option.value.Kind() {
+	case reflect.Func:
+		return ""
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		if option.value.IsNil() {
+			return ""
+		}
+	}
+
+	v, _ := convertToString(option.value, option.tag)
+	return v
+}
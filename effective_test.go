@@ -0,0 +1,84 @@
+package flags
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWriteEffectiveConfig(t *testing.T) {
+	oldEnv := NewEnvSnapshot()
+	defer oldEnv.Restore()
+
+	os.Setenv("TEST_LEVEL", "3")
+
+	var opts struct {
+		Verbose  bool     `short:"v" long:"verbose"`
+		Level    int      `long:"level" env:"TEST_LEVEL"`
+		Host     string   `long:"host" default:"localhost"`
+		Names    []string `long:"name"`
+		Password string   `long:"password" default-mask:"***"`
+		Pass     string   `long:"pass" default-mask:"-"`
+		Token    string   `long:"token" secret:"yes"`
+		Unset    *int     `long:"unset"`
+	}
+
+	p := NewParser(&opts, None)
+	p.SecretResolver = func(uri string) (string, error) {
+		return "S3CR3T", nil
+	}
+
+	if err := NewIniParser(p).Parse(strings.NewReader("name = a\nname = b\npassword = secret\n")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := p.ParseArgs([]string{"-v", "--pass", "hunter2", "--token", "secret://x"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	sources := make(map[string]ValueSource)
+
+	for _, option := range p.Groups()[0].Options() {
+		sources[option.LongName] = option.Source()
+	}
+
+	for _, item := range []struct {
+		name   string
+		source ValueSource
+	}{
+		{"verbose", SourceCommandLine},
+		{"level", SourceEnv},
+		{"host", SourceDefault},
+		{"name", SourceIni},
+		{"unset", SourceDefault},
+	} {
+		if source := sources[item.name]; source != item.source {
+			t.Errorf("Expected source of %s to be %s but got %s", item.name, item.source, source)
+		}
+	}
+
+	var b bytes.Buffer
+	p.WriteEffectiveConfig(&b)
+
+	expected := `OPTION         VALUE      SOURCE
+-v, --verbose  true       cli
+--level        3          env
+--host         localhost  default
+--name         [a, b]     ini
+--password     ***        ini
+--pass         <hidden>   cli
+--token        <hidden>   cli
+--unset                   default
+`
+
+	if b.String() != expected {
+		ret, err := helpDiff(b.String(), expected)
+
+		if err != nil {
+			t.Errorf("Unexpected effective config: %s\nexpected:\n%s", b.String(), expected)
+		} else {
+			t.Errorf("Unexpected effective config:\n\n%s", ret)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package flags
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// EnvExportOptions for writing environment variable exports (see
+// Parser.WriteEnvExports).
+type EnvExportOptions uint
+
+const (
+	// EnvExportNone indicates no options.
+	EnvExportNone EnvExportOptions = 0
+
+	// EnvExportAll indicates that options without an env key are written
+	// as well, using a key derived from their long name (e.g. LOG_LEVEL
+	// for --log-level). Options without a long name are still skipped.
+	EnvExportAll = 1 << iota
+)
+
+// WriteEnvExports writes the current value of every option with an env key,
+// of the parser and its commands, as a shell export statement (e.g. export
+// MYAPP_LEVEL='3') to the given writer. Values are quoted for POSIX shells,
+// such that the output can be evaluated by a script. The values of slice
+// and map options are joined using the env-delim of the option, or encoded
+// as JSON for options with an env-format of json. Slice and map options with
+// more than one value which cannot be represented in a single environment
+// variable, as well as function options and secret options (which could
+// hold a resolved secret), are skipped.
+func (p *Parser) WriteEnvExports(writer io.Writer, options EnvExportOptions) {
+	p.eachCommand(func(c *Command) {
+		c.eachGroup(func(g *Group) {
+			if g.isBuiltinHelp {
+				return
+			}
+
+			for _, option := range g.options {
+				key := option.EnvKeyWithNamespace()
+
+				if len(key) == 0 && (options&EnvExportAll) != EnvExportNone {
+					key = envKeyFromLongName(option.LongNameWithNamespace())
+				}
+
+				if len(key) == 0 {
+					continue
+				}
+
+				if value, ok := option.envExportValue(); ok {
+					fmt.Fprintf(writer, "export %s=%s\n", key, shellQuote(value))
+				}
+			}
+		})
+	}, true)
+}
+
+// envKeyFromLongName derives an environment variable name from the long name
+// of an option.
+func envKeyFromLongName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' {
+			return '_'
+		}
+
+		return r
+	}, strings.ToUpper(name))
+}
+
+// shellQuote quotes a value for POSIX shells using single quotes.
+func shellQuote(value string) string {
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
+
+// envExportValue returns the current value of the option in the format in
+// which it is read from the environment, and whether the value can be
+// represented as such.
+func (option *Option) envExportValue() (string, bool) {
+	if len(option.tag.Get("secret")) != 0 {
+		return "", false
+	}
+
+	val := option.value
+
+	switch val.Kind() {
+	case reflect.Func:
+		return "", false
+	case reflect.Slice, reflect.Map:
+		var values []string
+
+		if val.Kind() == reflect.Slice {
+			for i := 0; i < val.Len(); i++ {
+				v, _ := convertToString(val.Index(i), option.tag)
+				values = append(values, v)
+			}
+		} else {
+			for _, k := range val.MapKeys() {
+				ks, _ := convertToString(k, option.tag)
+				vs, _ := convertToString(val.MapIndex(k), option.tag)
+
+				values = append(values, ks+keyValueDelimiter(option.tag)+vs)
+			}
+
+			sort.Strings(values)
+		}
+
+		if option.tag.Get("env-format") == "json" {
+			return encodeEnvValue(values, val.Kind() == reflect.Map, keyValueDelimiter(option.tag)), true
+		}
+
+		if len(option.EnvDefaultDelim) == 0 && len(values) > 1 {
+			return "", false
+		}
+
+		return strings.Join(values, option.EnvDefaultDelim), true
+	case reflect.Ptr, reflect.Interface:
+		if val.IsNil() {
+			return "", true
+		}
+	}
+
+	v, _ := convertToString(val, option.tag)
+	return v, true
+}
+
+// encodeEnvValue encodes the values of a slice option as a JSON array, or
+// the key:value pairs (separated by delim) of a map option as a JSON object
+// (see the env-format tag).
+func encodeEnvValue(values []string, isMap bool, delim string) string {
+	var data []byte
+
+	if isMap {
+		obj := make(map[string]string)
+
+		for _, kv := range values {
+			parts := strings.SplitN(kv, delim, 2)
+			obj[parts[0]] = parts[1]
+		}
+
+		data, _ = json.Marshal(obj)
+	} else {
+		if values == nil {
+			values = []string{}
+		}
+
+		data, _ = json.Marshal(values)
+	}
+
+	return string(data)
+}
@@ -0,0 +1,52 @@
+package flags
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteEnvExports(t *testing.T) {
+	oldEnv := NewEnvSnapshot()
+	defer oldEnv.Restore()
+
+	var opts struct {
+		Level   int               `long:"level" env:"APP_LEVEL"`
+		Message string            `long:"message" env:"APP_MESSAGE"`
+		Tags    []string          `long:"tag" env:"APP_TAGS" env-delim:","`
+		Hosts   []string          `long:"host" env:"APP_HOSTS"`
+		Labels  map[string]string `long:"label" env:"APP_LABELS" env-format:"json"`
+		LogFile string            `long:"log-file"`
+		Verbose bool              `short:"v"`
+		Token   string            `long:"token" env:"APP_TOKEN" secret:"yes"`
+	}
+
+	p := NewParser(&opts, Default)
+	p.SecretResolver = func(uri string) (string, error) {
+		return "S3CR3T", nil
+	}
+
+	_, err := p.ParseArgs([]string{"--level", "3", "--message", "it's done", "--tag", "a", "--tag", "b",
+		"--host", "x", "--host", "y", "--label", "k:v", "--log-file", "/tmp/log", "--token", "secret://x"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	p.WriteEnvExports(&buf, EnvExportNone)
+
+	expected := `export APP_LEVEL='3'
+export APP_MESSAGE='it'\''s done'
+export APP_TAGS='a,b'
+export APP_LABELS='{"k":"v"}'
+`
+
+	assertString(t, buf.String(), expected)
+
+	buf.Reset()
+	p.WriteEnvExports(&buf, EnvExportAll)
+
+	expected += "export LOG_FILE='/tmp/log'\n"
+
+	assertString(t, buf.String(), expected)
+}
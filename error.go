@@ -2,7 +2,7 @@ package flags
 
 import (
 	"fmt"
-	"reflect"
+	"strconv"
 )
 
 // ErrorType represents the type of error.
@@ -52,10 +52,107 @@ const (
 
 	// ErrUnknownCommand indicates that an unknown command was specified.
 	ErrUnknownCommand
+
+	// ErrInvalidChoice indicates an invalid option value which only allows
+	// a certain number of choices.
+	ErrInvalidChoice
+
+	// ErrRange indicates that a numeric option value is out of the range
+	// of the option type.
+	ErrRange
+
+	// ErrResponseFile indicates that a response file could not be read,
+	// or that response files refer to each other recursively.
+	ErrResponseFile
+
+	// ErrVersion indicates that the built-in version option was specified
+	// (the error contains the version).
+	ErrVersion
+
+	// ErrEmptyValue indicates that an empty value was specified for an
+	// option which does not allow empty values (see the non-empty tag).
+	ErrEmptyValue
+
+	// ErrFeatureDisabled indicates that an option was specified which
+	// requires a feature that is not enabled (see the requires-feature tag).
+	ErrFeatureDisabled
+
+	// ErrShortCircuit indicates that parsing was stopped because an option
+	// tagged with short-circuit was specified. This error is never printed
+	// by the parser (see PrintErrors).
+	ErrShortCircuit
+
+	// ErrInvalidPath indicates that the path specified for an option does
+	// not satisfy the must-exist, readable or writable tags of the option.
+	ErrInvalidPath
+
+	// ErrDuplicatedValue indicates that the same value was specified more
+	// than once for a slice option with the unique tag.
+	ErrDuplicatedValue
+
+	// ErrExtraArgs indicates that more arguments were specified than the
+	// positional arguments of the active command accept (see
+	// DisallowExtraArgs).
+	ErrExtraArgs
+
+	// ErrConflictingFlags indicates that an option was specified together
+	// with an option it conflicts with (see the conflicts tag).
+	ErrConflictingFlags
 )
 
 func (e ErrorType) String() string {
-	return reflect.TypeOf(e).Name()
+	switch e {
+	case ErrUnknown:
+		return "unknown"
+	case ErrExpectedArgument:
+		return "expected argument"
+	case ErrUnknownFlag:
+		return "unknown flag"
+	case ErrUnknownGroup:
+		return "unknown group"
+	case ErrMarshal:
+		return "marshal"
+	case ErrHelp:
+		return "help"
+	case ErrNoArgumentForBool:
+		return "no argument for bool"
+	case ErrRequired:
+		return "required"
+	case ErrShortNameTooLong:
+		return "short name too long"
+	case ErrDuplicatedFlag:
+		return "duplicated flag"
+	case ErrTag:
+		return "tag"
+	case ErrCommandRequired:
+		return "command required"
+	case ErrUnknownCommand:
+		return "unknown command"
+	case ErrInvalidChoice:
+		return "invalid choice"
+	case ErrRange:
+		return "range"
+	case ErrResponseFile:
+		return "response file"
+	case ErrVersion:
+		return "version"
+	case ErrEmptyValue:
+		return "empty value"
+	case ErrFeatureDisabled:
+		return "feature disabled"
+	case ErrShortCircuit:
+		return "short circuit"
+	case ErrInvalidPath:
+		return "invalid path"
+	case ErrDuplicatedValue:
+		return "duplicated value"
+	case ErrExtraArgs:
+		return "extra arguments"
+	case ErrConflictingFlags:
+		return "conflicting flags"
+	}
+
+	return "unrecognized error type"
 }
 
 // Error represents a parser error. The error returned from Parse is of this
@@ -66,6 +163,12 @@ type Error struct {
 
 	// The error message
 	Message string
+
+	// Where the value which caused the error came from, if the error
+	// concerns the value of an option: "command line", "environment
+	// variable KEY", "file FILE line N" or, for ini values not read from
+	// a file, "ini line N"
+	Source string
 }
 
 // Error returns the error's message
@@ -93,3 +196,27 @@ func wrapError(err error) *Error {
 
 	return ret
 }
+
+// withErrorSource sets the source of an Error, if not already set, and
+// returns it.
+func withErrorSource(err error, source string) error {
+	if e, ok := err.(*Error); ok && len(e.Source) == 0 {
+		e.Source = source
+	}
+
+	return err
+}
+
+// wrapMarshalError wraps an error which occurred while converting a value
+// into an Error of type ErrRange or ErrMarshal, using the given message.
+func wrapMarshalError(err error, message string) *Error {
+	if e, ok := err.(*Error); ok {
+		return e
+	}
+
+	if e, ok := err.(*strconv.NumError); ok && e.Err == strconv.ErrRange {
+		return newError(ErrRange, message)
+	}
+
+	return newError(ErrMarshal, message)
+}
@@ -54,6 +54,11 @@ resulting value of Verbose will be {[true, true, true]}.
 Slice options work exactly the same as primitive type options, except that
 whenever the option is encountered, a value is appended to the slice.
 
+The options of embedded structs, including structs of unexported types and
+their groups (see the group tag), are added to the group or command of the
+embedding struct. This allows several commands to share a common set of
+options.
+
 Map options from string to primitive type are also supported. On the command
 line, you specify the value for such an option as key:value. For example
 
@@ -66,29 +71,58 @@ Then, the AuthorInfo map can be filled with something like
 
 Finally, for full control over the conversion between command line argument
 values and options, user defined types can choose to implement the Marshaler
-and Unmarshaler interfaces.
+and Unmarshaler interfaces. Types implementing the Normalizer interface get
+a chance to normalize (e.g. trim or lowercase) argument values before they
+are checked (e.g. against the choices of the option) and converted.
 
 
 Available field tags
 
 The following is a list of tags for struct fields supported by go-flags:
 
-    short:            the short name of the option (single character)
+    short:            the short name of the option (single character). Any
+                      printable character, including digits and non-ASCII
+                      characters, can be used except for white space, - and
+                      the name/argument delimiters (= and, on Windows, / and
+                      :). Specifying more than one character results in an
+                      ErrShortNameTooLong error, an invalid character in an
+                      ErrTag error
     long:             the long name of the option
     required:         whether an option is required to appear on the command
                       line. If a required option is not present, the parser will
-                      return ErrRequired (optional)
+                      return ErrRequired. An option specified with an empty
+                      value (e.g. --name= or --name "") is present and
+                      therefore satisfies required, unless non-empty is
+                      also specified (optional)
+    non-empty:        if non-empty, specifying an empty value for the option
+                      results in an ErrEmptyValue error, on the command line
+                      as well as in the environment or an ini file (optional)
     description:      the description of the option (optional)
     long-description: the long description of the option. Currently only
                       displayed in generated man pages (optional)
     no-flag:          if non-empty this field is ignored as an option (optional)
+    flags:            if "-", this field is ignored entirely, like with
+                      no-flag, including any options, commands or
+                      arguments of a struct field. This allows
+                      non-option state to be kept in the options struct
+                      (optional)
 
     optional:       whether an argument of the option is optional (optional)
     optional-value: the value of an optional option when the option occurs
                     without an argument. This tag can be specified multiple
                     times in the case of maps or slices (optional)
     default:        the default value of an option. This tag can be specified
-                    multiple times in the case of slices or maps (optional)
+                    multiple times in the case of slices or maps. Values
+                    specified for a slice or map option replace its default
+                    values rather than being added to them. A default
+                    value can be a text/template referring to the values of
+                    the other options of the same group by field name, e.g.
+                    default:"{{.DataDir}}/logs". Such defaults are computed
+                    after parsing, once all options without a default
+                    template have their values (from the command line, the
+                    environment or their plain default), such that they can
+                    refer to each other as long as there are no cycles
+                    (optional)
     default-mask:   when specified, this value will be displayed in the help
                     instead of the actual default value. This is useful
                     mostly for hiding otherwise sensitive information from
@@ -97,9 +131,143 @@ The following is a list of tags for struct fields supported by go-flags:
                     (optional)
     value-name:     the name of the argument value (to be shown in the help,
                     (optional)
+    hidden:         if non-empty, the option is not shown in the help, man
+                    page or completions (optional)
+    secret:         if non-empty, values of the option starting with the
+                    parser's SecretPrefix are resolved using the parser's
+                    SecretResolver (optional)
+    choice:         limits the values for an option to a set of values.
+                    This tag can be specified multiple times. A single
+                    choice tag is split into multiple choices on commas
+                    (e.g. choice:"a,b,c") (optional)
+    choice-sep:     the separator on which the choice tags are split,
+                    instead of a comma. When specified, all choice tags are
+                    split on the separator, which allows choices containing
+                    commas (optional)
+    bits:           a list of names and values of bits (e.g.
+                    bits:"cache=1,compression=2") of an integer option. The
+                    option is then specified using the names of its bits
+                    (e.g. --enable=cache --enable=compression, or a comma
+                    separated list of names) and their values are OR-ed into
+                    the option. The names are shown in the help like choices
+                    and cannot be combined with the choice tag (optional)
+    env:            the default value of the option is overridden from the
+                    specified environment variable, if not empty. Boolean
+                    options accept the (case insensitive) values 1, 0,
+                    true, false, yes, no, on and off (optional)
+    env-alias:      a deprecated name of the 'env' environment variable,
+                    which is read when the environment variable is not set.
+                    Using it adds a warning to the parser (see
+                    Parser.Warnings). Can be specified multiple times
+                    (optional)
+    env-delim:      the 'env' default value is split into multiple values
+                    using this delimiter, for slices and maps (optional)
+    env-format:     the encoding of the 'env' default value of a slice or
+                    map option. The only supported format is json, in which
+                    case the value is a JSON array (for slices) or object
+                    (for maps), e.g. ["a", "b"]. Strings are used as is and
+                    other JSON values are converted from their JSON
+                    representation (optional)
+    env-only:       if non-empty, the option can only be set from the
+                    environment variable specified by env (which is
+                    required). The option cannot be specified on the command
+                    line or in an ini file, but is shown in the help (without
+                    option names and without its current value) together
+                    with its environment variable. The option does not need
+                    a short or long name (optional)
+    sep:            splits a single value of a slice or map option into
+                    multiple elements (or key:value pairs) using this
+                    separator, e.g. sep:",". Aliases, choices and units
+                    apply to each of the elements (optional)
+    key-value-delimiter: the delimiter between the key and the value of the
+                    elements of a map option, e.g. key-value-delimiter:"="
+                    for --env=NAME=value. Only the first occurrence of the
+                    delimiter separates the key from the value, such that
+                    values can contain it. The default is : (optional)
+    expand:         if non-empty, a leading ~ or ~user in string values is
+                    expanded to the home directory of the user, and $VAR
+                    references are expanded from the environment. Useful
+                    for options representing filesystem paths (optional)
+    conflicts:      a comma separated list of long names (including
+                    namespaces) of options which cannot be specified
+                    together with the option, e.g. conflicts:"quiet". The
+                    options can belong to any group of the command of the
+                    option or of its parent commands. Specifying the option
+                    and a conflicting option (on the command line or in the
+                    environment) results in an ErrConflictingFlags error.
+                    Note that conflicts are not implicitly symmetric. An
+                    unknown name results in an ErrTag error when parsing
+                    (optional)
+    requires-feature: the option can only be used (on the command line, in
+                    the environment or in an ini file) when the named
+                    feature is enabled in the parser's EnabledFeatures.
+                    Otherwise, using the option results in an
+                    ErrFeatureDisabled error and the option is hidden
+                    (optional)
+    short-circuit:  if non-empty, parsing stops as soon as the (bool or func)
+                    option is specified. Default values are still applied,
+                    but required options and commands are not checked and
+                    the command is not executed. The parser then returns an
+                    error of type ErrShortCircuit, e.g. for --print-config
+                    (optional)
+    consumes-rest:  if non-empty, all the arguments following the option
+                    are added, verbatim, to the (slice) option and parsing
+                    stops, e.g. for --exec ls -la (optional)
+    slurp:          if non-empty, the (slice) option takes all the arguments
+                    following its value, up to the next option, as
+                    additional values, e.g. --files a b c. Note that this
+                    leaves no arguments for positional arguments or
+                    commands until another option is specified (optional)
+    bool-value:     if non-empty, the bool option accepts an explicit value
+                    (any value accepted by strconv.ParseBool, e.g. true or
+                    false), either as --flag=false or as the following
+                    argument (--flag false). Note that this makes a
+                    following argument which looks like a bool (e.g. a
+                    positional argument named 1) the value of the option
+                    (optional)
+    must-exist:     either file or dir. The path specified for a string
+                    (or string slice) option must exist and be a file or
+                    a directory respectively (optional)
+    readable:       if non-empty, the path specified for a string (or
+                    string slice) option must exist and be readable
+                    (optional)
+    writable:       if non-empty, the path specified for a string (or
+                    string slice) option must be writable. A path which
+                    does not exist is writable if a file can be created
+                    in its directory (optional)
+    aliases:        a comma separated list of alias=value pairs. Values of
+                    the option equal to an alias are replaced by the
+                    corresponding value before they are validated and
+                    stored, e.g. aliases:"use1=us-east-1" (optional)
+    unique:         if non-empty, specifying the same value more than once
+                    for the slice option is an error. Values are compared
+                    after conversion, e.g. 1 and 01 are the same value for
+                    an int slice (optional)
+    dedup:          if non-empty, values of the slice option which equal a
+                    value specified before are dropped, such that every value
+                    is stored once, in the order in which the values were
+                    first specified. Values are compared after conversion.
+                    Unlike unique, specifying a value more than once is not
+                    an error (optional)
+    sentinel:       a comma separated list of words which disable an
+                    OptDuration option instead of specifying a duration,
+                    e.g. sentinel:"never,none" for --timeout=never
+                    (optional)
 
-    base: a base (radix) used to convert strings to integer values, the
-          default base is 10 (i.e. decimal) (optional)
+    unit: the unit of the values of a numeric option, which must be
+          specified as suffix of each value (e.g. unit:"ms" for
+          --interval=500ms). A comma separated list of units with factors
+          relative to the base unit (the unit without a factor) can be
+          specified, e.g. unit:"ms,s=1000,m=60000" in which case 2s is
+          stored as 2000. Values are converted back to strings in the base
+          unit (optional)
+
+    base: a base (radix) used to convert strings to integer values. By
+          default, the base is derived from the prefix of the value like
+          integer literals in Go: 0x or 0X for hexadecimal, 0o, 0O or a
+          leading 0 for octal, 0b or 0B for binary and decimal otherwise.
+          Integer values are always converted back to strings (e.g. for
+          ini files) in decimal, unless a base is specified (optional)
 
     ini-name:       the explicit ini option name (optional)
     no-ini:         if non-empty this field is ignored as an ini option
@@ -111,10 +279,26 @@ The following is a list of tags for struct fields supported by go-flags:
                           gets prepended to every option's long name and
                           subgroup's namespace of this group, separated by
                           the parser's namespace delimiter (optional)
+    env-namespace:        when specified on a group struct field, the env
+                          namespace gets prepended to every option's env key
+                          and subgroup's env namespace of this group,
+                          separated by the parser's env namespace delimiter
+                          (optional)
+    hidden:               when specified on a group or command struct field,
+                          the group (and its options) or command is not shown
+                          in the help, man page or completions (optional)
     command:              when specified on a struct field, makes the struct
                           field a (sub)command with the given name (optional)
     subcommands-optional: when specified on a command struct field, makes
                           any subcommands of that command optional (optional)
+    passthrough:          when specified on a command struct field, an
+                          unknown subcommand name and all arguments
+                          following it are passed, unparsed, as remaining
+                          arguments to the command instead of generating
+                          an error (optional)
+    hide-inherited-groups: when specified on a command struct field, the
+                          option groups of parent commands are not shown in
+                          the help of the command (optional)
     alias:                when specified on a command struct field, adds the
                           specified name as an alias for the command. Can be
                           be specified multiple times to add more than one
@@ -169,7 +353,14 @@ the global parser.
 
 When parsing ends and there is an active command and that command implements
 the Commander interface, then its Execute method will be run with the
-remaining command line arguments.
+remaining command line arguments. Commands which need more than the
+arguments can implement CommanderContext, to be executed with the context of
+the parser (see Parser.Context), or CommanderParser, to be executed with the
+parser itself. The interfaces are checked in this order of precedence:
+CommanderParser, CommanderContext and finally Commander. Since they all
+consist of a method named Execute, a command implements at most one of
+them. Setting Parser.DeferExecute disables this, the active command can
+then be run later using Parser.RunActiveCommand.
 
 Command structs can have options which become valid to parse after the
 command has been specified on the command line. It is currently not valid
@@ -199,7 +390,15 @@ therefore:
 
 where `completion-example` is the binary, `arg1` and `arg2` are
 the current arguments, and `arg3` (the last argument) is the argument
-to be completed.
+to be completed. The `__complete` command is hidden from the help. It
+accepts a --cursor option specifying the index of the argument to be
+completed (arguments following it are ignored), and a --tab-separated
+option which outputs each completion item followed by a tab and its
+description, one per line, and a --value-suffix option which appends the
+name/argument delimiter (e.g. =) to completed long options which require a
+value. This makes it simple to use the completion command from completion
+scripts of any shell. A bash completion script using the completion command
+can be generated using Parser.WriteBashCompletion.
 
 To use this with bash completion, a simple file can be written which
 calls the binary which supports go-flags completion:
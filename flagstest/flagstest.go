@@ -0,0 +1,111 @@
+// Package flagstest provides helpers for testing applications which use the
+// flags package to parse their command line options.
+//
+// A typical test parses a set of arguments into the options struct of the
+// application and checks the resulting values:
+//
+//	var opts Options
+//
+//	rest := flagstest.MustParse(&opts, "-v", "file")
+//
+// Errors can be checked using ParseTest, which returns the error as a
+// *flags.Error so that its type can be compared directly:
+//
+//	_, err := flagstest.ParseTest(&opts, "--unknown")
+//
+//	if err == nil || err.Type != flags.ErrUnknownFlag {
+//	    t.Errorf("expected unknown flag error, got %v", err)
+//	}
+//
+// Tests of environment variable defaults can use SetEnv to change the
+// environment and restore it afterwards.
+package flagstest
+
+import (
+	"os"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+)
+
+// Options are the parser options used by MustParse and ParseTest. They equal
+// flags.Default, except that errors are not printed.
+const Options = flags.Default &^ flags.PrintErrors
+
+// MustParse parses args into the options of data (see flags.NewParser)
+// and returns the remaining arguments. MustParse panics if the arguments
+// cannot be parsed.
+func MustParse(data interface{}, args ...string) []string {
+	ret, err := flags.NewParser(data, Options).ParseArgs(args)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return ret
+}
+
+// ParseTest parses args into the options of data (see flags.NewParser) and
+// returns the remaining arguments and the error, if any. Errors which are
+// not of type *flags.Error (e.g. errors returned from the Execute method of
+// a command) are returned with type flags.ErrUnknown.
+func ParseTest(data interface{}, args ...string) ([]string, *flags.Error) {
+	ret, err := flags.NewParser(data, Options).ParseArgs(args)
+
+	if err == nil {
+		return ret, nil
+	}
+
+	if e, ok := err.(*flags.Error); ok {
+		return ret, e
+	}
+
+	return ret, &flags.Error{
+		Type:    flags.ErrUnknown,
+		Message: err.Error(),
+	}
+}
+
+// EnvSnapshot is a snapshot of the environment variables of the process.
+type EnvSnapshot struct {
+	env map[string]string
+}
+
+// NewEnvSnapshot creates a snapshot of the current environment.
+func NewEnvSnapshot() *EnvSnapshot {
+	ret := &EnvSnapshot{
+		env: make(map[string]string),
+	}
+
+	for _, v := range os.Environ() {
+		parts := strings.SplitN(v, "=", 2)
+
+		if len(parts) == 2 {
+			ret.env[parts[0]] = parts[1]
+		}
+	}
+
+	return ret
+}
+
+// SetEnv sets the given environment variables and returns a snapshot of the
+// environment from before they were set. The snapshot is typically restored
+// using a deferred call to Restore.
+func SetEnv(env map[string]string) *EnvSnapshot {
+	ret := NewEnvSnapshot()
+
+	for k, v := range env {
+		os.Setenv(k, v)
+	}
+
+	return ret
+}
+
+// Restore restores the environment to the state of the snapshot.
+func (e *EnvSnapshot) Restore() {
+	os.Clearenv()
+
+	for k, v := range e.env {
+		os.Setenv(k, v)
+	}
+}
@@ -0,0 +1,103 @@
+package flagstest
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/jessevdk/go-flags"
+)
+
+type testCommand struct {
+}
+
+func (c *testCommand) Execute(args []string) error {
+	return errors.New("command failed")
+}
+
+func TestMustParse(t *testing.T) {
+	var opts struct {
+		Verbose bool   `short:"v"`
+		Name    string `long:"name"`
+	}
+
+	ret := MustParse(&opts, "-v", "--name", "test", "rest")
+
+	if !opts.Verbose {
+		t.Errorf("Expected Verbose to be true")
+	}
+
+	if opts.Name != "test" {
+		t.Errorf("Expected Name to be \"test\" but got %q", opts.Name)
+	}
+
+	if len(ret) != 1 || ret[0] != "rest" {
+		t.Errorf("Expected remaining arguments [rest] but got %v", ret)
+	}
+}
+
+func TestMustParsePanics(t *testing.T) {
+	var opts struct {
+		Verbose bool `short:"v"`
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected MustParse to panic")
+		}
+	}()
+
+	MustParse(&opts, "--unknown")
+}
+
+func TestParseTest(t *testing.T) {
+	var opts struct {
+		Verbose bool `short:"v"`
+	}
+
+	_, err := ParseTest(&opts, "--unknown")
+
+	if err == nil || err.Type != flags.ErrUnknownFlag {
+		t.Fatalf("Expected unknown flag error but got %v", err)
+	}
+
+	var cmdopts struct {
+		Command testCommand `command:"cmd"`
+	}
+
+	_, err = ParseTest(&cmdopts, "cmd")
+
+	if err == nil || err.Type != flags.ErrUnknown || err.Message != "command failed" {
+		t.Fatalf("Expected command error but got %v", err)
+	}
+
+	if _, err = ParseTest(&opts, "-v"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestSetEnv(t *testing.T) {
+	os.Setenv("FLAGSTEST_VALUE", "before")
+
+	var opts struct {
+		Value string `long:"value" env:"FLAGSTEST_VALUE"`
+	}
+
+	snapshot := SetEnv(map[string]string{
+		"FLAGSTEST_VALUE": "during",
+	})
+
+	MustParse(&opts)
+
+	snapshot.Restore()
+
+	if opts.Value != "during" {
+		t.Errorf("Expected Value to be \"during\" but got %q", opts.Value)
+	}
+
+	if v := os.Getenv("FLAGSTEST_VALUE"); v != "before" {
+		t.Errorf("Expected environment to be restored but got %q", v)
+	}
+
+	os.Unsetenv("FLAGSTEST_VALUE")
+}
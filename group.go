@@ -6,6 +6,7 @@ package flags
 
 import (
 	"errors"
+	"reflect"
 	"strings"
 )
 
@@ -14,6 +15,10 @@ import (
 // for options.
 var ErrNotPointerToStruct = errors.New("provided data is not a pointer to struct")
 
+// ErrNotPointer indicates that a provided value is not a (non-nil) pointer.
+// Only pointers are valid values for options added with AddOption.
+var ErrNotPointer = errors.New("provided value is not a pointer")
+
 // Group represents an option group. Option groups can be used to logically
 // group options together under a description. Groups are only used to provide
 // more structure to options both for the user (as displayed in the help message)
@@ -32,6 +37,21 @@ type Group struct {
 	// The namespace of the group
 	Namespace string
 
+	// The environment namespace of the group. It is prepended to the env
+	// key of every option in the group and its subgroups
+	EnvNamespace string
+
+	// The prefix of the group (see Command.AddGroupPrefixed). It is
+	// prepended, separated by a dash, to the long name of every option in
+	// the group and its subgroups, and separated by an underscore to their
+	// env keys
+	Prefix string
+
+	// If true, the group and its options are not shown in the help, man
+	// page or completions (see also Parser.ShowHidden). The options of the
+	// group can still be specified on the command line.
+	Hidden bool
+
 	// The parent of the group or nil if it has no parent
 	parent interface{}
 
@@ -44,6 +64,9 @@ type Group struct {
 	// Whether the group represents the built-in help group
 	isBuiltinHelp bool
 
+	// Whether the group is the default group created by NewParser
+	isDefault bool
+
 	data interface{}
 }
 
@@ -63,6 +86,86 @@ func (g *Group) AddGroup(shortDescription string, longDescription string, data i
 	return group, nil
 }
 
+// AddOption adds a new option to the group with the given short name, long
+// name and description. The value needs to be a pointer to the value which
+// the option represents, in the same way as a struct field would for options
+// declared using struct tags. The added option takes part in parsing, help
+// and ini files just like options declared using struct tags. Other
+// properties of the option (e.g. Default or Required) can be set on the
+// returned option.
+func (g *Group) AddOption(shortName rune, longName string, description string, value interface{}) (*Option, error) {
+	ptrval := reflect.ValueOf(value)
+
+	if ptrval.Kind() != reflect.Ptr || ptrval.IsNil() {
+		return nil, ErrNotPointer
+	}
+
+	if shortName == 0 && len(longName) == 0 {
+		return nil, newError(ErrTag, "either a short or a long name needs to be specified")
+	}
+
+	if shortName != 0 {
+		if err := validateShortName(shortName); err != nil {
+			return nil, err
+		}
+	}
+
+	name := longName
+
+	if len(name) == 0 {
+		name = string(shortName)
+	}
+
+	realval := ptrval.Elem()
+
+	option := &Option{
+		Description: description,
+		ShortName:   shortName,
+		LongName:    longName,
+
+		group: g,
+
+		field: reflect.StructField{
+			Name: name,
+			Type: realval.Type(),
+		},
+		value: realval,
+		tag:   newMultiTag(""),
+	}
+
+	g.options = append(g.options, option)
+
+	if err := g.checkForDuplicateFlags(); err != nil {
+		g.options = g.options[:len(g.options)-1]
+		return nil, err
+	}
+
+	return option, nil
+}
+
+// RemoveOption removes an option from the group. The removed option is no
+// longer parsed or shown in the help. An error of type ErrUnknownFlag is
+// returned if the option does not belong to the group, and an error of type
+// ErrRequired if the option is required by a command (see Command.Require).
+func (g *Group) RemoveOption(option *Option) error {
+	for i, opt := range g.options {
+		if opt == option {
+			if p := g.parser(); p != nil {
+				if err := p.checkRequiredBy([]*Option{option}); err != nil {
+					return err
+				}
+			}
+
+			g.options = append(g.options[:i], g.options[i+1:]...)
+			option.group = nil
+
+			return nil
+		}
+	}
+
+	return newErrorf(ErrUnknownFlag, "option `%s' does not belong to group `%s'", option, g.ShortDescription)
+}
+
 // Groups returns the list of groups embedded in this group.
 func (g *Group) Groups() []*Group {
 	return g.groups
@@ -73,6 +176,41 @@ func (g *Group) Options() []*Option {
 	return g.options
 }
 
+// SetDefaultFunc sets a function computing the default value of the option
+// represented by the struct field with the given name. The function is called
+// at parse time when no value for the option is specified on the command line,
+// in an ini file or through its environment variable, and when the option has
+// no default tag. An error is returned if the group has no option for the
+// given field.
+func (g *Group) SetDefaultFunc(field string, f func() string) error {
+	for _, option := range g.options {
+		if option.field.Name == field {
+			option.defaultFunc = f
+			return nil
+		}
+	}
+
+	return newErrorf(ErrUnknownFlag, "unknown option field `%s'", field)
+}
+
+// SetDefaultFormatter sets a function used to format the default value of
+// the option for the struct field with the given name when it is shown in the
+// help, e.g. to show a bitmask as a list of flag names. The function receives
+// the default value of the option (of the type of the field) and only changes
+// how the default is displayed, not the default itself. The default-mask tag
+// takes precedence over the formatter. An error is returned if the group has
+// no option for the field.
+func (g *Group) SetDefaultFormatter(field string, f func(value interface{}) string) error {
+	for _, option := range g.options {
+		if option.field.Name == field {
+			option.defaultFormatter = f
+			return nil
+		}
+	}
+
+	return newErrorf(ErrUnknownFlag, "unknown option field `%s'", field)
+}
+
 // Find locates the subgroup with the given short description and returns it.
 // If no such group can be found Find will return nil. Note that the description
 // is matched case insensitively.
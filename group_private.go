@@ -2,6 +2,8 @@ package flags
 
 import (
 	"reflect"
+	"strings"
+	"unicode"
 	"unicode/utf8"
 	"unsafe"
 )
@@ -46,6 +48,36 @@ func (g *Group) optionByName(name string, namematch func(*Option, string) bool)
 	return retopt
 }
 
+// isIgnoredField returns whether a struct field is skipped entirely when
+// scanning the options, commands and arguments, because it has the no-flag
+// tag or flags:"-".
+func isIgnoredField(mtag multiTag) bool {
+	return mtag.Get("no-flag") != "" || mtag.Get("flags") == "-"
+}
+
+func (g *Group) parentGroup() *Group {
+	switch i := g.parent.(type) {
+	case *Command:
+		return i.Group
+	case *Group:
+		return i
+	}
+
+	return nil
+}
+
+func (g *Group) parser() *Parser {
+	for g != nil {
+		if p, ok := g.parent.(*Parser); ok {
+			return p
+		}
+
+		g = g.parentGroup()
+	}
+
+	return nil
+}
+
 func (g *Group) eachGroup(f func(*Group)) {
 	f(g)
 
@@ -68,8 +100,10 @@ func (g *Group) scanStruct(realval reflect.Value, sfield *reflect.StructField, h
 	for i := 0; i < stype.NumField(); i++ {
 		field := stype.Field(i)
 
-		// PkgName is set only for non-exported fields, which we ignore
-		if field.PkgPath != "" {
+		// PkgName is set only for non-exported fields, which we ignore,
+		// except for embedded structs of unexported types, whose exported
+		// fields are promoted to the embedding struct
+		if field.PkgPath != "" && !(field.Anonymous && field.Type.Kind() == reflect.Struct) {
 			continue
 		}
 
@@ -80,7 +114,7 @@ func (g *Group) scanStruct(realval reflect.Value, sfield *reflect.StructField, h
 		}
 
 		// Skip fields with the no-flag tag
-		if mtag.Get("no-flag") != "" {
+		if isIgnoredField(mtag) {
 			continue
 		}
 
@@ -105,11 +139,19 @@ func (g *Group) scanStruct(realval reflect.Value, sfield *reflect.StructField, h
 		longname := mtag.Get("long")
 		shortname := mtag.Get("short")
 
+		envOnly := mtag.Get("env-only") != ""
+
 		// Need at least either a short or long name
-		if longname == "" && shortname == "" && mtag.Get("ini-name") == "" {
+		if longname == "" && shortname == "" && mtag.Get("ini-name") == "" && !envOnly {
 			continue
 		}
 
+		if envOnly && mtag.Get("env") == "" {
+			return newErrorf(ErrTag,
+				"env-only option for field `%s' has no env key",
+				field.Name)
+		}
+
 		short := rune(0)
 		rc := utf8.RuneCountInString(shortname)
 
@@ -120,6 +162,10 @@ func (g *Group) scanStruct(realval reflect.Value, sfield *reflect.StructField, h
 
 		} else if rc == 1 {
 			short, _ = utf8.DecodeRuneInString(shortname)
+
+			if err := validateShortName(short); err != nil {
+				return err
+			}
 		}
 
 		description := mtag.Get("description")
@@ -127,9 +173,11 @@ func (g *Group) scanStruct(realval reflect.Value, sfield *reflect.StructField, h
 		optionalValue := mtag.GetMany("optional-value")
 		valueName := mtag.Get("value-name")
 		defaultMask := mtag.Get("default-mask")
+		choices := splitChoices(mtag.GetMany("choice"), mtag.GetMany("choice-sep"))
 
 		optional := (mtag.Get("optional") != "")
 		required := (mtag.Get("required") != "")
+		hidden := (mtag.Get("hidden") != "")
 
 		option := &Option{
 			Description:      description,
@@ -139,16 +187,148 @@ func (g *Group) scanStruct(realval reflect.Value, sfield *reflect.StructField, h
 			OptionalArgument: optional,
 			OptionalValue:    optionalValue,
 			Required:         required,
+			Hidden:           hidden,
 			ValueName:        valueName,
 			DefaultMask:      defaultMask,
+			EnvDefaultKey:    mtag.Get("env"),
+			EnvAliasKeys:     mtag.GetMany("env-alias"),
+			EnvDefaultDelim:  mtag.Get("env-delim"),
 
-			group: g,
+			group:   g,
+			choices: choices,
 
 			field: field,
 			value: realval.Field(i),
 			tag:   mtag,
 		}
 
+		if len(option.EnvAliasKeys) != 0 && len(option.EnvDefaultKey) == 0 {
+			return newErrorf(ErrTag,
+				"option `%s' has an env-alias but no env",
+				option)
+		}
+
+		if aliasesTag := mtag.Get("aliases"); len(aliasesTag) != 0 {
+			aliases, ok := parseValueAliases(aliasesTag)
+
+			if !ok {
+				return newErrorf(ErrTag,
+					"invalid aliases `%s' for option `%s' (expected alias=value pairs separated by commas)",
+					aliasesTag, option)
+			}
+
+			option.valueAliases = aliases
+		}
+
+		if bitsTag := mtag.Get("bits"); len(bitsTag) != 0 {
+			bits, ok := parseBits(bitsTag)
+
+			if !ok {
+				return newErrorf(ErrTag,
+					"invalid bits `%s' for option `%s' (expected name=value pairs separated by commas)",
+					bitsTag, option)
+			}
+
+			switch option.value.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			default:
+				return newErrorf(ErrTag,
+					"option `%s' has bits but is not an integer",
+					option)
+			}
+
+			if len(option.choices) != 0 {
+				return newErrorf(ErrTag,
+					"option `%s' cannot have both bits and choices",
+					option)
+			}
+
+			for _, bit := range bits {
+				option.choices = append(option.choices, bit.name)
+			}
+		}
+
+		if unitTag := mtag.Get("unit"); len(unitTag) != 0 {
+			if _, ok := parseUnits(unitTag); !ok {
+				return newErrorf(ErrTag,
+					"invalid unit `%s' for option `%s' (expected unit suffixes separated by commas, with a factor for all but the base unit, e.g. ms,s=1000)",
+					unitTag, option)
+			}
+
+			switch option.unitKind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+				reflect.Float32, reflect.Float64:
+			default:
+				return newErrorf(ErrTag,
+					"option `%s' has a unit but is not a number",
+					option)
+			}
+		}
+
+		if format := mtag.Get("env-format"); len(format) != 0 {
+			if format != "json" {
+				return newErrorf(ErrTag,
+					"invalid env-format `%s' for option `%s' (expected json)",
+					format, option)
+			}
+
+			if kind := option.value.Kind(); kind != reflect.Slice && kind != reflect.Map {
+				return newErrorf(ErrTag,
+					"option `%s' has an env-format but is not a slice or map",
+					option)
+			}
+		}
+
+		if option.isShortCircuit() && !option.isBool() && !option.isFunc() {
+			return newErrorf(ErrTag,
+				"option `%s' is short-circuit but is not a bool or func",
+				option)
+		}
+
+		if option.hasBoolValue() && (!option.isBool() || option.isFunc()) {
+			return newErrorf(ErrTag,
+				"option `%s' has a bool-value but is not a bool",
+				option)
+		}
+
+		if mustExist := mtag.Get("must-exist"); len(mustExist) != 0 && mustExist != "file" && mustExist != "dir" {
+			return newErrorf(ErrTag,
+				"invalid must-exist value `%s' for option `%s' (expected file or dir)",
+				mustExist, option)
+		}
+
+		if len(mtag.Get("unique")) != 0 && option.value.Kind() != reflect.Slice {
+			return newErrorf(ErrTag,
+				"option `%s' is unique but is not a slice",
+				option)
+		}
+
+		if len(mtag.Get("dedup")) != 0 && option.value.Kind() != reflect.Slice {
+			return newErrorf(ErrTag,
+				"option `%s' is dedup but is not a slice",
+				option)
+		}
+
+		if len(mtag.Get("sentinel")) != 0 && option.value.Type() != optDurationType {
+			return newErrorf(ErrTag,
+				"option `%s' has sentinels but is not an OptDuration",
+				option)
+		}
+
+		if option.slurps() && option.value.Kind() != reflect.Slice {
+			return newErrorf(ErrTag,
+				"option `%s' slurps arguments but is not a slice",
+				option)
+		}
+
+		if option.consumesRest() && option.value.Kind() != reflect.Slice {
+			return newErrorf(ErrTag,
+				"option `%s' consumes the remaining arguments but is not a slice",
+				option)
+		}
+
 		g.options = append(g.options, option)
 	}
 
@@ -204,6 +384,8 @@ func (g *Group) scanSubGroupHandler(realval reflect.Value, sfield *reflect.Struc
 		}
 
 		group.Namespace = mtag.Get("namespace")
+		group.EnvNamespace = mtag.Get("env-namespace")
+		group.Hidden = (mtag.Get("hidden") != "")
 
 		return true, nil
 	}
@@ -249,3 +431,42 @@ func (g *Group) groupByName(name string) *Group {
 
 	return g.Find(name)
 }
+
+// validateShortName checks whether the rune can be used as the short name of
+// an option. Any printable rune (including digits and non-ASCII runes) can be
+// used, except for white space and runes which have a special meaning on the
+// command line (option prefixes and name/argument delimiters).
+func validateShortName(short rune) error {
+	if short == utf8.RuneError || !unicode.IsPrint(short) || unicode.IsSpace(short) ||
+		short == '-' || short == '=' ||
+		short == defaultShortOptDelimiter || short == defaultNameArgDelimiter {
+		return newErrorf(ErrTag, "invalid short name `%s'", string(short))
+	}
+
+	return nil
+}
+
+// splitChoices splits the values of the choice tag into individual choices.
+// A single choice tag is split on commas, unless a separator was specified
+// using the choice-sep tag, in which case all choice tags are split on the
+// separator. Multiple choice tags without a separator are not split, which
+// allows choices containing commas.
+func splitChoices(choices []string, sep []string) []string {
+	if len(sep) == 0 {
+		if len(choices) != 1 {
+			return choices
+		}
+
+		sep = []string{","}
+	}
+
+	var ret []string
+
+	for _, choice := range choices {
+		for _, c := range strings.Split(choice, sep[0]) {
+			ret = append(ret, strings.TrimSpace(c))
+		}
+	}
+
+	return ret
+}
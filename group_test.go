@@ -1,6 +1,12 @@
 package flags
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -185,3 +191,364 @@ func TestDuplicateLongFlags(t *testing.T) {
 		}
 	}
 }
+
+func TestAddOption(t *testing.T) {
+	var opts struct {
+		Verbose bool `short:"v" long:"verbose" description:"Show verbose debug information"`
+	}
+
+	p := NewNamedParser("TestAddOption", None)
+	g, err := p.AddGroup("Application Options", "The application options", &opts)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var name string
+	var count int
+	var plugins []string
+
+	nameopt, err := g.AddOption('n', "name", "The name", &name)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	nameopt.Default = []string{"default"}
+
+	if _, err := g.AddOption(0, "count", "The count", &count); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := g.AddOption('p', "", "A plugin", &plugins); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ret, err := p.ParseArgs([]string{"-v", "--count", "3", "-p", "a", "-p", "b", "rest"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertStringArray(t, ret, []string{"rest"})
+
+	if !opts.Verbose {
+		t.Errorf("Expected Verbose to be true")
+	}
+
+	assertString(t, name, "default")
+	assertStringArray(t, plugins, []string{"a", "b"})
+
+	if count != 3 {
+		t.Errorf("Expected count to be 3, but got %d", count)
+	}
+
+	var buf bytes.Buffer
+	p.WriteHelp(&buf)
+
+	if !strings.Contains(buf.String(), "The name (default)") {
+		t.Errorf("Expected added option in help, but got:\n%s", buf.String())
+	}
+
+	inip := NewIniParser(p)
+
+	if err := inip.Parse(strings.NewReader("name = ini\ncount = 5\n")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertString(t, name, "ini")
+
+	if count != 5 {
+		t.Errorf("Expected count to be 5, but got %d", count)
+	}
+}
+
+func TestAddOptionInvalid(t *testing.T) {
+	var opts struct {
+		Verbose bool `short:"v" long:"verbose"`
+	}
+
+	p := NewNamedParser("TestAddOption", None)
+	g, _ := p.AddGroup("Application Options", "The application options", &opts)
+
+	var value string
+
+	if _, err := g.AddOption('x', "x", "", value); err != ErrNotPointer {
+		t.Errorf("Expected ErrNotPointer, but got %v", err)
+	}
+
+	_, err := g.AddOption(0, "", "", &value)
+	assertError(t, err, ErrTag, "either a short or a long name needs to be specified")
+
+	_, err = g.AddOption('v', "value", "", &value)
+	assertError(t, err, ErrDuplicatedFlag, "option `-v, --value' uses the same short name as option `-v, --verbose'")
+
+	if len(g.Options()) != 1 {
+		t.Errorf("Expected 1 option, but got %d", len(g.Options()))
+	}
+}
+
+func TestRemoveGroup(t *testing.T) {
+	var opts struct {
+		Verbose bool `short:"v" long:"verbose" description:"Show verbose debug information"`
+
+		Plugin struct {
+			Value string `long:"plugin-value" description:"A plugin value"`
+		} `group:"Plugin Options"`
+
+		Command struct {
+			Extra struct {
+				Force bool `long:"force"`
+			} `group:"Extra Options"`
+		} `command:"cmd"`
+	}
+
+	p := NewNamedParser("TestRemoveGroup", None)
+	g, _ := p.AddGroup("Application Options", "The application options", &opts)
+
+	plugin := g.Find("Plugin Options")
+
+	if err := p.RemoveGroup(plugin); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if g.Find("Plugin Options") != nil {
+		t.Errorf("Expected group to be removed")
+	}
+
+	var buf bytes.Buffer
+	p.WriteHelp(&buf)
+
+	if strings.Contains(buf.String(), "plugin-value") {
+		t.Errorf("Expected removed group not to be shown in help, but got:\n%s", buf.String())
+	}
+
+	_, err := p.ParseArgs([]string{"--plugin-value", "x"})
+	assertError(t, err, ErrUnknownFlag, "unknown flag `plugin-value'")
+
+	extra := p.Find("cmd").Group.Find("Extra Options")
+
+	if err := p.RemoveGroup(extra); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, err = p.ParseArgs([]string{"cmd", "--force"})
+	assertError(t, err, ErrUnknownFlag, "unknown flag `force'")
+
+	err = p.RemoveGroup(plugin)
+	assertError(t, err, ErrUnknownGroup, "group `Plugin Options' does not belong to the parser")
+}
+
+func TestRemoveGroupRequired(t *testing.T) {
+	var opts struct {
+		Remote struct {
+			Auth struct {
+				Token string `long:"token"`
+			} `group:"Auth Options"`
+		} `group:"Remote Options"`
+
+		Push struct{} `command:"push"`
+	}
+
+	p := NewParser(&opts, None)
+
+	if err := p.Find("push").Require("token"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	remote := p.Groups()[0].Find("Remote Options")
+
+	err := p.RemoveGroup(remote)
+	assertError(t, err, ErrRequired, fmt.Sprintf("option `%stoken' is required by the `push' command", defaultLongOptDelimiter))
+
+	if p.Groups()[0].Find("Remote Options") == nil {
+		t.Errorf("Expected required group not to be removed")
+	}
+}
+
+func TestRemoveOption(t *testing.T) {
+	var opts struct {
+		Verbose bool   `short:"v" long:"verbose" description:"Show verbose debug information"`
+		Value   string `long:"value" description:"A value"`
+	}
+
+	p := NewNamedParser("TestRemoveOption", None)
+	g, _ := p.AddGroup("Application Options", "The application options", &opts)
+
+	value := g.Options()[1]
+
+	if err := g.RemoveOption(value); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(g.Options()) != 1 {
+		t.Errorf("Expected 1 option, but got %d", len(g.Options()))
+	}
+
+	_, err := p.ParseArgs([]string{"--value", "x"})
+	assertError(t, err, ErrUnknownFlag, "unknown flag `value'")
+
+	err = g.RemoveOption(value)
+	assertError(t, err, ErrUnknownFlag, "option `--value' does not belong to group `Application Options'")
+}
+
+func TestRemoveOptionRequired(t *testing.T) {
+	var opts struct {
+		Value string `long:"value"`
+
+		Command struct {
+			Sub struct{} `command:"sub"`
+		} `command:"cmd"`
+	}
+
+	p := NewParser(&opts, None)
+
+	if err := p.Find("cmd").Find("sub").Require("value"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	g := p.Groups()[0]
+	value := g.Options()[0]
+
+	err := g.RemoveOption(value)
+	assertError(t, err, ErrRequired, fmt.Sprintf("option `%svalue' is required by the `sub' command", defaultLongOptDelimiter))
+
+	if len(g.Options()) != 1 {
+		t.Errorf("Expected required option not to be removed")
+	}
+}
+
+func TestAddGroupPrefixed(t *testing.T) {
+	type connection struct {
+		Host string `long:"host" env:"HOST"`
+		Port int    `long:"port" default:"22"`
+
+		TLS struct {
+			Cert string `long:"cert"`
+		} `group:"TLS" namespace:"tls"`
+	}
+
+	var src, dst connection
+
+	oldEnv := NewEnvSnapshot()
+	defer oldEnv.Restore()
+
+	os.Setenv("dst_HOST", "remote")
+
+	p := NewNamedParser("test", HelpFlag)
+
+	if _, err := p.AddGroupPrefixed("Source", "", "src", &src); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	dstgrp, err := p.AddGroupPrefixed("Destination", "", "dst", &dst)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ret, err := p.ParseArgs([]string{"--src-host", "local", "--dst-port", "23", "--src-tls.cert", "a.pem"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertStringArray(t, ret, []string{})
+
+	assertString(t, src.Host, "local")
+	assertString(t, dst.Host, "remote")
+	assertString(t, src.TLS.Cert, "a.pem")
+	assertString(t, dst.TLS.Cert, "")
+
+	if src.Port != 22 || dst.Port != 23 {
+		t.Errorf("Expected ports 22 and 23 but got %d and %d", src.Port, dst.Port)
+	}
+
+	opt := dstgrp.Options()[0]
+
+	assertString(t, opt.LongNameWithNamespace(), "dst-host")
+	assertString(t, opt.EnvKeyWithNamespace(), "dst_HOST")
+
+	var invalid struct {
+		Port string `long:"port" bits:"low=1"`
+	}
+
+	_, err = p.AddGroupPrefixed("Invalid", "", "inv", &invalid)
+	assertError(t, err, ErrTag, "option `--inv-port' has bits but is not an integer")
+}
+
+func TestOptionValueParser(t *testing.T) {
+	type endpoint struct {
+		Host string
+		Port int
+	}
+
+	p := NewNamedParser("TestOptionValueParser", None)
+	g, err := p.AddGroup("Application Options", "The application options", &struct{}{})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var routes map[string]string
+	var endpoints []endpoint
+	var primary endpoint
+
+	parseRoute := func(raw string) (interface{}, error) {
+		parts := strings.SplitN(raw, "->", 2)
+
+		if len(parts) != 2 {
+			return nil, errors.New("expected path -> backend")
+		}
+
+		return map[string]string{strings.TrimSpace(parts[0]): strings.TrimSpace(parts[1])}, nil
+	}
+
+	parseEndpoint := func(raw string) (interface{}, error) {
+		var e endpoint
+
+		if _, err := fmt.Sscanf(strings.Replace(raw, ":", " ", 1), "%s %d", &e.Host, &e.Port); err != nil {
+			return nil, err
+		}
+
+		return e, nil
+	}
+
+	route, _ := g.AddOption('r', "route", "A route", &routes)
+	route.SetValueParser(parseRoute)
+
+	ep, _ := g.AddOption(0, "endpoint", "An endpoint", &endpoints)
+	ep.SetValueParser(parseEndpoint)
+
+	pr, _ := g.AddOption(0, "primary", "The primary endpoint", &primary)
+	pr.SetValueParser(parseEndpoint)
+	pr.Default = []string{"localhost:80"}
+
+	_, err = p.ParseArgs([]string{"--route=/api -> backend:8080", "-r", "/ -> web:80", "--endpoint", "a:1", "--endpoint", "b:2"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(routes, map[string]string{"/api": "backend:8080", "/": "web:80"}) {
+		t.Errorf("Unexpected routes %v", routes)
+	}
+
+	if !reflect.DeepEqual(endpoints, []endpoint{{"a", 1}, {"b", 2}}) {
+		t.Errorf("Unexpected endpoints %v", endpoints)
+	}
+
+	if primary != (endpoint{"localhost", 80}) {
+		t.Errorf("Unexpected primary endpoint %v", primary)
+	}
+
+	_, err = p.ParseArgs([]string{"--route", "/api"})
+	assertError(t, err, ErrMarshal, "invalid argument for flag `-r, --route' (expected map[string]string): expected path -> backend")
+
+	route.SetValueParser(func(raw string) (interface{}, error) {
+		return raw, nil
+	})
+
+	_, err = p.ParseArgs([]string{"--route", "/api"})
+	assertError(t, err, ErrMarshal, "value parser of flag `-r, --route' returned string (expected map[string]string)")
+}
@@ -9,17 +9,97 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
 	"strings"
 	"unicode/utf8"
 )
 
+// Messages contains the strings used by WriteHelp for the usage line and the
+// section headers of the help message. Empty fields use the English default
+// shown in their documentation. This allows the help message to be
+// localized.
+type Messages struct {
+	// The header of the usage line ("Usage")
+	Usage string
+
+	// The header of the default option group created by NewParser
+	// ("Application Options")
+	ApplicationOptions string
+
+	// The header of the built-in help option group ("Help Options")
+	HelpOptions string
+
+	// The header of the list of subcommands ("Available commands")
+	AvailableCommands string
+
+	// The header of the required options, when they are listed separately
+	// (see Parser.GroupRequiredFirst) ("Required")
+	Required string
+
+	// The header of the positional arguments ("Arguments")
+	Arguments string
+
+	// The header of the options of a command. The first %s is replaced by
+	// the command name ("[%s command options]")
+	CommandOptions string
+
+	// The header of the positional arguments of a command. The first %s is
+	// replaced by the command name ("[%s command arguments]")
+	CommandArguments string
+}
+
+// HelpStyle determines how the options are laid out in the help message (see
+// Parser.HelpStyle).
+type HelpStyle uint
+
+const (
+	// HelpStyleFull shows the options in aligned columns, wrapping their
+	// descriptions at the terminal width. This is the default.
+	HelpStyleFull HelpStyle = iota
+
+	// HelpStyleCompact shows each option on a single line, as its long
+	// name, short name and value name (e.g. --output, -o  FILE) followed
+	// by its description, without aligning the descriptions. Descriptions
+	// which do not fit the terminal width are truncated with an ellipsis.
+	HelpStyleCompact
+)
+
+// DefaultHelpWidth is the width (in columns) to which the help message is
+// wrapped when it is not written to a terminal (e.g. when it is piped to
+// another program or written to a buffer) and Parser.HelpWidth is not set.
+const DefaultHelpWidth = 80
+
+func message(value string, def string) string {
+	if len(value) != 0 {
+		return value
+	}
+
+	return def
+}
+
+func (p *Parser) groupHeader(grp *Group) string {
+	if grp.isBuiltinHelp {
+		return message(p.Messages.HelpOptions, grp.ShortDescription)
+	}
+
+	if grp.isDefault {
+		return message(p.Messages.ApplicationOptions, grp.ShortDescription)
+	}
+
+	return grp.ShortDescription
+}
+
 type alignmentInfo struct {
 	maxLongLen      int
 	hasShort        bool
 	hasValueName    bool
 	terminalColumns int
 	indent          bool
+	maxNameLen      int
+	showValues      bool
 }
 
 const (
@@ -45,41 +125,76 @@ func (a *alignmentInfo) descriptionStart() int {
 	return ret
 }
 
-func (a *alignmentInfo) updateLen(name string, indent bool) {
+func (a *alignmentInfo) nameLen(name string, indent bool) int {
 	l := utf8.RuneCountInString(name)
 
 	if indent {
 		l = l + 4
 	}
 
+	return l
+}
+
+func (a *alignmentInfo) exceedsMaxNameLen(name string, indent bool) bool {
+	return a.maxNameLen > 0 && a.nameLen(name, indent) > a.maxNameLen
+}
+
+func (a *alignmentInfo) updateLen(name string, indent bool) {
+	l := a.nameLen(name, indent)
+
+	// Names exceeding the maximum name length do not push the
+	// description column further to the right
+	if a.exceedsMaxNameLen(name, indent) {
+		return
+	}
+
 	if l > a.maxLongLen {
 		a.maxLongLen = l
 	}
 }
 
-func (p *Parser) getAlignmentInfo() alignmentInfo {
+// helpWidth returns the width to which the help message written to the
+// given writer is wrapped (see Parser.HelpWidth).
+func (p *Parser) helpWidth(writer io.Writer) int {
+	if p.HelpWidth > 0 {
+		return p.HelpWidth
+	}
+
+	if f, ok := writer.(*os.File); ok {
+		if columns := getTerminalColumns(f.Fd()); columns > 0 {
+			return columns
+		}
+	}
+
+	return DefaultHelpWidth
+}
+
+func (p *Parser) getAlignmentInfo(width int) alignmentInfo {
 	ret := alignmentInfo{
 		maxLongLen:      0,
 		hasShort:        false,
 		hasValueName:    false,
-		terminalColumns: getTerminalColumns(),
-	}
-
-	if ret.terminalColumns <= 0 {
-		ret.terminalColumns = 80
+		terminalColumns: width,
+		maxNameLen:      p.MaxNameColumn,
 	}
 
 	var prevcmd *Command
 
+	active := p.activeCommand()
+
 	p.eachActiveGroup(func(c *Command, grp *Group) {
 		if c != prevcmd {
 			for _, arg := range c.args {
-				ret.updateLen(arg.Name, c != p.Command)
+				ret.updateLen(arg.usageName(), c != p.Command)
 			}
 		}
 
+		if active.hidesInheritedGroup(c, grp) {
+			return
+		}
+
 		for _, info := range grp.options {
-			if !info.canCli() {
+			if !info.isVisible() {
 				continue
 			}
 
@@ -87,28 +202,20 @@ func (p *Parser) getAlignmentInfo() alignmentInfo {
 				ret.hasShort = true
 			}
 
-			if len(info.ValueName) > 0 {
+			valueName := info.helpValueName()
+
+			if len(valueName) > 0 {
 				ret.hasValueName = true
 			}
 
-			ret.updateLen(info.LongNameWithNamespace()+info.ValueName, c != p.Command)
+			ret.updateLen(info.LongNameWithNamespace()+valueName, c != p.Command)
 		}
 	})
 
 	return ret
 }
 
-func (p *Parser) writeHelpOption(writer *bufio.Writer, option *Option, info alignmentInfo) {
-	line := &bytes.Buffer{}
-
-	prefix := paddingBeforeOption
-
-	if info.indent {
-		prefix += 4
-	}
-
-	line.WriteString(strings.Repeat(" ", prefix))
-
+func (p *Parser) writeHelpOptionNames(line *bytes.Buffer, option *Option, info alignmentInfo) {
 	if option.ShortName != 0 {
 		line.WriteRune(defaultShortOptDelimiter)
 		line.WriteRune(option.ShortName)
@@ -116,8 +223,6 @@ func (p *Parser) writeHelpOption(writer *bufio.Writer, option *Option, info alig
 		line.WriteString("  ")
 	}
 
-	descstart := info.descriptionStart() + paddingBeforeOption
-
 	if len(option.LongName) > 0 {
 		if option.ShortName != 0 {
 			line.WriteString(", ")
@@ -132,63 +237,185 @@ func (p *Parser) writeHelpOption(writer *bufio.Writer, option *Option, info alig
 	if option.canArgument() {
 		line.WriteRune(defaultNameArgDelimiter)
 
-		if len(option.ValueName) > 0 {
-			line.WriteString(option.ValueName)
-		}
+		line.WriteString(option.helpValueName())
+	}
+}
+
+func (p *Parser) writeHelpOption(writer *bufio.Writer, option *Option, info alignmentInfo) {
+	if p.HelpStyle == HelpStyleCompact {
+		p.writeCompactHelpOption(writer, option, info)
+		return
+	}
+
+	line := &bytes.Buffer{}
+
+	prefix := paddingBeforeOption
+
+	if info.indent {
+		prefix += 4
+	}
+
+	line.WriteString(strings.Repeat(" ", prefix))
+
+	descstart := info.descriptionStart() + paddingBeforeOption
+
+	// Options which can only be set from the environment are shown
+	// without names, their env key is part of the description
+	if !option.isEnvOnly() {
+		p.writeHelpOptionNames(line, option, info)
 	}
 
 	written := line.Len()
 	line.WriteTo(writer)
 
-	if option.Description != "" {
+	showValue := info.showValues && !option.isFunc()
+
+	if description := option.description(); description != "" || showValue {
 		dw := descstart - written
+
+		// Start the description on the next line if the option name
+		// overflows the description column
+		if dw < 1 || info.exceedsMaxNameLen(option.LongNameWithNamespace()+option.helpValueName(), info.indent) {
+			writer.WriteString("\n")
+			dw = descstart
+		}
+
 		writer.WriteString(strings.Repeat(" ", dw))
 
-		def := ""
-		defs := option.Default
+		writer.WriteString(wrapText(option.helpDescription(description, showValue, p.EnvAnnotationFormat),
+			info.terminalColumns-descstart,
+			strings.Repeat(" ", descstart)))
+	}
 
-		if len(option.DefaultMask) != 0 {
-			if option.DefaultMask != "-" {
-				def = option.DefaultMask
-			}
-		} else if len(defs) == 0 && option.canArgument() {
-			var showdef bool
-
-			switch option.field.Type.Kind() {
-			case reflect.Func, reflect.Ptr:
-				showdef = !option.value.IsNil()
-			case reflect.Slice, reflect.String, reflect.Array:
-				showdef = option.value.Len() > 0
-			case reflect.Map:
-				showdef = !option.value.IsNil() && option.value.Len() > 0
-			default:
-				zeroval := reflect.Zero(option.field.Type)
-				showdef = !reflect.DeepEqual(zeroval.Interface(), option.value.Interface())
-			}
+	writer.WriteString("\n")
+}
 
-			if showdef {
-				def, _ = convertToString(option.value, option.tag)
-			}
-		} else if len(defs) != 0 {
-			def = strings.Join(defs, ", ")
+func (p *Parser) writeCompactHelpOption(writer *bufio.Writer, option *Option, info alignmentInfo) {
+	var names []string
+
+	// Options which can only be set from the environment are shown
+	// without names, their env key is part of the description
+	if !option.isEnvOnly() {
+		if len(option.LongName) != 0 {
+			names = append(names, defaultLongOptDelimiter+option.LongNameWithNamespace())
 		}
 
-		var desc string
+		if option.ShortName != 0 {
+			names = append(names, string(defaultShortOptDelimiter)+string(option.ShortName))
+		}
+	}
 
-		if def != "" {
-			desc = fmt.Sprintf("%s (%v)", option.Description, def)
-		} else {
-			desc = option.Description
+	prefix := paddingBeforeOption
+
+	if info.indent {
+		prefix += 4
+	}
+
+	line := strings.Repeat(" ", prefix) + strings.Join(names, ", ")
+
+	if option.canArgument() && !option.isEnvOnly() {
+		valueName := option.helpValueName()
+
+		if len(valueName) == 0 {
+			valueName = "VALUE"
 		}
 
-		writer.WriteString(wrapText(desc,
-			info.terminalColumns-descstart,
-			strings.Repeat(" ", descstart)))
+		line += "  " + valueName
 	}
 
+	showValue := info.showValues && !option.isFunc()
+
+	if description := option.description(); description != "" || showValue {
+		desc := strings.Join(strings.Fields(option.helpDescription(description, showValue, p.EnvAnnotationFormat)), " ")
+
+		if len(strings.TrimSpace(line)) != 0 {
+			line += "  "
+		}
+
+		line += truncateText(desc, info.terminalColumns-utf8.RuneCountInString(line))
+	}
+
+	writer.WriteString(line)
 	writer.WriteString("\n")
 }
 
+// truncateText truncates text to at most width runes, replacing the end of
+// the text with an ellipsis if it is truncated.
+func truncateText(text string, width int) string {
+	if utf8.RuneCountInString(text) <= width {
+		return text
+	}
+
+	if width < 1 {
+		return "…"
+	}
+
+	runes := []rune(text)
+	return string(runes[:width-1]) + "…"
+}
+
+// helpDescription returns the description of an option in the help message,
+// including its default value and env key. The env key is annotated using
+// envFormat, if not nil.
+func (option *Option) helpDescription(description string, showValue bool, envFormat func(opt *Option) string) string {
+	def := ""
+	defs := option.defaultValues()
+
+	if len(option.DefaultMask) != 0 {
+		if option.DefaultMask != "-" {
+			def = option.DefaultMask
+		}
+	} else if len(defs) == 0 && option.canArgument() && !option.isEnvOnly() && len(option.tag.Get("secret")) == 0 {
+		// The current value is shown as the default, unless it may be
+		// a resolved secret
+		var showdef bool
+
+		switch option.field.Type.Kind() {
+		case reflect.Func, reflect.Ptr:
+			showdef = !option.value.IsNil()
+		case reflect.Slice, reflect.String, reflect.Array:
+			showdef = option.value.Len() > 0
+		case reflect.Map:
+			showdef = !option.value.IsNil() && option.value.Len() > 0
+		default:
+			zeroval := reflect.Zero(option.field.Type)
+			showdef = !reflect.DeepEqual(zeroval.Interface(), option.value.Interface())
+		}
+
+		if showdef {
+			def, _ = convertToString(option.value, option.tag)
+		}
+	} else if len(defs) != 0 {
+		def = strings.Join(defs, ", ")
+	}
+
+	if def != "" && len(option.DefaultMask) == 0 && option.defaultFormatter != nil {
+		def = option.formatDefault(defs)
+	}
+
+	var desc string
+
+	if def != "" {
+		desc = fmt.Sprintf("%s (%v)", description, def)
+	} else {
+		desc = description
+	}
+
+	if envKey := option.EnvKeyWithNamespace(); len(envKey) != 0 {
+		if envFormat == nil {
+			desc = fmt.Sprintf("%s [$%s]", desc, envKey)
+		} else if annotation := envFormat(option); len(annotation) != 0 {
+			desc = strings.TrimLeft(fmt.Sprintf("%s %s", desc, annotation), " ")
+		}
+	}
+
+	if showValue {
+		desc = strings.TrimLeft(fmt.Sprintf("%s {current: %s, source: %s}", desc, option.effectiveValue(), option.source), " ")
+	}
+
+	return desc
+}
+
 func maxCommandLength(s []*Command) int {
 	if len(s) == 0 {
 		return 0
@@ -213,95 +440,37 @@ func maxCommandLength(s []*Command) int {
 // command line parser which will automatically show the help messages using
 // this method.
 func (p *Parser) WriteHelp(writer io.Writer) {
+	p.writeHelp(writer, false, p.helpWidth(writer))
+}
+
+// WriteHelpWithValues writes the help message like WriteHelp, additionally
+// showing the current value of each option and where it came from (see
+// Option.Source), e.g. {current: 3, source: env}. This is meant for
+// diagnosing the configuration of an application after parsing. Values of
+// options with a DefaultMask are shown as the mask, values of secret options
+// and options with a DefaultMask of - are hidden.
+func (p *Parser) WriteHelpWithValues(writer io.Writer) {
+	p.writeHelp(writer, true, p.helpWidth(writer))
+}
+
+func (p *Parser) writeHelp(writer io.Writer, showValues bool, width int) {
 	if writer == nil {
 		return
 	}
 
 	wr := bufio.NewWriter(writer)
-	aligninfo := p.getAlignmentInfo()
+	aligninfo := p.getAlignmentInfo(width)
+	aligninfo.showValues = showValues
 
-	cmd := p.Command
+	cmd := p.activeCommand()
 
-	for cmd.Active != nil {
-		cmd = cmd.Active
+	if len(p.HelpHeader) != 0 {
+		writeHelpText(wr, p.HelpHeader)
+		fmt.Fprintln(wr)
 	}
 
-	if p.Name != "" {
-		wr.WriteString("Usage:\n")
-		wr.WriteString(" ")
-
-		allcmd := p.Command
-
-		for allcmd != nil {
-			var usage string
-
-			if allcmd == p.Command {
-				if len(p.Usage) != 0 {
-					usage = p.Usage
-				} else if p.Options&HelpFlag != 0 {
-					usage = "[OPTIONS]"
-				}
-			} else if us, ok := allcmd.data.(Usage); ok {
-				usage = us.Usage()
-			} else if allcmd.hasCliOptions() {
-				usage = fmt.Sprintf("[%s-OPTIONS]", allcmd.Name)
-			}
-
-			if len(usage) != 0 {
-				fmt.Fprintf(wr, " %s %s", allcmd.Name, usage)
-			} else {
-				fmt.Fprintf(wr, " %s", allcmd.Name)
-			}
-
-			if len(allcmd.args) > 0 {
-				fmt.Fprintf(wr, " ")
-			}
-
-			for i, arg := range allcmd.args {
-				if i != 0 {
-					fmt.Fprintf(wr, " ")
-				}
-
-				name := arg.Name
-
-				if arg.isRemaining() {
-					name = name + "..."
-				}
-
-				if !allcmd.ArgsRequired {
-					fmt.Fprintf(wr, "[%s]", name)
-				} else {
-					fmt.Fprintf(wr, "%s", name)
-				}
-			}
-
-			if allcmd.Active == nil && len(allcmd.commands) > 0 {
-				var co, cc string
-
-				if allcmd.SubcommandsOptional {
-					co, cc = "[", "]"
-				} else {
-					co, cc = "<", ">"
-				}
-
-				if len(allcmd.commands) > 3 {
-					fmt.Fprintf(wr, " %scommand%s", co, cc)
-				} else {
-					subcommands := allcmd.sortedCommands()
-					names := make([]string, len(subcommands))
-
-					for i, subc := range subcommands {
-						names[i] = subc.Name
-					}
-
-					fmt.Fprintf(wr, " %s%s%s", co, strings.Join(names, " | "), cc)
-				}
-			}
-
-			allcmd = allcmd.Active
-		}
-
-		fmt.Fprintln(wr)
+	if p.helpName() != "" {
+		p.writeUsage(wr)
 
 		if len(cmd.LongDescription) != 0 {
 			fmt.Fprintln(wr)
@@ -319,6 +488,31 @@ func (p *Parser) WriteHelp(writer io.Writer) {
 	for c != nil {
 		printcmd := c != p.Command
 
+		writeCommandHeader := func() {
+			if printcmd {
+				fmt.Fprintf(wr, "\n%s\n", strings.Replace(message(p.Messages.CommandOptions, "[%s command options]"), "%s", c.Name, 1))
+				aligninfo.indent = true
+				printcmd = false
+			}
+		}
+
+		required := p.requiredHelpOptions(c, cmd)
+
+		if len(required) != 0 {
+			writeCommandHeader()
+			fmt.Fprintln(wr)
+
+			if aligninfo.indent {
+				wr.WriteString("    ")
+			}
+
+			fmt.Fprintf(wr, "%s:\n", message(p.Messages.Required, "Required"))
+
+			for _, info := range required {
+				p.writeHelpOption(wr, info, aligninfo)
+			}
+		}
+
 		c.eachGroup(func(grp *Group) {
 			first := true
 
@@ -328,17 +522,22 @@ func (p *Parser) WriteHelp(writer io.Writer) {
 				return
 			}
 
+			if cmd.hidesInheritedGroup(c, grp) {
+				return
+			}
+
 			for _, info := range grp.options {
-				if !info.canCli() {
+				if !info.isHelpVisible() {
 					continue
 				}
 
-				if printcmd {
-					fmt.Fprintf(wr, "\n[%s command options]\n", c.Name)
-					aligninfo.indent = true
-					printcmd = false
+				// Required options are listed separately
+				if p.GroupRequiredFirst && info.Required {
+					continue
 				}
 
+				writeCommandHeader()
+
 				if first && cmd.Group != grp {
 					fmt.Fprintln(wr)
 
@@ -346,7 +545,18 @@ func (p *Parser) WriteHelp(writer io.Writer) {
 						wr.WriteString("    ")
 					}
 
-					fmt.Fprintf(wr, "%s:\n", grp.ShortDescription)
+					fmt.Fprintf(wr, "%s:\n", p.groupHeader(grp))
+
+					if len(grp.LongDescription) != 0 {
+						p.writeGroupDescription(wr, grp, aligninfo)
+					}
+
+					first = false
+				} else if first && len(required) != 0 {
+					// Separate the options of the active command
+					// itself (which have no header) from its
+					// required options
+					fmt.Fprintln(wr)
 					first = false
 				}
 
@@ -356,20 +566,27 @@ func (p *Parser) WriteHelp(writer io.Writer) {
 
 		if len(c.args) > 0 {
 			if c == p.Command {
-				fmt.Fprintf(wr, "\nArguments:\n")
+				fmt.Fprintf(wr, "\n%s:\n", message(p.Messages.Arguments, "Arguments"))
 			} else {
-				fmt.Fprintf(wr, "\n[%s command arguments]\n", c.Name)
+				fmt.Fprintf(wr, "\n%s\n", strings.Replace(message(p.Messages.CommandArguments, "[%s command arguments]"), "%s", c.Name, 1))
 			}
 
 			maxlen := aligninfo.descriptionStart()
 
 			for _, arg := range c.args {
 				prefix := strings.Repeat(" ", paddingBeforeOption)
-				fmt.Fprintf(wr, "%s%s", prefix, arg.Name)
+				name := arg.usageName()
+
+				fmt.Fprintf(wr, "%s%s", prefix, name)
 
 				if len(arg.Description) > 0 {
-					align := strings.Repeat(" ", maxlen-len(arg.Name)-1)
-					fmt.Fprintf(wr, ":%s%s", align, arg.Description)
+					dw := maxlen - len(name) - 1
+
+					if dw < distanceBetweenOptionAndDescription {
+						fmt.Fprintf(wr, ":\n%s%s", strings.Repeat(" ", maxlen+paddingBeforeOption), arg.Description)
+					} else {
+						fmt.Fprintf(wr, ":%s%s", strings.Repeat(" ", dw), arg.Description)
+					}
 				}
 
 				fmt.Fprintln(wr)
@@ -379,30 +596,204 @@ func (p *Parser) WriteHelp(writer io.Writer) {
 		c = c.Active
 	}
 
-	scommands := cmd.sortedCommands()
+	scommands := cmd.visibleCommands()
 
 	if len(scommands) > 0 {
 		maxnamelen := maxCommandLength(scommands)
 
 		fmt.Fprintln(wr)
-		fmt.Fprintln(wr, "Available commands:")
+		fmt.Fprintf(wr, "%s:\n", message(p.Messages.AvailableCommands, "Available commands"))
 
 		for _, c := range scommands {
 			fmt.Fprintf(wr, "  %s", c.Name)
 
 			if len(c.ShortDescription) > 0 {
 				pad := strings.Repeat(" ", maxnamelen-len(c.Name))
-				fmt.Fprintf(wr, "%s  %s", pad, c.ShortDescription)
+				descstart := maxnamelen + 4
+
+				var aliases string
 
 				if len(c.Aliases) > 0 {
-					fmt.Fprintf(wr, " (aliases: %s)", strings.Join(c.Aliases, ", "))
+					aliases = fmt.Sprintf(" (aliases: %s)", strings.Join(c.Aliases, ", "))
 				}
 
+				// Wrap the description such that the aliases fit on
+				// its first line
+				width := aligninfo.terminalColumns - descstart
+
+				desc := wrapTextFirst(c.ShortDescription, width-len(aliases), width, strings.Repeat(" ", descstart))
+
+				if i := strings.IndexByte(desc, '\n'); i >= 0 {
+					desc = desc[:i] + aliases + desc[i:]
+				} else {
+					desc += aliases
+				}
+
+				fmt.Fprintf(wr, "%s  %s", pad, desc)
 			}
 
 			fmt.Fprintln(wr)
 		}
 	}
 
+	if p.ExtraHelpFunc != nil {
+		p.ExtraHelpFunc(wr)
+	}
+
+	if len(p.HelpFooter) != 0 {
+		fmt.Fprintln(wr)
+		writeHelpText(wr, p.HelpFooter)
+	}
+
 	wr.Flush()
 }
+
+// requiredHelpOptions returns the visible required options of command c,
+// when required options are listed separately in the help (see
+// Parser.GroupRequiredFirst). The active command is cmd.
+func (p *Parser) requiredHelpOptions(c *Command, cmd *Command) []*Option {
+	var ret []*Option
+
+	if !p.GroupRequiredFirst {
+		return nil
+	}
+
+	c.eachGroup(func(grp *Group) {
+		if (grp.isBuiltinHelp && c != p.Command) || cmd.hidesInheritedGroup(c, grp) {
+			return
+		}
+
+		for _, info := range grp.options {
+			if info.isHelpVisible() && info.Required {
+				ret = append(ret, info)
+			}
+		}
+	})
+
+	return ret
+}
+
+// writeGroupDescription writes the long description of a group as a
+// paragraph below its header, indented like the options of the group.
+func (p *Parser) writeGroupDescription(wr *bufio.Writer, grp *Group, info alignmentInfo) {
+	indent := paddingBeforeOption
+
+	if info.indent {
+		indent += 4
+	}
+
+	prefix := strings.Repeat(" ", indent)
+
+	fmt.Fprintf(wr, "%s%s\n\n", prefix, wrapText(grp.LongDescription, info.terminalColumns-indent, prefix))
+}
+
+// helpName returns the name of the parser shown in the usage line, which is
+// the base name of the running binary when the name is empty and
+// UseArgv0Name is set. On windows, the .exe extension is stripped from the
+// name of the binary.
+func (p *Parser) helpName() string {
+	if len(p.Name) == 0 && p.UseArgv0Name && len(os.Args) > 0 {
+		name := filepath.Base(os.Args[0])
+
+		if runtime.GOOS == "windows" && strings.EqualFold(filepath.Ext(name), ".exe") {
+			name = name[:len(name)-len(".exe")]
+		}
+
+		return name
+	}
+
+	return p.Name
+}
+
+// writeUsage writes the usage line of the active command to the help
+// message.
+func (p *Parser) writeUsage(wr *bufio.Writer) {
+	fmt.Fprintf(wr, "%s:\n", message(p.Messages.Usage, "Usage"))
+	wr.WriteString(" ")
+
+	allcmd := p.Command
+
+	for allcmd != nil {
+		var usage string
+
+		if allcmd == p.Command {
+			if len(p.Usage) != 0 {
+				usage = p.Usage
+			} else if p.hasOptions() {
+				usage = "[OPTIONS]"
+			}
+		} else if us, ok := allcmd.data.(Usage); ok {
+			usage = us.Usage()
+		} else if allcmd.hasCliOptions() {
+			usage = fmt.Sprintf("[%s-OPTIONS]", allcmd.Name)
+		}
+
+		name := allcmd.Name
+
+		if allcmd == p.Command {
+			name = p.helpName()
+		}
+
+		if len(usage) != 0 {
+			fmt.Fprintf(wr, " %s %s", name, usage)
+		} else {
+			fmt.Fprintf(wr, " %s", name)
+		}
+
+		if len(allcmd.args) > 0 {
+			fmt.Fprintf(wr, " ")
+		}
+
+		for i, arg := range allcmd.args {
+			if i != 0 {
+				fmt.Fprintf(wr, " ")
+			}
+
+			name := arg.usageName()
+
+			// The trailing slice argument is never required
+			if !allcmd.ArgsRequired || arg.isRemaining() {
+				fmt.Fprintf(wr, "[%s]", name)
+			} else {
+				fmt.Fprintf(wr, "%s", name)
+			}
+		}
+
+		visible := allcmd.visibleCommands()
+
+		if allcmd.Active == nil && len(visible) > 0 {
+			var co, cc string
+
+			if allcmd.SubcommandsOptional {
+				co, cc = "[", "]"
+			} else {
+				co, cc = "<", ">"
+			}
+
+			if len(visible) > 3 {
+				fmt.Fprintf(wr, " %scommand%s", co, cc)
+			} else {
+				names := make([]string, len(visible))
+
+				for i, subc := range visible {
+					names[i] = subc.Name
+				}
+
+				fmt.Fprintf(wr, " %s%s%s", co, strings.Join(names, " | "), cc)
+			}
+		}
+
+		allcmd = allcmd.Active
+	}
+
+	fmt.Fprintln(wr)
+}
+
+// writeHelpText writes text to the help message, terminated by a newline.
+func writeHelpText(wr *bufio.Writer, text string) {
+	wr.WriteString(text)
+
+	if !strings.HasSuffix(text, "\n") {
+		wr.WriteString("\n")
+	}
+}
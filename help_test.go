@@ -8,8 +8,10 @@ import (
 	"os"
 	"os/exec"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
 )
 
 func helpDiff(a, b string) (string, error) {
@@ -106,6 +108,8 @@ func TestHelp(t *testing.T) {
   TestHelp [OPTIONS] [filename] [num] <command>
 
 Application Options:
+  The application options
+
   /v, /verbose             Show verbose debug information
   /c:                      Call phone number
       /ptrslice:           A slice of pointers to string
@@ -140,6 +144,8 @@ Available commands:
   TestHelp [OPTIONS] [filename] [num] <command>
 
 Application Options:
+  The application options
+
   -v, --verbose            Show verbose debug information
   -c=                      Call phone number
       --ptrslice=          A slice of pointers to string
@@ -208,6 +214,8 @@ TestMan \- Test manpage generation
 .SH DESCRIPTION
 This is a somewhat \fBlonger\fP description of what this does
 .SH OPTIONS
+.PP
+The application options
 .TP
 \fB-v, --verbose\fP
 Show verbose debug information
@@ -240,6 +248,13 @@ This is a subgroup option
 .TP
 \fB--sip.sap.opt\fP
 This is a subsubgroup option
+.SH ARGUMENTS
+.TP
+\fBfilename\fP
+A filename
+.TP
+\fBnum\fP
+A number
 .SH COMMANDS
 .SS command
 A command
@@ -319,3 +334,1544 @@ Help Options:
 		}
 	}
 }
+
+func TestHelpEnvChoice(t *testing.T) {
+	var opts struct {
+		Level string `long:"level" default:"info" choice:"info" choice:"debug" env:"LEVEL" description:"The log level"`
+		Host  string `long:"host" env:"HOST" description:"The host"`
+	}
+
+	p := NewNamedParser("TestHelpEnvChoice", None)
+	p.AddGroup("Application Options", "The application options", &opts)
+
+	var buf bytes.Buffer
+	p.WriteHelp(&buf)
+
+	var expected string
+
+	if runtime.GOOS == "windows" {
+		expected = `Usage:
+  TestHelpEnvChoice [OPTIONS]
+
+Application Options:
+  The application options
+
+  /level:[info|debug]       The log level (info) [$LEVEL]
+  /host:                    The host [$HOST]
+`
+	} else {
+		expected = `Usage:
+  TestHelpEnvChoice [OPTIONS]
+
+Application Options:
+  The application options
+
+  --level=[info|debug]      The log level (info) [$LEVEL]
+  --host=                   The host [$HOST]
+`
+	}
+
+	if buf.String() != expected {
+		ret, err := helpDiff(buf.String(), expected)
+
+		if err != nil {
+			t.Errorf("Unexpected help message, expected:\n\n%s\n\nbut got\n\n%s", expected, buf.String())
+		} else {
+			t.Errorf("Unexpected help message:\n\n%s", ret)
+		}
+	}
+}
+
+func TestHelpHideInheritedGroups(t *testing.T) {
+	var opts struct {
+		Verbose bool `short:"v" long:"verbose" description:"Show verbose debug information"`
+
+		Other struct {
+			Level int `long:"level" description:"A level"`
+		} `group:"Other Options"`
+
+		Command struct {
+			Extra bool `long:"extra" description:"Extra option"`
+		} `command:"command" description:"A command" hide-inherited-groups:"yes"`
+	}
+
+	p := NewNamedParser("TestHelpHideInheritedGroups", HelpFlag)
+	p.AddGroup("Application Options", "The application options", &opts)
+
+	_, err := p.ParseArgs([]string{"-v", "command", "--help"})
+
+	if err == nil {
+		t.Fatalf("Expected help error")
+	}
+
+	if !opts.Verbose {
+		t.Errorf("Expected Verbose to be true")
+	}
+
+	var expected string
+
+	if runtime.GOOS == "windows" {
+		expected = `Usage:
+  TestHelpHideInheritedGroups [OPTIONS] command [command-OPTIONS]
+
+Help Options:
+  /?               Show this help message
+  /h, /help        Show this help message
+
+[command command options]
+          /extra   Extra option
+`
+	} else {
+		expected = `Usage:
+  TestHelpHideInheritedGroups [OPTIONS] command [command-OPTIONS]
+
+Help Options:
+  -h, --help       Show this help message
+
+[command command options]
+          --extra  Extra option
+`
+	}
+
+	msg := err.(*Error).Message
+
+	if msg != expected {
+		ret, err := helpDiff(msg, expected)
+
+		if err != nil {
+			t.Errorf("Unexpected help message, expected:\n\n%s\n\nbut got\n\n%s", expected, msg)
+		} else {
+			t.Errorf("Unexpected help message:\n\n%s", ret)
+		}
+	}
+}
+
+func TestHelpNoOptions(t *testing.T) {
+	var opts struct {
+		Command struct {
+		} `command:"command" description:"A command"`
+	}
+
+	p := NewNamedParser("TestHelpNoOptions", None)
+	p.AddGroup("Application Options", "The application options", &opts)
+
+	var buf bytes.Buffer
+	p.WriteHelp(&buf)
+
+	expected := `Usage:
+  TestHelpNoOptions <command>
+
+Available commands:
+  command  A command
+`
+
+	if buf.String() != expected {
+		ret, err := helpDiff(buf.String(), expected)
+
+		if err != nil {
+			t.Errorf("Unexpected help message, expected:\n\n%s\n\nbut got\n\n%s", expected, buf.String())
+		} else {
+			t.Errorf("Unexpected help message:\n\n%s", ret)
+		}
+	}
+
+	buf.Reset()
+	p.WriteManPage(&buf)
+
+	expectedMan := fmt.Sprintf(`.TH TestHelpNoOptions 1 "%s"
+.SH NAME
+TestHelpNoOptions \- 
+.SH SYNOPSIS
+\fBTestHelpNoOptions\fP
+.SH DESCRIPTION
+
+.SH COMMANDS
+.SS command
+A command
+`, time.Now().Format("2 January 2006"))
+
+	if buf.String() != expectedMan {
+		ret, err := helpDiff(buf.String(), expectedMan)
+
+		if err != nil {
+			t.Errorf("Unexpected man page, expected:\n\n%s\n\nbut got\n\n%s", expectedMan, buf.String())
+		} else {
+			t.Errorf("Unexpected man page:\n\n%s", ret)
+		}
+	}
+}
+
+type helpCommandArgsOptions struct {
+	Command struct {
+		Force bool `long:"force" description:"Force the copy"`
+
+		Args struct {
+			Source string   `description:"The source file"`
+			Dest   []string `description:"The destination files"`
+		} `positional-args:"yes" required:"yes"`
+	} `command:"copy" description:"Copy a file"`
+}
+
+func TestHelpCommandArgs(t *testing.T) {
+	var opts helpCommandArgsOptions
+
+	p := NewNamedParser("TestHelpCommandArgs", None)
+	p.AddGroup("Application Options", "The application options", &opts)
+
+	_, err := p.ParseArgs([]string{"copy", "a", "b"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	p.WriteHelp(&buf)
+
+	var expected string
+
+	if runtime.GOOS == "windows" {
+		expected = `Usage:
+  TestHelpCommandArgs copy [copy-OPTIONS] Source [Dest...]
+
+[copy command options]
+      /force       Force the copy
+
+[copy command arguments]
+  Source:          The source file
+  Dest...:         The destination files
+`
+	} else {
+		expected = `Usage:
+  TestHelpCommandArgs copy [copy-OPTIONS] Source [Dest...]
+
+[copy command options]
+      --force      Force the copy
+
+[copy command arguments]
+  Source:          The source file
+  Dest...:         The destination files
+`
+	}
+
+	if buf.String() != expected {
+		ret, err := helpDiff(buf.String(), expected)
+
+		if err != nil {
+			t.Errorf("Unexpected help message, expected:\n\n%s\n\nbut got\n\n%s", expected, buf.String())
+		} else {
+			t.Errorf("Unexpected help message:\n\n%s", ret)
+		}
+	}
+
+	buf.Reset()
+	p.WriteManPage(&buf)
+
+	expectedMan := fmt.Sprintf(`.TH TestHelpCommandArgs 1 "%s"
+.SH NAME
+TestHelpCommandArgs \- 
+.SH SYNOPSIS
+\fBTestHelpCommandArgs\fP
+.SH DESCRIPTION
+
+.SH COMMANDS
+.SS copy
+Copy a file
+.TP
+\fB--force\fP
+Force the copy
+.TP
+\fBSource\fP
+The source file
+.TP
+\fBDest\fP...
+The destination files
+`, time.Now().Format("2 January 2006"))
+
+	if buf.String() != expectedMan {
+		ret, err := helpDiff(buf.String(), expectedMan)
+
+		if err != nil {
+			t.Errorf("Unexpected man page, expected:\n\n%s\n\nbut got\n\n%s", expectedMan, buf.String())
+		} else {
+			t.Errorf("Unexpected man page:\n\n%s", ret)
+		}
+	}
+}
+
+func TestVersionFlag(t *testing.T) {
+	var opts struct {
+		Verbose bool `short:"v" long:"verbose" description:"Show verbose debug information"`
+	}
+
+	p := NewNamedParser("TestVersionFlag", HelpFlag|VersionFlag)
+	p.Version = "1.2.3"
+	p.AddGroup("Application Options", "The application options", &opts)
+
+	_, err := p.ParseArgs([]string{"--version"})
+	assertError(t, err, ErrVersion, "1.2.3")
+
+	_, err = p.ParseArgs([]string{"--help"})
+
+	if err == nil {
+		t.Fatalf("Expected help error")
+	}
+
+	var expected string
+
+	if runtime.GOOS == "windows" {
+		expected = `Usage:
+  TestVersionFlag [OPTIONS]
+
+Application Options:
+  The application options
+
+  /v, /verbose   Show verbose debug information
+
+Help Options:
+  /?             Show this help message
+  /h, /help      Show this help message
+      /version   Show the version information
+`
+	} else {
+		expected = `Usage:
+  TestVersionFlag [OPTIONS]
+
+Application Options:
+  The application options
+
+  -v, --verbose  Show verbose debug information
+
+Help Options:
+  -h, --help     Show this help message
+      --version  Show the version information
+`
+	}
+
+	msg := err.(*Error).Message
+
+	if msg != expected {
+		ret, err := helpDiff(msg, expected)
+
+		if err != nil {
+			t.Errorf("Unexpected help message, expected:\n\n%s\n\nbut got\n\n%s", expected, msg)
+		} else {
+			t.Errorf("Unexpected help message:\n\n%s", ret)
+		}
+	}
+}
+
+func TestHelpNames(t *testing.T) {
+	var opts struct {
+		Host string `short:"h" long:"host" value-name:"HOST" description:"The host to connect to"`
+	}
+
+	p := NewNamedParser("TestHelpNames", HelpFlag)
+	p.HelpShort = 'H'
+	p.AddGroup("Application Options", "The application options", &opts)
+
+	_, err := p.ParseArgs([]string{"-h", "localhost"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertString(t, opts.Host, "localhost")
+
+	_, err = p.ParseArgs([]string{"-H"})
+
+	if err == nil {
+		t.Fatalf("Expected help error")
+	}
+
+	var expected string
+
+	if runtime.GOOS == "windows" {
+		expected = `Usage:
+  TestHelpNames [OPTIONS]
+
+Application Options:
+  The application options
+
+  /h, /host:HOST     The host to connect to (localhost)
+
+Help Options:
+  /?                 Show this help message
+  /H, /help          Show this help message
+`
+	} else {
+		expected = `Usage:
+  TestHelpNames [OPTIONS]
+
+Application Options:
+  The application options
+
+  -h, --host=HOST    The host to connect to (localhost)
+
+Help Options:
+  -H, --help         Show this help message
+`
+	}
+
+	if err.Error() != expected {
+		ret, err := helpDiff(err.Error(), expected)
+
+		if err != nil {
+			t.Errorf("Unexpected diff error: %s", err)
+			t.Errorf("Unexpected help message, expected:\n\n%s\n\nbut got\n\n%s", expected, ret)
+		} else {
+			t.Errorf("Unexpected help message:\n\n%s", ret)
+		}
+	}
+
+	p = NewNamedParser("TestHelpNames", HelpFlag)
+	p.HelpShort = -1
+	p.HelpLong = "usage"
+	p.AddGroup("Application Options", "The application options", &opts)
+
+	_, err = p.ParseArgs([]string{"--usage"})
+
+	if e, ok := err.(*Error); !ok || e.Type != ErrHelp {
+		t.Fatalf("Expected help error but got %v", err)
+	}
+
+	if _, err = p.ParseArgs([]string{"--help"}); err == nil {
+		t.Fatalf("Expected unknown flag error")
+	}
+
+	assertError(t, err, ErrUnknownFlag, "unknown flag `help'")
+
+	var b bytes.Buffer
+	p.WriteHelp(&b)
+
+	line := "      --usage        Show this help message"
+
+	if runtime.GOOS == "windows" {
+		line = "      /usage         Show this help message"
+	}
+
+	if !strings.Contains(b.String(), line) {
+		t.Errorf("Expected help to contain %q but got:\n\n%s", line, b.String())
+	}
+}
+
+func TestVersionFlagUserDefined(t *testing.T) {
+	var opts struct {
+		Version bool `long:"version"`
+	}
+
+	p := NewNamedParser("TestVersionFlag", VersionFlag)
+	p.Version = "1.2.3"
+	p.AddGroup("Application Options", "The application options", &opts)
+
+	if _, err := p.ParseArgs([]string{"--version"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !opts.Version {
+		t.Errorf("Expected Version to be true")
+	}
+}
+
+func TestHelpMaxNameColumn(t *testing.T) {
+	var opts struct {
+		Verbose bool   `short:"v" long:"verbose" description:"Show verbose debug information"`
+		Output  string `short:"o" long:"output" description:"The output file"`
+		Long    bool   `long:"an-extremely-long-option-name-for-testing" description:"A long option"`
+	}
+
+	p := NewNamedParser("TestHelpMaxNameColumn", None)
+	p.MaxNameColumn = 20
+	p.AddGroup("Application Options", "The application options", &opts)
+
+	var buf bytes.Buffer
+	p.WriteHelp(&buf)
+
+	var expected string
+
+	if runtime.GOOS == "windows" {
+		expected = `Usage:
+  TestHelpMaxNameColumn [OPTIONS]
+
+Application Options:
+  The application options
+
+  /v, /verbose   Show verbose debug information
+  /o, /output:   The output file
+      /an-extremely-long-option-name-for-testing
+                 A long option
+`
+	} else {
+		expected = `Usage:
+  TestHelpMaxNameColumn [OPTIONS]
+
+Application Options:
+  The application options
+
+  -v, --verbose  Show verbose debug information
+  -o, --output=  The output file
+      --an-extremely-long-option-name-for-testing
+                 A long option
+`
+	}
+
+	if buf.String() != expected {
+		ret, err := helpDiff(buf.String(), expected)
+
+		if err != nil {
+			t.Errorf("Unexpected help message, expected:\n\n%s\n\nbut got\n\n%s", expected, buf.String())
+		} else {
+			t.Errorf("Unexpected help message:\n\n%s", ret)
+		}
+	}
+}
+
+func TestHelpMaxNameColumnShortValues(t *testing.T) {
+	var opts struct {
+		Config string `short:"c" description:"Config file"`
+		Token  string `short:"t" description:"Token"`
+		Name   string `long:"name" description:"The name"`
+		Label  string `long:"label1" description:"A label"`
+	}
+
+	p := NewNamedParser("TestHelpMaxNameColumnShortValues", None)
+	p.MaxNameColumn = 5
+	p.AddGroup("Application Options", "", &opts)
+
+	var buf bytes.Buffer
+	p.WriteHelp(&buf)
+
+	var expected string
+
+	if runtime.GOOS == "windows" {
+		expected = `Usage:
+  TestHelpMaxNameColumnShortValues [OPTIONS]
+
+Application Options:
+  /c:         Config file
+  /t:         Token
+      /name:  The name
+      /label1:
+              A label
+`
+	} else {
+		expected = `Usage:
+  TestHelpMaxNameColumnShortValues [OPTIONS]
+
+Application Options:
+  -c=         Config file
+  -t=         Token
+      --name= The name
+      --label1=
+              A label
+`
+	}
+
+	if buf.String() != expected {
+		ret, err := helpDiff(buf.String(), expected)
+
+		if err != nil {
+			t.Errorf("Unexpected help message, expected:\n\n%s\n\nbut got\n\n%s", expected, buf.String())
+		} else {
+			t.Errorf("Unexpected help message:\n\n%s", ret)
+		}
+	}
+}
+
+type helpHiddenOptions struct {
+	Verbose bool `short:"v" long:"verbose" description:"Show verbose debug information"`
+	Debug   bool `long:"debug" description:"Enable debugging" hidden:"yes"`
+
+	Internal struct {
+		Trace bool `long:"trace" description:"Enable tracing"`
+	} `group:"Internal Options" hidden:"yes"`
+}
+
+func TestHelpHidden(t *testing.T) {
+	var opts helpHiddenOptions
+
+	p := NewNamedParser("TestHelpHidden", None)
+	p.AddGroup("Application Options", "The application options", &opts)
+
+	if _, err := p.ParseArgs([]string{"--debug", "--trace"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !opts.Debug || !opts.Internal.Trace {
+		t.Errorf("Expected hidden options to be parsed")
+	}
+
+	var buf bytes.Buffer
+	p.WriteHelp(&buf)
+
+	var expected string
+
+	if runtime.GOOS == "windows" {
+		expected = `Usage:
+  TestHelpHidden [OPTIONS]
+
+Application Options:
+  The application options
+
+  /v, /verbose   Show verbose debug information
+`
+	} else {
+		expected = `Usage:
+  TestHelpHidden [OPTIONS]
+
+Application Options:
+  The application options
+
+  -v, --verbose  Show verbose debug information
+`
+	}
+
+	if buf.String() != expected {
+		ret, err := helpDiff(buf.String(), expected)
+
+		if err != nil {
+			t.Errorf("Unexpected help message, expected:\n\n%s\n\nbut got\n\n%s", expected, buf.String())
+		} else {
+			t.Errorf("Unexpected help message:\n\n%s", ret)
+		}
+	}
+
+	buf.Reset()
+	p.WriteManPage(&buf)
+
+	if strings.Contains(buf.String(), "--debug") || strings.Contains(buf.String(), "--trace") {
+		t.Errorf("Expected hidden options not to be shown in the man page, but got:\n%s", buf.String())
+	}
+
+	p.ShowHidden = true
+
+	buf.Reset()
+	p.WriteHelp(&buf)
+
+	if runtime.GOOS == "windows" {
+		expected = `Usage:
+  TestHelpHidden [OPTIONS]
+
+Application Options:
+  The application options
+
+  /v, /verbose   Show verbose debug information
+      /debug     Enable debugging
+
+Internal Options:
+      /trace     Enable tracing
+`
+	} else {
+		expected = `Usage:
+  TestHelpHidden [OPTIONS]
+
+Application Options:
+  The application options
+
+  -v, --verbose  Show verbose debug information
+      --debug    Enable debugging
+
+Internal Options:
+      --trace    Enable tracing
+`
+	}
+
+	if buf.String() != expected {
+		ret, err := helpDiff(buf.String(), expected)
+
+		if err != nil {
+			t.Errorf("Unexpected help message, expected:\n\n%s\n\nbut got\n\n%s", expected, buf.String())
+		} else {
+			t.Errorf("Unexpected help message:\n\n%s", ret)
+		}
+	}
+}
+
+func TestHelpMessages(t *testing.T) {
+	var opts struct {
+		Verbose bool `short:"v" long:"verbose" description:"Show verbose debug information"`
+
+		Command struct {
+			Force bool `long:"force" description:"Force it"`
+
+			Args struct {
+				Name string `description:"A name"`
+			} `positional-args:"yes"`
+		} `command:"command" description:"A command"`
+	}
+
+	p := NewParser(&opts, HelpFlag)
+	p.Name = "TestHelpMessages"
+	p.Messages = Messages{
+		Usage:              "Gebruik",
+		ApplicationOptions: "Programma-opties",
+		HelpOptions:        "Hulp-opties",
+		AvailableCommands:  "Beschikbare commando's",
+		CommandOptions:     "[opties van %s]",
+		CommandArguments:   "[argumenten van %s]",
+	}
+
+	_, err := p.ParseArgs([]string{"--help"})
+
+	if err == nil {
+		t.Fatalf("Expected help error")
+	}
+
+	msg := err.(*Error).Message
+
+	for _, s := range []string{"Gebruik:\n", "\nProgramma-opties:\n", "\nHulp-opties:\n", "\nBeschikbare commando's:\n"} {
+		if !strings.Contains(msg, s) {
+			t.Errorf("Expected %q in help message, but got:\n%s", s, msg)
+		}
+	}
+
+	_, err = p.ParseArgs([]string{"command", "--help"})
+
+	if err == nil {
+		t.Fatalf("Expected help error")
+	}
+
+	msg = err.(*Error).Message
+
+	for _, s := range []string{"\n[opties van command]\n", "\n[argumenten van command]\n"} {
+		if !strings.Contains(msg, s) {
+			t.Errorf("Expected %q in help message, but got:\n%s", s, msg)
+		}
+	}
+
+	p.Messages.CommandOptions = "[100% opties]"
+	p.Messages.CommandArguments = "[%s: %d argumenten]"
+
+	_, err = p.ParseArgs([]string{"command", "--help"})
+
+	if err == nil {
+		t.Fatalf("Expected help error")
+	}
+
+	msg = err.(*Error).Message
+
+	for _, s := range []string{"\n[100% opties]\n", "\n[command: %d argumenten]\n"} {
+		if !strings.Contains(msg, s) {
+			t.Errorf("Expected %q in help message, but got:\n%s", s, msg)
+		}
+	}
+
+	p.Messages = Messages{}
+
+	var buf bytes.Buffer
+	p.WriteHelp(&buf)
+
+	if !strings.Contains(buf.String(), "Usage:\n") || !strings.Contains(buf.String(), "\n[command command arguments]\n") {
+		t.Errorf("Expected default messages in help, but got:\n%s", buf.String())
+	}
+}
+
+func TestHelpDefaultFormatter(t *testing.T) {
+	var opts struct {
+		Mode   uint   `long:"mode" default:"5" description:"The access mode"`
+		Level  int    `long:"level" description:"The level"`
+		Masked string `long:"masked" default:"secret" default-mask:"***" description:"Masked"`
+	}
+
+	opts.Level = 3
+
+	p := NewNamedParser("TestHelpDefaultFormatter", None)
+	g, _ := p.AddGroup("Application Options", "The application options", &opts)
+
+	format := func(value interface{}) string {
+		var names []string
+
+		for i, name := range []string{"read", "write", "exec"} {
+			if value.(uint)&(1<<uint(2-i)) != 0 {
+				names = append(names, name)
+			}
+		}
+
+		return strings.Join(names, "|")
+	}
+
+	if err := g.SetDefaultFormatter("Mode", format); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	g.SetDefaultFormatter("Level", func(value interface{}) string {
+		return fmt.Sprintf("level %d", value)
+	})
+
+	g.SetDefaultFormatter("Masked", func(value interface{}) string {
+		return "formatted"
+	})
+
+	assertError(t, g.SetDefaultFormatter("Missing", format), ErrUnknownFlag, "unknown option field `Missing'")
+
+	var b bytes.Buffer
+	p.WriteHelp(&b)
+
+	help := b.String()
+
+	for _, s := range []string{"The access mode (read|exec)", "The level (level 3)", "Masked (***)"} {
+		if !strings.Contains(help, s) {
+			t.Errorf("Expected help to contain %q but got:\n\n%s", s, help)
+		}
+	}
+
+	if _, err := p.ParseArgs([]string{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if opts.Mode != 5 {
+		t.Errorf("Expected Mode to be 5 but got %d", opts.Mode)
+	}
+}
+
+func TestHelpDescriptionFunc(t *testing.T) {
+	var backend string
+
+	p := NewNamedParser("TestHelpDescriptionFunc", None)
+	g, _ := p.AddGroup("Application Options", "The application options", &struct{}{})
+
+	option, err := g.AddOption(0, "backend", "static description", &backend)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	backends := []string{"memory"}
+
+	option.DescriptionFunc = func() string {
+		return "The backend (one of " + strings.Join(backends, ", ") + ")"
+	}
+
+	backends = append(backends, "disk")
+
+	var help bytes.Buffer
+	p.WriteHelp(&help)
+
+	var man bytes.Buffer
+	p.WriteManPage(&man)
+
+	expected := "The backend (one of memory, disk)"
+
+	for _, s := range []string{help.String(), man.String()} {
+		if !strings.Contains(s, expected) || strings.Contains(s, "static description") {
+			t.Errorf("Expected output to contain %q but got:\n\n%s", expected, s)
+		}
+	}
+}
+
+func TestHelpHeaderFooter(t *testing.T) {
+	var opts struct {
+		Verbose bool `short:"v" description:"Verbose"`
+	}
+
+	p := NewNamedParser("TestHelpHeaderFooter", HelpFlag)
+	p.AddGroup("Application Options", "", &opts)
+
+	p.HelpHeader = "A tool for testing"
+	p.HelpFooter = "Report bugs to the issue tracker\n"
+	p.ExtraHelpFunc = func(w io.Writer) {
+		fmt.Fprintf(w, "\nExamples:\n  TestHelpHeaderFooter -v\n")
+	}
+
+	_, err := p.ParseArgs([]string{"--help"})
+
+	if err == nil {
+		t.Fatalf("Expected help error")
+	}
+
+	e := err.(*Error)
+
+	if e.Type != ErrHelp {
+		t.Fatalf("Expected ErrHelp but got %s", e.Type)
+	}
+
+	header := "A tool for testing\n\nUsage:\n"
+	footer := "\n\nExamples:\n  TestHelpHeaderFooter -v\n\nReport bugs to the issue tracker\n"
+
+	if !strings.HasPrefix(e.Message, header) || !strings.HasSuffix(e.Message, footer) {
+		t.Errorf("Expected help to start with %q and end with %q but got:\n\n%s", header, footer, e.Message)
+	}
+}
+
+func TestWriteHelpWithValues(t *testing.T) {
+	oldEnv := NewEnvSnapshot()
+	defer oldEnv.Restore()
+
+	os.Setenv("TEST_LEVEL", "3")
+
+	var opts struct {
+		Level    int    `long:"level" env:"TEST_LEVEL" description:"The level"`
+		Name     string `long:"name"`
+		Password string `long:"password" default-mask:"***" description:"The password"`
+		Pass     string `long:"pass" default-mask:"-" description:"The pass"`
+		Token    string `long:"token" secret:"yes" description:"The token"`
+	}
+
+	p := NewNamedParser("TestWriteHelpWithValues", HelpFlag)
+	p.SecretResolver = func(uri string) (string, error) {
+		return "S3CR3T", nil
+	}
+	p.AddGroup("Application Options", "", &opts)
+
+	if _, err := p.ParseArgs([]string{"--name", "x", "--password", "secret", "--pass", "hunter2", "--token", "secret://x"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var b bytes.Buffer
+	p.WriteHelp(&b)
+
+	if strings.Contains(b.String(), "current:") {
+		t.Errorf("Expected help not to contain current values but got:\n\n%s", b.String())
+	}
+
+	b.Reset()
+	p.WriteHelpWithValues(&b)
+
+	help := b.String()
+
+	for _, s := range []string{
+		"The level (3) [$TEST_LEVEL] {current: 3, source: env}",
+		"{current: x, source: cli}",
+		"The password (***) {current: ***, source: cli}",
+		"The pass {current: <hidden>, source: cli}",
+		"The token {current: <hidden>, source: cli}",
+	} {
+		if !strings.Contains(help, s) {
+			t.Errorf("Expected help to contain %q but got:\n\n%s", s, help)
+		}
+	}
+
+	for _, s := range []string{"S3CR3T", "hunter2", "secret://x"} {
+		if strings.Contains(help, s) {
+			t.Errorf("Expected help not to contain %q but got:\n\n%s", s, help)
+		}
+	}
+
+	if strings.Contains(help, "Show this help message {") {
+		t.Errorf("Expected no current value for the help option but got:\n\n%s", help)
+	}
+}
+
+func TestHelpCompact(t *testing.T) {
+	var opts struct {
+		Output  string `short:"o" long:"output" value-name:"FILE" description:"Output file"`
+		Verbose bool   `long:"verbose"`
+		Level   int    `short:"l" default:"2" env:"LEVEL" description:"Level"`
+	}
+
+	p := NewNamedParser("TestHelpCompact", None)
+	p.HelpStyle = HelpStyleCompact
+	g, _ := p.AddGroup("Application Options", "", &opts)
+
+	// The description of --verbose does not fit on a single line
+	g.Options()[1].Description = strings.Repeat("A very long description. ", 100)
+
+	var buf bytes.Buffer
+	p.WriteHelp(&buf)
+
+	lines := strings.Split(buf.String(), "\n")
+
+	expected := []string{
+		fmt.Sprintf("  %soutput, %so  FILE  Output file", defaultLongOptDelimiter, string(defaultShortOptDelimiter)),
+		fmt.Sprintf("  %sl  VALUE  Level (2) [$LEVEL]", string(defaultShortOptDelimiter)),
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("Expected help to contain %q but got:\n\n%s", line, buf.String())
+		}
+	}
+
+	columns := DefaultHelpWidth
+
+	for _, line := range lines {
+		if !strings.Contains(line, "verbose") {
+			continue
+		}
+
+		if utf8.RuneCountInString(line) != columns || !strings.HasSuffix(line, "…") {
+			t.Errorf("Expected %q to be truncated to %d columns", line, columns)
+		}
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	assertString(t, truncateText("abcdef", 6), "abcdef")
+	assertString(t, truncateText("abcdef", 4), "abc…")
+	assertString(t, truncateText("abcdef", 0), "…")
+}
+
+func TestHelpGroupRequiredFirst(t *testing.T) {
+	var opts struct {
+		Verbose bool   `short:"v" description:"Verbose"`
+		Config  string `short:"c" required:"yes" description:"Config file"`
+
+		Other struct {
+			Token string `short:"t" required:"yes" description:"Token"`
+			Debug bool   `short:"d" description:"Debug"`
+		} `group:"Other Options"`
+
+		Command struct {
+			Target string `short:"T" required:"yes" description:"Target"`
+			Force  bool   `short:"f" description:"Force"`
+		} `command:"deploy"`
+	}
+
+	p := NewNamedParser("TestHelpGroupRequiredFirst", None)
+	p.GroupRequiredFirst = true
+	p.AddGroup("Application Options", "", &opts)
+
+	var buf bytes.Buffer
+	p.WriteHelp(&buf)
+
+	d := string(defaultShortOptDelimiter)
+
+	expected := `Usage:
+  TestHelpGroupRequiredFirst [OPTIONS] <deploy>
+
+Required:
+  ` + d + `c= Config file
+  ` + d + `t= Token
+
+Application Options:
+  ` + d + `v  Verbose
+
+Other Options:
+  ` + d + `d  Debug
+
+Available commands:
+  deploy
+`
+
+	if runtime.GOOS == "windows" {
+		expected = strings.Replace(expected, "=", ":", -1)
+	}
+
+	if buf.String() != expected {
+		ret, err := helpDiff(buf.String(), expected)
+
+		if err != nil {
+			t.Errorf("Unexpected help message, expected:\n\n%s\n\nbut got\n\n%s", expected, buf.String())
+		} else {
+			t.Errorf("Unexpected help message:\n\n%s", ret)
+		}
+	}
+
+	_, err := p.ParseArgs([]string{"deploy"})
+	assertError(t, err, ErrRequired, "the required flags `"+d+"T', `"+d+"c' and `"+d+"t' were not specified")
+
+	buf.Reset()
+	p.WriteHelp(&buf)
+
+	expected = `Usage:
+  TestHelpGroupRequiredFirst [OPTIONS] deploy [deploy-OPTIONS]
+
+Required:
+  ` + d + `c=         Config file
+  ` + d + `t=         Token
+
+Application Options:
+  ` + d + `v          Verbose
+
+Other Options:
+  ` + d + `d          Debug
+
+[deploy command options]
+
+    Required:
+      ` + d + `T=     Target
+
+      ` + d + `f      Force
+`
+
+	if runtime.GOOS == "windows" {
+		expected = strings.Replace(expected, "=", ":", -1)
+	}
+
+	if buf.String() != expected {
+		ret, err := helpDiff(buf.String(), expected)
+
+		if err != nil {
+			t.Errorf("Unexpected help message, expected:\n\n%s\n\nbut got\n\n%s", expected, buf.String())
+		} else {
+			t.Errorf("Unexpected help message:\n\n%s", ret)
+		}
+	}
+}
+
+func TestManEnvironmentFiles(t *testing.T) {
+	var opts struct {
+		Level  int    `short:"l" long:"level" env:"APP_LEVEL" description:"The log level"`
+		Token  string `env:"APP_TOKEN" env-only:"yes" description:"The API token\n'quoted' in a\\b"`
+		Secret string `long:"secret" env:"APP_SECRET" hidden:"yes"`
+
+		Command struct {
+			Target string `long:"target" env:"APP_TARGET"`
+		} `command:"deploy"`
+	}
+
+	p := NewNamedParser("TestManEnvironmentFiles", None)
+	p.ManFiles = []string{"/etc/app/config.ini", "~/.config/app/config.ini", `C:\app\config.ini`, ".apprc"}
+	p.AddGroup("Application Options", "", &opts)
+
+	var buf bytes.Buffer
+	p.WriteManPage(&buf)
+
+	got := buf.String()
+	got = got[strings.Index(got, ".SH ENVIRONMENT"):]
+
+	expected := `.SH ENVIRONMENT
+.TP
+\fBAPP_LEVEL\fP
+Default for \fB-l, --level\fP. The log level
+.TP
+\fBAPP_TOKEN\fP
+The API token
+\&'quoted' in a\eb
+.TP
+\fBAPP_TARGET\fP
+Default for \fB--target\fP.
+.SH FILES
+\fI/etc/app/config.ini\fP
+.br
+\fI~/.config/app/config.ini\fP
+.br
+\fIC:\eapp\econfig.ini\fP
+.br
+\fI\&.apprc\fP
+`
+
+	if got != expected {
+		ret, err := helpDiff(got, expected)
+
+		if err != nil {
+			t.Errorf("Unexpected man page, expected:\n\n%s\n\nbut got\n\n%s", expected, got)
+		} else {
+			t.Errorf("Unexpected man page:\n\n%s", ret)
+		}
+	}
+}
+
+func TestHelpVariadicArgs(t *testing.T) {
+	var opts struct {
+		Args struct {
+			Name  string   `name:"name" description:"The name of the archive"`
+			Level int      `name:"level" description:"The compression level"`
+			Files []string `name:"files" description:"The files to add"`
+		} `positional-args:"yes"`
+	}
+
+	p := NewNamedParser("TestHelpVariadicArgs", None)
+	p.AddGroup("Application Options", "", &opts)
+
+	var buf bytes.Buffer
+	p.WriteHelp(&buf)
+
+	expected := `Usage:
+  TestHelpVariadicArgs [name] [level] [files...]
+
+Arguments:
+  name:         The name of the archive
+  level:        The compression level
+  files...:     The files to add
+`
+
+	assertString(t, buf.String(), expected)
+}
+
+func TestHelpWrapCommandDescription(t *testing.T) {
+	var opts struct {
+		Deploy struct {
+		} `command:"deploy" alias:"d" alias:"dep" description:"Deploy the application to all the configured target hosts, restarting the services which were changed and waiting for them to become healthy"`
+
+		Status struct {
+		} `command:"status" description:"Show the status of the application on all the configured target hosts and services"`
+	}
+
+	p := NewNamedParser("TestHelpWrapCommandDescription", None)
+	p.AddGroup("Application Options", "", &opts)
+
+	var buf bytes.Buffer
+	p.WriteHelp(&buf)
+
+	expected := `Usage:
+  TestHelpWrapCommandDescription <deploy | status>
+
+Available commands:
+  deploy  Deploy the application to all the configured target (aliases: d, dep)
+          hosts, restarting the services which were changed and waiting for
+          them to become healthy
+  status  Show the status of the application on all the configured target hosts
+          and services
+`
+
+	assertString(t, buf.String(), expected)
+}
+
+func TestHelpHideDefault(t *testing.T) {
+	var opts struct {
+		TempDir string   `long:"temp-dir" default:"/tmp/app-1234" default-mask:"-" description:"The temporary directory"`
+		Workers int      `long:"workers" default-mask:"-" description:"The number of workers"`
+		Hosts   []string `long:"host" default:"a" default:"b" default-mask:"-" description:"The hosts"`
+		Level   int      `long:"level" default:"1" description:"The level"`
+	}
+
+	opts.Workers = 8
+
+	p := NewNamedParser("TestHelpHideDefault", None)
+	p.AddGroup("Application Options", "", &opts)
+
+	for _, style := range []HelpStyle{HelpStyleFull, HelpStyleCompact} {
+		p.HelpStyle = style
+
+		var buf bytes.Buffer
+		p.WriteHelp(&buf)
+
+		help := buf.String()
+
+		for _, def := range []string{"(/tmp/app-1234)", "(8)", "(a, b)"} {
+			if strings.Contains(help, def) {
+				t.Errorf("Expected default %s to be hidden, but got:\n%s", def, help)
+			}
+		}
+
+		if !strings.Contains(help, "The level (1)") {
+			t.Errorf("Expected default of --level to be shown, but got:\n%s", help)
+		}
+	}
+
+	if _, err := p.ParseArgs(nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertString(t, opts.TempDir, "/tmp/app-1234")
+	assertStringArray(t, opts.Hosts, []string{"a", "b"})
+
+	if opts.Workers != 8 {
+		t.Errorf("Expected 8 workers but got %d", opts.Workers)
+	}
+}
+
+func TestReST(t *testing.T) {
+	var opts struct {
+		Verbose bool   `short:"v" long:"verbose" description:"Show verbose *debug* information"`
+		Output  string "short:\"o\" long:\"output\" value-name:\"file\" description:\"Write the result to `file'\""
+		Hidden  bool   `long:"hidden" hidden:"yes"`
+
+		Args struct {
+			Input []string `name:"input" description:"The input files"`
+		} `positional-args:"yes"`
+
+		Command struct {
+			Force bool `long:"force" description:"Overwrite existing_files, like rm_ -f__"`
+		} `command:"convert" alias:"c" description:"Convert the input"`
+	}
+
+	p := NewNamedParser("TestReST", None)
+	p.ShortDescription = "Test reST generation"
+	p.LongDescription = "This is a somewhat `longer' description\nof what this does"
+	p.AddGroup("Application Options", "", &opts)
+
+	p.Find("convert").LongDescription = "Converts the `input' files"
+
+	var buf bytes.Buffer
+	p.WriteReST(&buf)
+
+	expected := `TestReST
+========
+
+.. program:: TestReST
+
+Test reST generation
+
+Synopsis
+--------
+
+::
+
+   TestReST [OPTIONS]
+
+Description
+-----------
+
+This is a somewhat ` + "``longer``" + ` description
+of what this does
+
+Options
+-------
+
+.. option:: -v, --verbose
+
+   Show verbose \*debug\* information
+
+.. option:: -o <file>, --output=<file>
+
+   Write the result to ` + "``file``" + `
+
+Arguments
+---------
+
+.. describe:: input...
+
+   The input files
+
+Commands
+--------
+
+convert
+~~~~~~~
+
+.. program:: TestReST convert
+
+Convert the input
+
+Converts the ` + "``input``" + ` files
+
+**Aliases**: c
+
+.. option:: --force
+
+   Overwrite existing_files, like rm\_ -f\_\_
+
+`
+
+	got := buf.String()
+
+	if got != expected {
+		ret, err := helpDiff(got, expected)
+
+		if err != nil {
+			t.Errorf("Unexpected reST, expected:\n\n%s\n\nbut got\n\n%s", expected, got)
+		} else {
+			t.Errorf("Unexpected reST:\n\n%s", ret)
+		}
+	}
+}
+
+func TestHelpEnvAnnotationFormat(t *testing.T) {
+	oldEnv := NewEnvSnapshot()
+	defer oldEnv.Restore()
+
+	os.Setenv("APP_LEVEL", "3")
+	os.Unsetenv("APP_TOKEN")
+
+	var opts struct {
+		Level int    `long:"level" env:"APP_LEVEL" description:"The log level"`
+		Token string `long:"token" env:"APP_TOKEN" description:"The API token"`
+		Name  string `long:"name" description:"The name"`
+	}
+
+	p := NewNamedParser("TestHelpEnvAnnotationFormat", None)
+	p.AddGroup("Application Options", "", &opts)
+
+	p.EnvAnnotationFormat = func(opt *Option) string {
+		key := opt.EnvKeyWithNamespace()
+
+		if value, ok := os.LookupEnv(key); ok {
+			return fmt.Sprintf("(env: %s=%s)", key, value)
+		}
+
+		return ""
+	}
+
+	var buf bytes.Buffer
+	p.WriteHelp(&buf)
+
+	var expected string
+
+	if runtime.GOOS == "windows" {
+		expected = `Usage:
+  TestHelpEnvAnnotationFormat [OPTIONS]
+
+Application Options:
+  /level:    The log level (env: APP_LEVEL=3)
+  /token:    The API token
+  /name:     The name
+`
+	} else {
+		expected = `Usage:
+  TestHelpEnvAnnotationFormat [OPTIONS]
+
+Application Options:
+  --level=   The log level (env: APP_LEVEL=3)
+  --token=   The API token
+  --name=    The name
+`
+	}
+
+	if buf.String() != expected {
+		ret, err := helpDiff(buf.String(), expected)
+
+		if err != nil {
+			t.Errorf("Unexpected help, expected:\n\n%s\n\nbut got\n\n%s", expected, buf.String())
+		} else {
+			t.Errorf("Unexpected help:\n\n%s", ret)
+		}
+	}
+
+	p.EnvAnnotationFormat = func(opt *Option) string {
+		return "{" + opt.EnvKeyWithNamespace() + "}"
+	}
+
+	buf.Reset()
+	p.WriteHelp(&buf)
+
+	if runtime.GOOS == "windows" {
+		expected = `Usage:
+  TestHelpEnvAnnotationFormat [OPTIONS]
+
+Application Options:
+  /level:    The log level {APP_LEVEL}
+  /token:    The API token {APP_TOKEN}
+  /name:     The name
+`
+	} else {
+		expected = `Usage:
+  TestHelpEnvAnnotationFormat [OPTIONS]
+
+Application Options:
+  --level=   The log level {APP_LEVEL}
+  --token=   The API token {APP_TOKEN}
+  --name=    The name
+`
+	}
+
+	if buf.String() != expected {
+		ret, err := helpDiff(buf.String(), expected)
+
+		if err != nil {
+			t.Errorf("Unexpected help, expected:\n\n%s\n\nbut got\n\n%s", expected, buf.String())
+		} else {
+			t.Errorf("Unexpected help:\n\n%s", ret)
+		}
+	}
+}
+
+func TestHelpWidth(t *testing.T) {
+	var opts struct {
+		Verbose bool `short:"v" long:"verbose" description:"Show verbose debug information, which is useful when diagnosing problems with the configuration"`
+	}
+
+	p := NewNamedParser("TestHelpWidth", None)
+	p.AddGroup("Application Options", "", &opts)
+
+	// A pipe is never a terminal, so the help is wrapped at the default
+	// width
+	r, w, err := os.Pipe()
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	defer r.Close()
+
+	p.WriteHelp(w)
+	w.Close()
+
+	got, err := ioutil.ReadAll(r)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var expected string
+
+	if runtime.GOOS == "windows" {
+		expected = `Usage:
+  TestHelpWidth [OPTIONS]
+
+Application Options:
+  /v, /verbose   Show verbose debug information, which is useful when
+                 diagnosing problems with the configuration
+`
+	} else {
+		expected = `Usage:
+  TestHelpWidth [OPTIONS]
+
+Application Options:
+  -v, --verbose  Show verbose debug information, which is useful when
+                 diagnosing problems with the configuration
+`
+	}
+
+	assertString(t, string(got), expected)
+
+	p.HelpWidth = 50
+
+	var buf bytes.Buffer
+	p.WriteHelp(&buf)
+
+	if runtime.GOOS == "windows" {
+		expected = `Usage:
+  TestHelpWidth [OPTIONS]
+
+Application Options:
+  /v, /verbose   Show verbose debug information,
+                 which is useful when diagnosing
+                 problems with the configuration
+`
+	} else {
+		expected = `Usage:
+  TestHelpWidth [OPTIONS]
+
+Application Options:
+  -v, --verbose  Show verbose debug information,
+                 which is useful when diagnosing
+                 problems with the configuration
+`
+	}
+
+	assertString(t, buf.String(), expected)
+}
+
+func TestHelpUseArgv0Name(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	var opts struct {
+		Long bool `short:"l" description:"Use a long listing format"`
+	}
+
+	p := NewNamedParser("", None)
+	p.AddGroup("Application Options", "", &opts)
+
+	p.UseArgv0Name = true
+
+	options := `Application Options:
+  -l  Use a long listing format
+`
+
+	argv0s := map[string]string{
+		"/usr/bin/ls": "ls",
+		"dir":         "dir",
+	}
+
+	if runtime.GOOS == "windows" {
+		options = `Application Options:
+  /l  Use a long listing format
+`
+
+		argv0s = map[string]string{
+			`C:\bin\ls.exe`:  "ls",
+			`dir.EXE`:        "dir",
+			`C:\bin\busybox`: "busybox",
+		}
+	}
+
+	var buf bytes.Buffer
+
+	for argv0, name := range argv0s {
+		os.Args = []string{argv0, "-l"}
+
+		buf.Reset()
+		p.WriteHelp(&buf)
+
+		assertString(t, buf.String(), "Usage:\n  "+name+" [OPTIONS]\n\n"+options)
+	}
+
+	p.Name = "busybox"
+
+	buf.Reset()
+	p.WriteHelp(&buf)
+
+	assertString(t, buf.String(), "Usage:\n  busybox [OPTIONS]\n\n"+options)
+}
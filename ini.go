@@ -3,6 +3,7 @@ package flags
 import (
 	"fmt"
 	"io"
+	"os"
 )
 
 // IniError contains location information on where an error occured.
@@ -27,7 +28,7 @@ func (x *IniError) Error() string {
 	)
 }
 
-// IniOptions for writing
+// IniOptions for writing and parsing
 type IniOptions uint
 
 const (
@@ -45,6 +46,22 @@ const (
 	// of an option should be written.
 	IniIncludeComments
 
+	// IniStrict indicates that, when parsing, unknown sections and options
+	// (including options which cannot be specified in an ini file) result
+	// in an IniError containing the file and line of the offending section
+	// or option, even when the parser ignores unknown options. This option
+	// is used in the ParseOptions of an IniParser.
+	IniStrict
+
+	// IniJoinSlices indicates that the values of a slice option are written
+	// on a single line, separated by commas (e.g. name = a, b), instead of
+	// repeating the option for every value. Values containing a comma, a
+	// double quote or leading or trailing white space are written as
+	// double quoted (Go) strings. When used in the ParseOptions of an
+	// IniParser, the values of slice options are split in the same way,
+	// while repeated options are still accepted.
+	IniJoinSlices
+
 	// IniDefault provides a default set of options.
 	IniDefault = IniIncludeComments
 )
@@ -52,7 +69,11 @@ const (
 // IniParser is a utility to read and write flags options from and to ini
 // formatted strings.
 type IniParser struct {
-	parser *Parser
+	// Options changing the behavior of parsing ini files (e.g. IniStrict)
+	ParseOptions IniOptions
+
+	parser     *Parser
+	provenance map[*Option]iniLocation
 }
 
 // NewIniParser creates a new ini parser for a given Parser.
@@ -87,6 +108,62 @@ func (i *IniParser) ParseFile(filename string) error {
 	return i.parse(ini)
 }
 
+// ParseStandardPaths parses flags from the ini files at the conventional
+// locations of the configuration of the application with the given name. The
+// files are parsed in the following order, such that values in later files
+// override values in earlier files (note that values of slice and map options
+// are accumulated):
+//
+//     On Windows:
+//         1. %ProgramData%\<appName>\config.ini
+//         2. %APPDATA%\<appName>\config.ini
+//         3. <appName>.ini in the current directory
+//
+//     Elsewhere:
+//         1. /etc/<appName>/config.ini
+//         2. $XDG_CONFIG_HOME/<appName>/config.ini (XDG_CONFIG_HOME defaults
+//            to ~/.config)
+//         3. <appName>.ini in the current directory
+//
+// Files which do not exist are skipped. The paths of the files which were
+// parsed are returned, also when an error occurs in one of them.
+func (i *IniParser) ParseStandardPaths(appName string) ([]string, error) {
+	var parsed []string
+
+	for _, filename := range iniStandardPaths(appName) {
+		if _, err := os.Stat(filename); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return parsed, err
+		}
+
+		if err := i.ParseFile(filename); err != nil {
+			return parsed, err
+		}
+
+		parsed = append(parsed, filename)
+	}
+
+	return parsed, nil
+}
+
+// Provenance returns the file and line of the ini value which last set the
+// given option, when parsing ini files using this ini parser. The file is
+// empty for values parsed using Parse. When layering multiple ini files, this
+// identifies the file which the effective value of the option came from. The
+// returned ok is false if no ini value set the option.
+func (i *IniParser) Provenance(opt *Option) (file string, line int, ok bool) {
+	loc, ok := i.provenance[opt]
+
+	if !ok {
+		return "", 0, false
+	}
+
+	return loc.file, int(loc.line), true
+}
+
 // Parse parses flags from an ini format. You can use ParseFile as a
 // convenience function to parse from a filename instead of a general
 // io.Reader.
@@ -138,3 +215,14 @@ func (i *IniParser) WriteFile(filename string, options IniOptions) error {
 func (i *IniParser) Write(writer io.Writer, options IniOptions) {
 	writeIni(i, writer, options)
 }
+
+// WriteExample writes an example ini file which can be used as a starting
+// point for a configuration file. Unlike Write, every option which can be
+// specified in an ini file is written, commented out and set to its default
+// value (if any), regardless of its current value. Required options are
+// marked with a "(required)" comment. Descriptions of options are written as
+// comments when options contains IniIncludeComments (as does IniDefault); the
+// other ini options are ignored.
+func (i *IniParser) WriteExample(writer io.Writer, options IniOptions) {
+	writeIniExample(i, writer, options)
+}
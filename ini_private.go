@@ -5,18 +5,52 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 )
 
+type iniLocation struct {
+	file string
+	line uint
+}
+
+// description describes the location in an error message.
+func (l iniLocation) description() string {
+	if len(l.file) == 0 {
+		return fmt.Sprintf("on line %d", l.line)
+	}
+
+	return fmt.Sprintf("in file %s line %d", l.file, l.line)
+}
+
+// source describes the location as the source of an Error.
+func (l iniLocation) source() string {
+	if len(l.file) == 0 {
+		return fmt.Sprintf("ini line %d", l.line)
+	}
+
+	return fmt.Sprintf("file %s line %d", l.file, l.line)
+}
+
 type iniValue struct {
-	Name  string
-	Value string
+	Name       string
+	Value      string
+	LineNumber uint
 }
 
 type iniSection []iniValue
-type ini map[string]iniSection
+
+type ini struct {
+	File     string
+	Sections map[string]iniSection
+
+	// The line numbers of the section headers
+	SectionLines map[string]uint
+}
 
 func readFullLine(reader *bufio.Reader) (string, error) {
 	var line []byte
@@ -58,15 +92,19 @@ func optionIniName(option *Option) string {
 	return option.field.Name
 }
 
-func writeGroupIni(group *Group, namespace string, writer io.Writer, options IniOptions) {
-	var sname string
+type iniGroupWriter func(group *Group, sname string, writer io.Writer, options IniOptions)
 
+// iniSectionName returns the name of the ini section of a group, given the
+// namespace (i.e. the path) of the command it belongs to.
+func iniSectionName(group *Group, namespace string) string {
 	if len(namespace) != 0 {
-		sname = namespace + "." + group.ShortDescription
-	} else {
-		sname = group.ShortDescription
+		return namespace + "." + group.ShortDescription
 	}
 
+	return group.ShortDescription
+}
+
+func writeGroupIni(group *Group, sname string, writer io.Writer, options IniOptions) {
 	sectionwritten := false
 	comments := (options & IniIncludeComments) != IniNone
 
@@ -75,7 +113,7 @@ func writeGroupIni(group *Group, namespace string, writer io.Writer, options Ini
 			continue
 		}
 
-		if len(option.tag.Get("no-ini")) != 0 {
+		if !option.canIni() {
 			continue
 		}
 
@@ -90,8 +128,8 @@ func writeGroupIni(group *Group, namespace string, writer io.Writer, options Ini
 			sectionwritten = true
 		}
 
-		if comments && len(option.Description) != 0 {
-			fmt.Fprintf(writer, "; %s\n", option.Description)
+		if desc := option.description(); comments && len(desc) != 0 {
+			fmt.Fprintf(writer, "; %s\n", desc)
 		}
 
 		oname := optionIniName(option)
@@ -103,6 +141,17 @@ func writeGroupIni(group *Group, namespace string, writer io.Writer, options Ini
 
 		switch val.Type().Kind() {
 		case reflect.Slice:
+			if (options&IniJoinSlices) != IniNone && val.Len() != 0 {
+				values := make([]string, val.Len())
+
+				for idx := 0; idx < val.Len(); idx++ {
+					values[idx], _ = convertToString(val.Index(idx), option.tag)
+				}
+
+				fmt.Fprintf(writer, "%s%s = %s\n", commentOption, oname, joinIniList(values))
+				break
+			}
+
 			for idx := 0; idx < val.Len(); idx++ {
 				v, _ := convertToString(val.Index(idx), option.tag)
 				fmt.Fprintf(writer, "%s%s = %s\n", commentOption, oname, v)
@@ -126,7 +175,7 @@ func writeGroupIni(group *Group, namespace string, writer io.Writer, options Ini
 			for _, k := range keys {
 				v, _ := convertToString(val.MapIndex(kkmap[k]), option.tag)
 
-				fmt.Fprintf(writer, "%s%s = %s:%s\n", commentOption, oname, k, v)
+				fmt.Fprintf(writer, "%s%s = %s%s%s\n", commentOption, oname, k, keyValueDelimiter(option.tag), v)
 			}
 
 			if val.Len() == 0 {
@@ -152,26 +201,67 @@ func writeGroupIni(group *Group, namespace string, writer io.Writer, options Ini
 	}
 }
 
-func writeCommandIni(command *Command, namespace string, writer io.Writer, options IniOptions) {
+func writeGroupIniExample(group *Group, sname string, writer io.Writer, options IniOptions) {
+	sectionwritten := false
+	comments := (options & IniIncludeComments) != IniNone
+
+	for _, option := range group.options {
+		if option.isFunc() || !option.canIni() {
+			continue
+		}
+
+		if !sectionwritten {
+			fmt.Fprintf(writer, "[%s]\n", sname)
+			sectionwritten = true
+		}
+
+		if desc := option.description(); comments && len(desc) != 0 {
+			fmt.Fprintf(writer, "; %s\n", desc)
+		}
+
+		if option.Required {
+			fmt.Fprintln(writer, "; (required)")
+		}
+
+		oname := optionIniName(option)
+		defs := option.defaultValues()
+
+		for _, v := range defs {
+			fmt.Fprintf(writer, "; %s = %s\n", oname, v)
+		}
+
+		if len(defs) == 0 {
+			fmt.Fprintf(writer, "; %s =\n", oname)
+		}
+
+		fmt.Fprintln(writer)
+	}
+}
+
+func writeCommandIni(command *Command, namespace string, writer io.Writer, options IniOptions, writeGroup iniGroupWriter) {
 	command.eachGroup(func(group *Group) {
-		writeGroupIni(group, namespace, writer, options)
+		writeGroup(group, iniSectionName(group, namespace), writer, options)
 	})
 
 	for _, c := range command.commands {
 		var nns string
 
 		if len(namespace) != 0 {
-			nns = c.Name + "." + nns
+			nns = namespace + "." + c.Name
 		} else {
 			nns = c.Name
 		}
 
-		writeCommandIni(c, nns, writer, options)
+		writeCommandIni(c, nns, writer, options, writeGroup)
 	}
 }
 
 func writeIni(parser *IniParser, writer io.Writer, options IniOptions) {
-	writeCommandIni(parser.parser.Command, "", writer, options)
+	writeCommandIni(parser.parser.Command, "", writer, options, writeGroupIni)
+}
+
+func writeIniExample(parser *IniParser, writer io.Writer, options IniOptions) {
+	writeCommandIni(parser.parser.Command, "", writer, options, writeGroupIniExample)
 }
 
 func writeIniToFile(parser *IniParser, filename string, options IniOptions) error {
@@ -188,7 +278,35 @@ func writeIniToFile(parser *IniParser, filename string, options IniOptions) erro
 	return nil
 }
 
-func readIniFromFile(filename string) (ini, error) {
+func iniStandardPaths(appName string) []string {
+	var dirs []string
+
+	if runtime.GOOS == "windows" {
+		for _, env := range []string{"ProgramData", "APPDATA"} {
+			if dir := os.Getenv(env); len(dir) != 0 {
+				dirs = append(dirs, dir)
+			}
+		}
+	} else {
+		dirs = append(dirs, "/etc")
+
+		if dir := os.Getenv("XDG_CONFIG_HOME"); len(dir) != 0 {
+			dirs = append(dirs, dir)
+		} else if home, err := os.UserHomeDir(); err == nil {
+			dirs = append(dirs, filepath.Join(home, ".config"))
+		}
+	}
+
+	ret := make([]string, 0, len(dirs)+1)
+
+	for _, dir := range dirs {
+		ret = append(ret, filepath.Join(dir, appName, "config.ini"))
+	}
+
+	return append(ret, appName+".ini")
+}
+
+func readIniFromFile(filename string) (*ini, error) {
 	file, err := os.Open(filename)
 
 	if err != nil {
@@ -200,8 +318,12 @@ func readIniFromFile(filename string) (ini, error) {
 	return readIni(file, filename)
 }
 
-func readIni(contents io.Reader, filename string) (ini, error) {
-	ret := make(ini)
+func readIni(contents io.Reader, filename string) (*ini, error) {
+	ret := &ini{
+		File:         filename,
+		Sections:     make(map[string]iniSection),
+		SectionLines: make(map[string]uint),
+	}
 
 	reader := bufio.NewReader(contents)
 
@@ -209,7 +331,7 @@ func readIni(contents io.Reader, filename string) (ini, error) {
 	section := make(iniSection, 0, 10)
 	sectionname := ""
 
-	ret[sectionname] = section
+	ret.Sections[sectionname] = section
 
 	var lineno uint
 
@@ -250,11 +372,12 @@ func readIni(contents io.Reader, filename string) (ini, error) {
 			}
 
 			sectionname = name
-			section = ret[name]
+			section = ret.Sections[name]
 
 			if section == nil {
 				section = make(iniSection, 0, 10)
-				ret[name] = section
+				ret.Sections[name] = section
+				ret.SectionLines[name] = lineno
 			}
 
 			continue
@@ -275,11 +398,12 @@ func readIni(contents io.Reader, filename string) (ini, error) {
 		value := strings.TrimSpace(keyval[1])
 
 		section = append(section, iniValue{
-			Name:  name,
-			Value: value,
+			Name:       name,
+			Value:      value,
+			LineNumber: lineno,
 		})
 
-		ret[sectionname] = section
+		ret.Sections[sectionname] = section
 	}
 
 	return ret, nil
@@ -305,29 +429,39 @@ func (i *IniParser) matchingGroups(name string) []*Group {
 	return nil
 }
 
-func (i *IniParser) parse(ini ini) error {
+func (i *IniParser) parse(ini *ini) error {
 	p := i.parser
+	strict := (i.ParseOptions & IniStrict) != IniNone
 
-	for name, section := range ini {
+	for name, section := range ini.Sections {
 		groups := i.matchingGroups(name)
 
 		if len(groups) == 0 {
-			return newError(
-				ErrUnknownGroup,
-				fmt.Sprintf("could not find option group `%s'", name),
-			)
+			msg := fmt.Sprintf("could not find option group `%s'", name)
+
+			if strict {
+				return &IniError{
+					Message:    msg,
+					File:       ini.File,
+					LineNumber: ini.SectionLines[name],
+				}
+			}
+
+			return newError(ErrUnknownGroup, msg)
 		}
 
 		for _, inival := range section {
 			var opt *Option
+			noIni := false
 
 			for _, group := range groups {
 				opt = group.optionByName(inival.Name, func(o *Option, n string) bool {
 					return strings.ToLower(o.tag.Get("ini-name")) == strings.ToLower(n)
 				})
 
-				if opt != nil && len(opt.tag.Get("no-ini")) != 0 {
+				if opt != nil && !opt.canIni() {
 					opt = nil
+					noIni = true
 				}
 
 				if opt != nil {
@@ -336,6 +470,20 @@ func (i *IniParser) parse(ini ini) error {
 			}
 
 			if opt == nil {
+				if strict {
+					msg := fmt.Sprintf("unknown option: %s", inival.Name)
+
+					if noIni {
+						msg = fmt.Sprintf("option cannot be specified in an ini file: %s", inival.Name)
+					}
+
+					return &IniError{
+						Message:    msg,
+						File:       ini.File,
+						LineNumber: inival.LineNumber,
+					}
+				}
+
 				if (p.Options & IgnoreUnknown) == None {
 					return newError(
 						ErrUnknownFlag,
@@ -346,19 +494,121 @@ func (i *IniParser) parse(ini ini) error {
 				continue
 			}
 
-			pval := &inival.Value
+			if err := opt.checkFeature(); err != nil {
+				return err
+			}
+
+			values := []string{inival.Value}
+
+			if (i.ParseOptions&IniJoinSlices) != IniNone && opt.value.Kind() == reflect.Slice {
+				var err error
 
-			if !opt.canArgument() && len(inival.Value) == 0 {
-				pval = nil
+				if values, err = splitIniList(inival.Value); err != nil {
+					return &IniError{
+						Message:    fmt.Sprintf("%s (%s)", err, inival.Name),
+						File:       ini.File,
+						LineNumber: inival.LineNumber,
+					}
+				}
+			}
+
+			// Values replace the default values of slices and maps
+			if opt.defaulted {
+				opt.empty()
+				opt.defaulted = false
+			}
+
+			for _, value := range values {
+				pval := &value
+
+				if !opt.canArgument() && len(value) == 0 {
+					pval = nil
+				}
+
+				if err := opt.set(pval); err != nil {
+					loc := iniLocation{file: ini.File, line: inival.LineNumber}
+
+					msg := fmt.Sprintf("invalid value `%s' for ini option `%s' of flag `%s' %s (expected %s): %s",
+						value, inival.Name, opt, loc.description(), opt.value.Type(), err)
+
+					return withErrorSource(wrapMarshalError(err, msg), loc.source())
+				}
 			}
 
-			if err := opt.set(pval); err != nil {
-				return wrapError(err)
+			opt.source = SourceIni
+
+			if i.provenance == nil {
+				i.provenance = make(map[*Option]iniLocation)
 			}
 
+			i.provenance[opt] = iniLocation{file: ini.File, line: inival.LineNumber}
 			opt.tag.Set("_read-ini-name", inival.Name)
 		}
 	}
 
 	return nil
 }
+
+// joinIniList joins values into a comma separated list, quoting values which
+// cannot be represented literally.
+func joinIniList(values []string) string {
+	quoted := make([]string, len(values))
+
+	for i, v := range values {
+		if len(v) == 0 || strings.ContainsAny(v, ",\"") || strings.TrimSpace(v) != v {
+			quoted[i] = strconv.Quote(v)
+		} else {
+			quoted[i] = v
+		}
+	}
+
+	return strings.Join(quoted, ", ")
+}
+
+// splitIniList splits a comma separated list written by joinIniList.
+func splitIniList(value string) ([]string, error) {
+	var ret []string
+
+	for len(value) != 0 {
+		var item string
+
+		value = strings.TrimLeft(value, " \t")
+
+		if strings.HasPrefix(value, "\"") {
+			quoted, err := strconv.QuotedPrefix(value)
+
+			if err != nil {
+				return nil, fmt.Errorf("malformed quoted value in list")
+			}
+
+			item, _ = strconv.Unquote(quoted)
+			value = strings.TrimLeft(value[len(quoted):], " \t")
+
+			if len(value) != 0 && value[0] != ',' {
+				return nil, fmt.Errorf("expected comma after quoted value in list")
+			}
+		} else {
+			idx := strings.IndexByte(value, ',')
+
+			if idx < 0 {
+				idx = len(value)
+			}
+
+			item = strings.TrimSpace(value[:idx])
+			value = value[idx:]
+		}
+
+		ret = append(ret, item)
+
+		if len(value) != 0 {
+			// Skip the comma, a trailing comma denotes a final empty value
+			value = value[1:]
+
+			if len(strings.TrimSpace(value)) == 0 {
+				ret = append(ret, "")
+			}
+		}
+	}
+
+	return ret, nil
+}
@@ -2,10 +2,15 @@ package flags
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestWriteIni(t *testing.T) {
@@ -327,6 +332,125 @@ value = some value
 	assertError(t, err, ErrUnknownFlag, "unknown option: value")
 }
 
+func TestWriteIniExample(t *testing.T) {
+	var opts struct {
+		Name    string   `long:"name" description:"The name" required:"yes"`
+		Level   int      `long:"level" description:"The level" default:"3"`
+		Include []string `long:"include" default:"a" default:"b"`
+		Secret  string   `long:"secret" no-ini:"yes"`
+		Verbose func()   `long:"verbose"`
+	}
+
+	p := NewNamedParser("TestIni", Default)
+	p.AddGroup("Application Options", "The application options", &opts)
+
+	opts.Level = 5
+
+	inip := NewIniParser(p)
+
+	var b bytes.Buffer
+	inip.WriteExample(&b, IniDefault)
+
+	expected := `[Application Options]
+; The name
+; (required)
+; Name =
+
+; The level
+; Level = 3
+
+; Include = a
+; Include = b
+
+`
+
+	if b.String() != expected {
+		msg, _ := helpDiff(b.String(), expected)
+		t.Errorf("Unexpected ini example:\n\n%s", msg)
+	}
+}
+
+func TestIniStrict(t *testing.T) {
+	var opts struct {
+		Value string `long:"value"`
+		NoIni string `long:"no-ini-value" no-ini:"yes"`
+	}
+
+	p := NewNamedParser("TestIni", IgnoreUnknown)
+	p.AddGroup("Application Options", "The application options", &opts)
+
+	inip := NewIniParser(p)
+	inip.ParseOptions = IniStrict
+
+	tests := []struct {
+		contents string
+		message  string
+		line     uint
+	}{
+		{
+			"[Application Options]\nvalue = 1\nother = 2\n",
+			"unknown option: other",
+			3,
+		},
+		{
+			"[Application Options]\nno-ini-value = 1\n",
+			"option cannot be specified in an ini file: no-ini-value",
+			2,
+		},
+		{
+			"value = 1\n\n[Other Options]\nvalue = 2\n",
+			"could not find option group `Other Options'",
+			3,
+		},
+	}
+
+	for _, test := range tests {
+		err := inip.Parse(strings.NewReader(test.contents))
+
+		if err == nil {
+			t.Fatalf("Expected error for %q", test.contents)
+		}
+
+		inierr, ok := err.(*IniError)
+
+		if !ok {
+			t.Fatalf("Expected IniError but got %T: %s", err, err)
+		}
+
+		assertString(t, inierr.Message, test.message)
+
+		if inierr.LineNumber != test.line {
+			t.Errorf("Expected error on line %d but got %d", test.line, inierr.LineNumber)
+		}
+	}
+
+	// Without IniStrict, unknown options are ignored
+	inip.ParseOptions = IniNone
+
+	if err := inip.Parse(strings.NewReader("value = 1\nother = 2\n")); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	assertString(t, opts.Value, "1")
+}
+
+func TestIniInvalidValue(t *testing.T) {
+	var opts struct {
+		Value int8 `long:"value"`
+	}
+
+	p := NewNamedParser("TestIni", Default)
+	p.AddGroup("Application Options", "The application options", &opts)
+
+	inip := NewIniParser(p)
+
+	err := inip.Parse(strings.NewReader("value = 300\n"))
+	assertError(t, err, ErrRange, fmt.Sprintf("invalid value `300' for ini option `value' of flag `%svalue' on line 1 (expected int8): strconv.ParseInt: parsing \"300\": value out of range", defaultLongOptDelimiter))
+
+	err = inip.Parse(strings.NewReader("\nvalue = x\n"))
+	assertError(t, err, ErrMarshal, fmt.Sprintf("invalid value `x' for ini option `value' of flag `%svalue' on line 2 (expected int8): strconv.ParseInt: parsing \"x\": invalid syntax", defaultLongOptDelimiter))
+}
+
 func TestIniParse(t *testing.T) {
 	file, err := ioutil.TempFile("", "")
 	if err != nil {
@@ -459,3 +583,351 @@ func TestOverwriteRequiredOptions(t *testing.T) {
 		}
 	}
 }
+
+type iniDurationSizeOptions struct {
+	Timeout time.Duration `long:"timeout"`
+	Size    ByteSize      `long:"size"`
+	Sizes   []ByteSize    `long:"sizes"`
+}
+
+func TestIniDurationByteSize(t *testing.T) {
+	var opts iniDurationSizeOptions
+
+	p := NewNamedParser("TestIni", Default)
+	p.AddGroup("Application Options", "The application options", &opts)
+
+	if _, err := p.ParseArgs([]string{"--timeout", "30s", "--size", "10MB", "--sizes", "1KiB", "--sizes", "1536", "--sizes", "1.5GB"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	NewIniParser(p).Write(&buf, IniDefault)
+
+	expected := `[Application Options]
+Timeout = 30s
+
+Size = 10MB
+
+Sizes = 1KiB
+Sizes = 1536B
+Sizes = 1500MB
+
+`
+
+	assertString(t, buf.String(), expected)
+
+	var opts2 iniDurationSizeOptions
+
+	p2 := NewNamedParser("TestIni", Default)
+	p2.AddGroup("Application Options", "The application options", &opts2)
+
+	if err := NewIniParser(p2).Parse(&buf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(opts, opts2) {
+		t.Errorf("Expected %+v after round trip, but got %+v", opts, opts2)
+	}
+}
+
+func TestIniCommandsSharedNames(t *testing.T) {
+	type Conn struct {
+		Host string `long:"host"`
+
+		TLS struct {
+			Cert string `long:"cert"`
+		} `group:"TLS Options"`
+	}
+
+	var opts struct {
+		Pull struct {
+			Conn
+
+			Remote struct {
+				Conn
+			} `command:"remote" description:"Pull remote"`
+		} `command:"pull" description:"Pull changes"`
+
+		Push struct {
+			Conn
+		} `command:"push" description:"Push changes"`
+	}
+
+	p := NewNamedParser("TestIni", Default)
+	p.AddGroup("Application Options", "The application options", &opts)
+
+	opts.Pull.Host = "pull.example.com"
+	opts.Pull.TLS.Cert = "pull.pem"
+	opts.Pull.Remote.Host = "remote.example.com"
+	opts.Push.Host = "push.example.com"
+
+	inip := NewIniParser(p)
+
+	var b bytes.Buffer
+	inip.Write(&b, IniNone)
+
+	expected := `[pull.Pull changes]
+Host = pull.example.com
+
+[pull.TLS Options]
+Cert = pull.pem
+
+[pull.remote.Pull remote]
+Host = remote.example.com
+
+[push.Push changes]
+Host = push.example.com
+
+`
+
+	if b.String() != expected {
+		msg, _ := helpDiff(b.String(), expected)
+		t.Fatalf("Unexpected ini:\n\n%s", msg)
+	}
+
+	opts.Pull.Host = ""
+	opts.Pull.TLS.Cert = ""
+	opts.Pull.Remote.Host = ""
+	opts.Push.Host = ""
+
+	if err := inip.Parse(strings.NewReader(expected)); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	assertString(t, opts.Pull.Host, "pull.example.com")
+	assertString(t, opts.Pull.TLS.Cert, "pull.pem")
+	assertString(t, opts.Pull.Remote.Host, "remote.example.com")
+	assertString(t, opts.Pull.Remote.TLS.Cert, "")
+	assertString(t, opts.Push.Host, "push.example.com")
+	assertString(t, opts.Push.TLS.Cert, "")
+
+	// Sections named after the command path only are also accepted
+	if err := inip.Parse(strings.NewReader("[pull]\nhost = a\n\n[pull.remote]\nhost = b\n\n[push]\nhost = c\n")); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	assertString(t, opts.Pull.Host, "a")
+	assertString(t, opts.Pull.Remote.Host, "b")
+	assertString(t, opts.Push.Host, "c")
+}
+
+func TestIniJoinSlices(t *testing.T) {
+	var opts struct {
+		Tags  []string `long:"tag"`
+		Ports []int    `long:"port"`
+	}
+
+	p := NewNamedParser("TestIni", None)
+	p.AddGroup("Application Options", "", &opts)
+
+	values := []string{"a", "b,c", "", " padded ", "with \"quotes\"", "last"}
+
+	opts.Tags = values
+	opts.Ports = []int{80, 443}
+
+	inip := NewIniParser(p)
+
+	tests := []struct {
+		options  IniOptions
+		expected string
+	}{
+		{
+			IniJoinSlices,
+			`[Application Options]
+Tags = a, "b,c", "", " padded ", "with \"quotes\"", last
+Ports = 80, 443
+
+`,
+		},
+		{
+			IniNone,
+			`[Application Options]
+Tags = a
+Tags = b,c
+Tags = 
+Tags =  padded 
+Tags = with "quotes"
+Tags = last
+Ports = 80
+Ports = 443
+
+`,
+		},
+	}
+
+	for _, test := range tests {
+		opts.Tags = values
+		opts.Ports = []int{80, 443}
+
+		var b bytes.Buffer
+		inip.Write(&b, test.options)
+
+		if b.String() != test.expected {
+			msg, _ := helpDiff(b.String(), test.expected)
+			t.Errorf("Unexpected ini with options %d:\n\n%s", test.options, msg)
+		}
+
+		opts.Tags = nil
+		opts.Ports = nil
+
+		inip.ParseOptions = test.options
+
+		if err := inip.Parse(strings.NewReader(b.String())); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		if test.options == IniJoinSlices {
+			assertStringArray(t, opts.Tags, values)
+		} else {
+			// Leading and trailing white space is not preserved in
+			// repeated values
+			assertStringArray(t, opts.Tags, []string{"a", "b,c", "", "padded", "with \"quotes\"", "last"})
+		}
+
+		if !reflect.DeepEqual(opts.Ports, []int{80, 443}) {
+			t.Errorf("Expected ports [80 443] but got %v", opts.Ports)
+		}
+	}
+
+	// Repeated options are accepted when joining slices
+	inip.ParseOptions = IniJoinSlices
+	opts.Tags = nil
+
+	if err := inip.Parse(strings.NewReader("tag = a, b\ntag = c\n")); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	assertStringArray(t, opts.Tags, []string{"a", "b", "c"})
+
+	err := inip.Parse(strings.NewReader("tag = \"a\" b\n"))
+
+	if err == nil {
+		t.Fatalf("Expected error")
+	}
+
+	assertString(t, err.Error(), ":1: expected comma after quoted value in list (tag)")
+}
+
+func TestIniParseStandardPaths(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("standard paths differ on windows")
+	}
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Cannot create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	oldEnv := NewEnvSnapshot()
+	defer oldEnv.Restore()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Cannot get working directory: %s", err)
+	}
+	defer os.Chdir(wd)
+
+	appName := "go-flags-standard-paths-test"
+	userDir := filepath.Join(dir, "config", appName)
+
+	if err := os.MkdirAll(userDir, 0755); err != nil {
+		t.Fatalf("Cannot create directory: %s", err)
+	}
+
+	userFile := filepath.Join(userDir, "config.ini")
+
+	if err := ioutil.WriteFile(userFile, []byte("Name = user\nLevel = 1\n"), 0644); err != nil {
+		t.Fatalf("Cannot write file: %s", err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, appName+".ini"), []byte("Level = 2\n"), 0644); err != nil {
+		t.Fatalf("Cannot write file: %s", err)
+	}
+
+	os.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Cannot change directory: %s", err)
+	}
+
+	var opts struct {
+		Name  string `long:"name"`
+		Level int    `long:"level"`
+	}
+
+	p := NewParser(&opts, Default)
+	parsed, err := NewIniParser(p).ParseStandardPaths(appName)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	assertStringArray(t, parsed, []string{userFile, appName + ".ini"})
+	assertString(t, opts.Name, "user")
+
+	if opts.Level != 2 {
+		t.Errorf("Expected Level to be 2 but got %d", opts.Level)
+	}
+}
+
+func TestIniProvenance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Cannot create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	system := filepath.Join(dir, "system.ini")
+	user := filepath.Join(dir, "user.ini")
+
+	if err := ioutil.WriteFile(system, []byte("[Application Options]\nName = system\nLevel = 1\n"), 0644); err != nil {
+		t.Fatalf("Cannot write file: %s", err)
+	}
+
+	if err := ioutil.WriteFile(user, []byte("; user overrides\n\nLevel = 2\n"), 0644); err != nil {
+		t.Fatalf("Cannot write file: %s", err)
+	}
+
+	var opts struct {
+		Name    string `long:"name"`
+		Level   int    `long:"level"`
+		Verbose bool   `long:"verbose"`
+	}
+
+	p := NewParser(&opts, Default)
+	inip := NewIniParser(p)
+
+	for _, filename := range []string{system, user} {
+		if err := inip.ParseFile(filename); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+	}
+
+	options := p.Groups()[0].Options()
+
+	for i, expected := range []struct {
+		file string
+		line int
+		ok   bool
+	}{
+		{system, 2, true},
+		{user, 3, true},
+		{"", 0, false},
+	} {
+		file, line, ok := inip.Provenance(options[i])
+
+		if file != expected.file || line != expected.line || ok != expected.ok {
+			t.Errorf("Expected provenance of %s to be %s:%d (%v) but got %s:%d (%v)",
+				options[i], expected.file, expected.line, expected.ok, file, line, ok)
+		}
+	}
+
+	if err := inip.Parse(strings.NewReader("\nverbose = true\n")); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if file, line, ok := inip.Provenance(options[2]); file != "" || line != 2 || !ok {
+		t.Errorf("Expected provenance of %s to be :2 but got %s:%d (%v)", options[2], file, line, ok)
+	}
+}
@@ -0,0 +1,184 @@
+package flags
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"reflect"
+	"time"
+)
+
+type jsonSchema map[string]interface{}
+
+// WriteJSONSchema writes a JSON Schema describing the configuration of the
+// parser to the given writer, e.g. to provide completion and validation of
+// configuration files in editors. The options of each group are properties
+// of an object, keyed by their ini name (see the ini-name tag). Groups and
+// commands are nested objects keyed by their short description and name
+// respectively, like the sections of an ini file. Option types are mapped
+// to schema types (e.g. slices to arrays and maps to objects), choices to an
+// enum, the range of integer types to a minimum and maximum, required
+// options to the required properties and descriptions to schema
+// descriptions. Options which cannot be specified in an ini file, as well as
+// function options and the built-in help group, are omitted.
+func (p *Parser) WriteJSONSchema(writer io.Writer) error {
+	schema := p.Command.jsonSchema()
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+
+	if len(p.Name) != 0 {
+		schema["title"] = p.Name
+	}
+
+	data, err := json.MarshalIndent(schema, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	data = append(data, '\n')
+
+	_, err = writer.Write(data)
+	return err
+}
+
+func (c *Command) jsonSchema() jsonSchema {
+	schema := c.Group.jsonSchema()
+
+	properties := schema["properties"].(jsonSchema)
+
+	for _, cc := range c.commands {
+		properties[cc.Name] = cc.jsonSchema()
+	}
+
+	return schema
+}
+
+func (g *Group) jsonSchema() jsonSchema {
+	properties := jsonSchema{}
+	var required []string
+
+	for _, option := range g.options {
+		if option.isFunc() || !option.canIni() {
+			continue
+		}
+
+		name := optionIniName(option)
+		properties[name] = option.jsonSchema()
+
+		if option.Required {
+			required = append(required, name)
+		}
+	}
+
+	for _, group := range g.groups {
+		if group.isBuiltinHelp {
+			continue
+		}
+
+		properties[group.ShortDescription] = group.jsonSchema()
+	}
+
+	schema := jsonSchema{
+		"type":       "object",
+		"properties": properties,
+	}
+
+	if len(g.LongDescription) != 0 {
+		schema["description"] = g.LongDescription
+	} else if len(g.ShortDescription) != 0 {
+		schema["description"] = g.ShortDescription
+	}
+
+	if len(required) != 0 {
+		schema["required"] = required
+	}
+
+	return schema
+}
+
+func (option *Option) jsonSchema() jsonSchema {
+	var schema jsonSchema
+
+	// The names of the bits of an option with the bits tag are its
+	// choices, but its value is a list of names
+	if len(option.tag.Get("bits")) != 0 {
+		schema = jsonSchema{"type": "string"}
+	} else {
+		schema = jsonSchemaForType(option.value.Type(), option.choices)
+	}
+
+	if desc := option.description(); len(desc) != 0 {
+		schema["description"] = desc
+	}
+
+	return schema
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func jsonSchemaForType(tp reflect.Type, choices []string) jsonSchema {
+	for tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+
+	// Types with their own conversion are specified as strings
+	if tp == durationType || reflect.PtrTo(tp).Implements(reflect.TypeOf((*Unmarshaler)(nil)).Elem()) {
+		return withJSONSchemaEnum(jsonSchema{"type": "string"}, choices)
+	}
+
+	switch tp.Kind() {
+	case reflect.Slice:
+		return jsonSchema{
+			"type":  "array",
+			"items": jsonSchemaForType(tp.Elem(), choices),
+		}
+	case reflect.Map:
+		return jsonSchema{
+			"type":                 "object",
+			"additionalProperties": jsonSchemaForType(tp.Elem(), choices),
+		}
+	case reflect.Bool:
+		return withJSONSchemaEnum(jsonSchema{"type": "boolean"}, choices)
+	case reflect.Float32, reflect.Float64:
+		return withJSONSchemaEnum(jsonSchema{"type": "number"}, choices)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		shift := uint(64 - tp.Bits())
+		schema := jsonSchema{"type": "integer"}
+
+		if tp.Kind() >= reflect.Uint && tp.Kind() <= reflect.Uint64 {
+			schema["minimum"] = 0
+			schema["maximum"] = uint64(math.MaxUint64) >> shift
+		} else {
+			schema["minimum"] = int64(math.MinInt64) >> shift
+			schema["maximum"] = int64(math.MaxInt64) >> shift
+		}
+
+		return withJSONSchemaEnum(schema, choices)
+	}
+
+	return withJSONSchemaEnum(jsonSchema{"type": "string"}, choices)
+}
+
+// withJSONSchemaEnum adds the choices of an option as enum to the schema,
+// converting them to the type of the schema.
+func withJSONSchemaEnum(schema jsonSchema, choices []string) jsonSchema {
+	if len(choices) == 0 {
+		return schema
+	}
+
+	enum := make([]interface{}, len(choices))
+
+	for i, choice := range choices {
+		var value interface{} = choice
+
+		if schema["type"] != "string" {
+			json.Unmarshal([]byte(choice), &value)
+		}
+
+		enum[i] = value
+	}
+
+	schema["enum"] = enum
+	return schema
+}
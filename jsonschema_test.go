@@ -0,0 +1,118 @@
+package flags
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteJSONSchema(t *testing.T) {
+	var opts struct {
+		Verbose bool              `short:"v" long:"verbose" description:"Verbose output"`
+		Level   string            `long:"level" choice:"info" choice:"debug" required:"yes"`
+		Retries uint8             `long:"retries" ini-name:"retry-count"`
+		Ratio   float64           `long:"ratio"`
+		Tags    []string          `long:"tag"`
+		Labels  map[string]int    `long:"label"`
+		Mode    int               `long:"mode" choice:"1" choice:"2"`
+		Secret  string            `long:"secret" no-ini:"yes"`
+		Call    func()            `long:"call"`
+		Extra   map[string]string `long:"extra" env-only:"yes" env:"EXTRA"`
+
+		Server struct {
+			Host string `long:"host" description:"The host"`
+		} `group:"Server"`
+
+		Deploy struct {
+			Force bool `long:"force"`
+		} `command:"deploy"`
+	}
+
+	p := NewNamedParser("app", None)
+	p.AddGroup("Application Options", "", &opts)
+
+	var buf bytes.Buffer
+
+	if err := p.WriteJSONSchema(&buf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "properties": {
+    "Application Options": {
+      "description": "Application Options",
+      "properties": {
+        "Labels": {
+          "additionalProperties": {
+            "maximum": 9223372036854775807,
+            "minimum": -9223372036854775808,
+            "type": "integer"
+          },
+          "type": "object"
+        },
+        "Level": {
+          "enum": [
+            "info",
+            "debug"
+          ],
+          "type": "string"
+        },
+        "Mode": {
+          "enum": [
+            1,
+            2
+          ],
+          "maximum": 9223372036854775807,
+          "minimum": -9223372036854775808,
+          "type": "integer"
+        },
+        "Ratio": {
+          "type": "number"
+        },
+        "Server": {
+          "description": "Server",
+          "properties": {
+            "Host": {
+              "description": "The host",
+              "type": "string"
+            }
+          },
+          "type": "object"
+        },
+        "Tags": {
+          "items": {
+            "type": "string"
+          },
+          "type": "array"
+        },
+        "Verbose": {
+          "description": "Verbose output",
+          "type": "boolean"
+        },
+        "retry-count": {
+          "maximum": 255,
+          "minimum": 0,
+          "type": "integer"
+        }
+      },
+      "required": [
+        "Level"
+      ],
+      "type": "object"
+    },
+    "deploy": {
+      "properties": {
+        "Force": {
+          "type": "boolean"
+        }
+      },
+      "type": "object"
+    }
+  },
+  "title": "app",
+  "type": "object"
+}
+`
+
+	assertString(t, buf.String(), expected)
+}
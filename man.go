@@ -7,7 +7,23 @@ import (
 	"time"
 )
 
+// escapeForMan escapes text for roff. Backslashes are written as \e and
+// lines starting with a control character (. or ') are prefixed with \&.
+func escapeForMan(s string) string {
+	lines := strings.Split(strings.Replace(s, "\\", "\\e", -1), "\n")
+
+	for i, line := range lines {
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			lines[i] = "\\&" + line
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
 func formatForMan(wr io.Writer, s string) {
+	s = escapeForMan(s)
+
 	for {
 		idx := strings.IndexRune(s, '`')
 
@@ -31,39 +47,69 @@ func formatForMan(wr io.Writer, s string) {
 	}
 }
 
+// manOptionName returns the names of an option as shown in the man page
+// (e.g. -v, --verbose).
+func manOptionName(opt *Option) string {
+	var names []string
+
+	if opt.ShortName != 0 {
+		names = append(names, "-"+string(opt.ShortName))
+	}
+
+	if len(opt.LongName) != 0 {
+		names = append(names, "--"+opt.LongNameWithNamespace())
+	}
+
+	return strings.Join(names, ", ")
+}
+
 func writeManPageOptions(wr io.Writer, grp *Group) {
 	grp.eachGroup(func(group *Group) {
+		// The long description of the group of a command is the long
+		// description of the command itself
+		describe := group != grp && len(group.LongDescription) != 0
+
 		for _, opt := range group.options {
-			if !opt.canCli() {
+			if !opt.isVisible() {
 				continue
 			}
 
-			fmt.Fprintln(wr, ".TP")
-			fmt.Fprintf(wr, "\\fB")
-
-			if opt.ShortName != 0 {
-				fmt.Fprintf(wr, "-%c", opt.ShortName)
-			}
-
-			if len(opt.LongName) != 0 {
-				if opt.ShortName != 0 {
-					fmt.Fprintf(wr, ", ")
-				}
-
-				fmt.Fprintf(wr, "--%s", opt.LongNameWithNamespace())
+			if describe {
+				fmt.Fprintln(wr, ".PP")
+				formatForMan(wr, group.LongDescription)
+				fmt.Fprintln(wr, "")
+				describe = false
 			}
 
-			fmt.Fprintln(wr, "\\fP")
-			if len(opt.Description) != 0 {
-				formatForMan(wr, opt.Description)
+			fmt.Fprintln(wr, ".TP")
+			fmt.Fprintf(wr, "\\fB%s\\fP\n", manOptionName(opt))
+			if desc := opt.description(); len(desc) != 0 {
+				formatForMan(wr, desc)
 				fmt.Fprintln(wr, "")
 			}
 		}
 	})
 }
 
+func writeManPageArgs(wr io.Writer, args []*Arg) {
+	for _, arg := range args {
+		fmt.Fprintln(wr, ".TP")
+
+		if arg.isRemaining() {
+			fmt.Fprintf(wr, "\\fB%s\\fP...\n", arg.Name)
+		} else {
+			fmt.Fprintf(wr, "\\fB%s\\fP\n", arg.Name)
+		}
+
+		if len(arg.Description) != 0 {
+			formatForMan(wr, arg.Description)
+			fmt.Fprintln(wr, "")
+		}
+	}
+}
+
 func writeManPageSubcommands(wr io.Writer, name string, root *Command) {
-	commands := root.sortedCommands()
+	commands := root.visibleCommands()
 
 	for _, c := range commands {
 		var nn string
@@ -103,6 +149,7 @@ func writeManPageCommand(wr io.Writer, name string, command *Command) {
 	}
 
 	writeManPageOptions(wr, command.Group)
+	writeManPageArgs(wr, command.args)
 	writeManPageSubcommands(wr, name, command)
 }
 
@@ -118,23 +165,99 @@ func (p *Parser) WriteManPage(wr io.Writer) {
 
 	usage := p.Usage
 
-	if len(usage) == 0 {
+	if len(usage) == 0 && p.hasOptions() {
 		usage = "[OPTIONS]"
 	}
 
-	fmt.Fprintf(wr, "\\fB%s\\fP %s\n", p.Name, usage)
+	if len(usage) != 0 {
+		fmt.Fprintf(wr, "\\fB%s\\fP %s\n", p.Name, usage)
+	} else {
+		fmt.Fprintf(wr, "\\fB%s\\fP\n", p.Name)
+	}
 	fmt.Fprintln(wr, ".SH DESCRIPTION")
 
 	formatForMan(wr, p.LongDescription)
 	fmt.Fprintln(wr, "")
 
-	fmt.Fprintln(wr, ".SH OPTIONS")
+	if p.hasOptions() {
+		fmt.Fprintln(wr, ".SH OPTIONS")
 
-	writeManPageOptions(wr, p.Command.Group)
+		writeManPageOptions(wr, p.Command.Group)
+	}
 
-	if len(p.commands) > 0 {
+	if len(p.args) > 0 {
+		fmt.Fprintln(wr, ".SH ARGUMENTS")
+
+		writeManPageArgs(wr, p.args)
+	}
+
+	if len(p.visibleCommands()) > 0 {
 		fmt.Fprintln(wr, ".SH COMMANDS")
 
 		writeManPageSubcommands(wr, "", p.Command)
 	}
+
+	if env := p.manPageEnvOptions(); len(env) > 0 {
+		fmt.Fprintln(wr, ".SH ENVIRONMENT")
+
+		writeManPageEnv(wr, env)
+	}
+
+	if len(p.ManFiles) > 0 {
+		fmt.Fprintln(wr, ".SH FILES")
+
+		for i, file := range p.ManFiles {
+			if i > 0 {
+				fmt.Fprintln(wr, ".br")
+			}
+
+			fmt.Fprintf(wr, "\\fI%s\\fP\n", escapeForMan(file))
+		}
+	}
+}
+
+// manPageEnvOptions returns the visible options of the parser and its
+// commands which can be set from the environment.
+func (p *Parser) manPageEnvOptions() []*Option {
+	var ret []*Option
+
+	var walk func(c *Command)
+
+	walk = func(c *Command) {
+		c.eachGroup(func(g *Group) {
+			for _, opt := range g.options {
+				if opt.isHelpVisible() && len(opt.EnvKeyWithNamespace()) != 0 {
+					ret = append(ret, opt)
+				}
+			}
+		})
+
+		for _, cc := range c.visibleCommands() {
+			walk(cc)
+		}
+	}
+
+	walk(p.Command)
+	return ret
+}
+
+func writeManPageEnv(wr io.Writer, options []*Option) {
+	for _, opt := range options {
+		fmt.Fprintln(wr, ".TP")
+		fmt.Fprintf(wr, "\\fB%s\\fP\n", opt.EnvKeyWithNamespace())
+
+		if opt.canCli() {
+			fmt.Fprintf(wr, "Default for \\fB%s\\fP.", manOptionName(opt))
+
+			if desc := opt.description(); len(desc) != 0 {
+				fmt.Fprint(wr, " ")
+				formatForMan(wr, desc)
+			}
+
+			fmt.Fprintln(wr, "")
+		} else if desc := opt.description(); len(desc) != 0 {
+			formatForMan(wr, desc)
+			fmt.Fprintln(wr, "")
+		}
+	}
 }
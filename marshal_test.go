@@ -1,8 +1,11 @@
 package flags
 
 import (
+	"bytes"
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 )
 
 type marshalled bool
@@ -95,3 +98,262 @@ func TestMarshalError(t *testing.T) {
 
 	assertError(t, err, ErrMarshal, "Failed to marshal")
 }
+
+type normalized string
+
+func (n normalized) Normalize(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+
+	if len(value) == 0 {
+		return "", fmt.Errorf("empty value")
+	}
+
+	return value, nil
+}
+
+func TestNormalize(t *testing.T) {
+	var opts = struct {
+		Value  normalized   `short:"v"`
+		Values []normalized `short:"s"`
+		Ptr    *normalized  `short:"p"`
+	}{}
+
+	assertParseSuccess(t, &opts, "-v", " Hello ", "-s", "A", "-s", "b ", "-p", "PTR")
+
+	assertString(t, string(opts.Value), "hello")
+
+	if len(opts.Values) != 2 || opts.Values[0] != "a" || opts.Values[1] != "b" {
+		t.Errorf("Expected Values to be [a b], but got %v", opts.Values)
+	}
+
+	if opts.Ptr == nil || *opts.Ptr != "ptr" {
+		t.Errorf("Expected Ptr to be ptr, but got %v", opts.Ptr)
+	}
+}
+
+func TestNormalizeChecks(t *testing.T) {
+	var opts = struct {
+		Color  normalized            `long:"color" choice:"red,blue"`
+		Colors []normalized          `long:"colors" sep:"," choice:"red,blue"`
+		Labels map[normalized]string `long:"label"`
+
+		Args struct {
+			Name normalized
+		} `positional-args:"yes"`
+	}{}
+
+	assertParseSuccess(t, &opts, "--color=RED", "--colors", "Blue, RED", "--label", "KEY:Value", " ARG")
+
+	assertString(t, string(opts.Color), "red")
+
+	if len(opts.Colors) != 2 || opts.Colors[0] != "blue" || opts.Colors[1] != "red" {
+		t.Errorf("Expected Colors to be [blue red], but got %v", opts.Colors)
+	}
+
+	if opts.Labels["key"] != "Value" {
+		t.Errorf("Expected Labels to be map[key:Value], but got %v", opts.Labels)
+	}
+
+	assertString(t, string(opts.Args.Name), "arg")
+
+	assertParseFail(t, ErrInvalidChoice, "invalid value `green' for flag `--color', allowed values are: red or blue", &opts, "--color=GREEN")
+}
+
+func TestNormalizeError(t *testing.T) {
+	var opts = struct {
+		Value normalized `short:"v"`
+	}{}
+
+	assertParseFail(t, ErrMarshal, "invalid argument for flag `-v' (expected flags.normalized): empty value", &opts, "-v", " ")
+}
+
+func TestConvertRangeError(t *testing.T) {
+	var opts = struct {
+		Value int8 `short:"v"`
+		Other int8 `short:"o"`
+	}{}
+
+	assertParseFail(t, ErrRange, "invalid argument for flag `-v' (expected int8): strconv.ParseInt: parsing \"300\": value out of range", &opts, "-v", "300")
+	assertParseFail(t, ErrMarshal, "invalid argument for flag `-o' (expected int8): strconv.ParseInt: parsing \"x\": invalid syntax", &opts, "-o", "x")
+}
+
+func TestByteSize(t *testing.T) {
+	var tests = []struct {
+		value    string
+		expected ByteSize
+		str      string
+	}{
+		{"0", 0, "0B"},
+		{"512", 512, "512B"},
+		{"10MB", 10 * Megabyte, "10MB"},
+		{"10 mb", 10 * Megabyte, "10MB"},
+		{"4k", 4 * Kilobyte, "4KB"},
+		{"2GiB", 2 * Gibibyte, "2GiB"},
+		{"1.5KiB", 1536, "1536B"},
+		{"3T", 3 * Terabyte, "3TB"},
+	}
+
+	for _, test := range tests {
+		var opts = struct {
+			Size ByteSize `long:"size"`
+		}{}
+
+		assertParseSuccess(t, &opts, "--size", test.value)
+
+		if opts.Size != test.expected {
+			t.Errorf("Expected %s to be %d bytes, but got %d", test.value, test.expected, opts.Size)
+		}
+
+		assertString(t, opts.Size.String(), test.str)
+	}
+
+	var opts = struct {
+		Size ByteSize `long:"size"`
+	}{}
+
+	assertParseFail(t, ErrMarshal, "invalid argument for flag `--size' (expected flags.ByteSize): invalid unit `XB' in byte size `10XB'", &opts, "--size", "10XB")
+	assertParseFail(t, ErrMarshal, "invalid argument for flag `--size' (expected flags.ByteSize): invalid byte size `MB'", &opts, "--size", "MB")
+	assertParseFail(t, ErrRange, "invalid argument for flag `--size' (expected flags.ByteSize): strconv.ParseUint: parsing \"20000000TB\": value out of range", &opts, "--size", "20000000TB")
+	assertParseFail(t, ErrRange, "invalid argument for flag `--size' (expected flags.ByteSize): strconv.ParseFloat: parsing \"16777216.5TiB\": value out of range", &opts, "--size", "16777216.5TiB")
+	assertParseFail(t, ErrRange, "invalid argument for flag `--size' (expected flags.ByteSize): strconv.ParseFloat: parsing \"20000000000000000000.5\": value out of range", &opts, "--size", "20000000000000000000.5")
+}
+
+func TestOrderedStringMap(t *testing.T) {
+	var opts = struct {
+		Headers OrderedStringMap `long:"header"`
+	}{}
+
+	assertParseSuccess(t, &opts, "--header", "X-B:2", "--header", "X-A:1", "--header", "X-C", "--header", "X-B:3:4")
+	assertStringArray(t, opts.Headers.Keys(), []string{"X-B", "X-A", "X-C"})
+
+	for _, kv := range []KeyValue{{"X-B", "3:4"}, {"X-A", "1"}, {"X-C", ""}} {
+		if v, ok := opts.Headers.Get(kv.Key); !ok || v != kv.Value {
+			t.Errorf("Expected %s to be %q but got %q", kv.Key, kv.Value, v)
+		}
+	}
+
+	if _, ok := opts.Headers.Get("X-D"); ok {
+		t.Errorf("Expected X-D not to exist")
+	}
+
+	p := NewParser(&opts, Default)
+	inip := NewIniParser(p)
+
+	var b bytes.Buffer
+	inip.Write(&b, IniNone)
+
+	expected := "[Application Options]\nHeaders = X-B:3:4\nHeaders = X-A:1\nHeaders = X-C:\n\n"
+	assertString(t, b.String(), expected)
+
+	opts.Headers = nil
+
+	if err := inip.Parse(strings.NewReader("header = z:1\nheader = a:2\n")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertStringArray(t, opts.Headers.Keys(), []string{"z", "a"})
+}
+
+func TestStringList(t *testing.T) {
+	var opts = struct {
+		Names StringList `long:"name" sep:","`
+		Hosts StringList `long:"host" default:"localhost"`
+	}{}
+
+	assertParseSuccess(t, &opts, "--name", "a")
+
+	if v, ok := opts.Names.One(); !ok || v != "a" {
+		t.Errorf("Expected a single value a but got %q (%v)", v, ok)
+	}
+
+	if v, ok := opts.Hosts.One(); !ok || v != "localhost" {
+		t.Errorf("Expected a single value localhost but got %q (%v)", v, ok)
+	}
+
+	opts.Names, opts.Hosts = nil, nil
+
+	p, _ := assertParserSuccess(t, &opts, "--name", "a,b", "--name", "c", "--host", "x", "--host", "y")
+
+	assertStringArray(t, opts.Names, []string{"a", "b", "c"})
+	assertStringArray(t, opts.Hosts, []string{"x", "y"})
+
+	if _, ok := opts.Names.One(); ok {
+		t.Errorf("Expected more than one value")
+	}
+
+	var b bytes.Buffer
+	NewIniParser(p).Write(&b, IniNone)
+
+	expected := "[Application Options]\nNames = a\nNames = b\nNames = c\nHosts = x\nHosts = y\n\n"
+	assertString(t, b.String(), expected)
+
+	opts.Names = nil
+
+	if err := NewIniParser(p).Parse(strings.NewReader("Names = z\n")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if v, ok := opts.Names.One(); !ok || v != "z" {
+		t.Errorf("Expected a single value z but got %q (%v)", v, ok)
+	}
+}
+
+func TestOptDuration(t *testing.T) {
+	var opts struct {
+		Timeout OptDuration `long:"timeout" sentinel:"never,none,0" default:"30s" description:"The timeout"`
+		Retry   OptDuration `long:"retry"`
+	}
+
+	p, _ := assertParserSuccess(t, &opts)
+
+	if opts.Timeout != (OptDuration{Duration: 30 * time.Second}) {
+		t.Errorf("Expected default timeout of 30s, but got %v", opts.Timeout)
+	}
+
+	for _, value := range []string{"never", "NONE", "0"} {
+		if _, err := p.ParseArgs([]string{"--timeout", value}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if opts.Timeout != (OptDuration{Disabled: true}) {
+			t.Errorf("Expected %s to disable the timeout, but got %v", value, opts.Timeout)
+		}
+	}
+
+	if _, err := p.ParseArgs([]string{"--timeout", "1m", "--retry", "5s"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if opts.Timeout != (OptDuration{Duration: time.Minute}) {
+		t.Errorf("Expected timeout of 1m, but got %v", opts.Timeout)
+	}
+
+	if opts.Retry != (OptDuration{Duration: 5 * time.Second}) {
+		t.Errorf("Expected retry of 5s, but got %v", opts.Retry)
+	}
+
+	_, err := p.ParseArgs([]string{"--retry", "never"})
+	assertError(t, err, ErrMarshal, "invalid argument for flag `--retry' (expected flags.OptDuration): time: invalid duration \"never\"")
+
+	opts.Timeout = OptDuration{Disabled: true}
+
+	var buf bytes.Buffer
+	NewIniParser(p).Write(&buf, IniIncludeDefaults)
+
+	if !strings.Contains(buf.String(), "Timeout = never\n") {
+		t.Errorf("Expected disabled timeout to be written as never, but got:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	p.WriteHelp(&buf)
+
+	if !strings.Contains(buf.String(), "--timeout=[DURATION|never|none|0]") {
+		t.Errorf("Expected help to document the sentinel words, but got:\n%s", buf.String())
+	}
+
+	var invalid struct {
+		Timeout time.Duration `long:"timeout" sentinel:"never"`
+	}
+
+	assertParseFail(t, ErrTag, "option `--timeout' has sentinels but is not an OptDuration", &invalid)
+}
@@ -0,0 +1,76 @@
+package flags
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// OptDuration is an option value type for durations which can be disabled,
+// such as a timeout which can be turned off. A value is either a duration
+// (see time.ParseDuration) or one of the sentinel words of the sentinel tag
+// (e.g. sentinel:"never,none"), which disables the duration. Sentinel words
+// are matched case insensitively. Include 0 in the sentinel words to have a
+// value of 0 disable the duration as well. The sentinel words are shown as
+// the value name in the help message (e.g. --timeout=[DURATION|never|none]).
+type OptDuration struct {
+	// The duration, if not disabled
+	Duration time.Duration
+
+	// Whether the duration is disabled by a sentinel word
+	Disabled bool
+}
+
+var optDurationType = reflect.TypeOf(OptDuration{})
+
+// sentinels returns the sentinel words of the sentinel tag.
+func sentinels(options multiTag) []string {
+	tag := options.Get("sentinel")
+
+	if len(tag) == 0 {
+		return nil
+	}
+
+	var ret []string
+
+	for _, word := range strings.Split(tag, ",") {
+		ret = append(ret, strings.TrimSpace(word))
+	}
+
+	return ret
+}
+
+// convertOptDuration converts a duration or sentinel word to an OptDuration.
+func convertOptDuration(val string, retval reflect.Value, options multiTag) error {
+	for _, word := range sentinels(options) {
+		if strings.EqualFold(val, word) {
+			retval.Set(reflect.ValueOf(OptDuration{Disabled: true}))
+			return nil
+		}
+	}
+
+	parsed, err := time.ParseDuration(val)
+
+	if err != nil {
+		return err
+	}
+
+	retval.Set(reflect.ValueOf(OptDuration{Duration: parsed}))
+	return nil
+}
+
+// optDurationToString converts an OptDuration to a string, using the first
+// sentinel word for a disabled duration.
+func optDurationToString(val reflect.Value, options multiTag) string {
+	d := val.Interface().(OptDuration)
+
+	if d.Disabled {
+		if words := sentinels(options); len(words) != 0 {
+			return words[0]
+		}
+
+		return ""
+	}
+
+	return d.Duration.String()
+}
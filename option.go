@@ -6,6 +6,40 @@ import (
 	"unicode/utf8"
 )
 
+// ValueSource indicates where the value of an option came from.
+type ValueSource uint
+
+const (
+	// SourceDefault indicates that the option has its default value, or
+	// the value it had before parsing if it has no default.
+	SourceDefault ValueSource = iota
+
+	// SourceEnv indicates that the value was read from the environment.
+	SourceEnv
+
+	// SourceIni indicates that the value was read from an ini file.
+	SourceIni
+
+	// SourceCommandLine indicates that the value was specified on the
+	// command line.
+	SourceCommandLine
+)
+
+func (s ValueSource) String() string {
+	switch s {
+	case SourceDefault:
+		return "default"
+	case SourceEnv:
+		return "env"
+	case SourceIni:
+		return "ini"
+	case SourceCommandLine:
+		return "cli"
+	}
+
+	return "unknown"
+}
+
 // Option flag information. Contains a description of the option, short and
 // long name as well as a default value and whether an argument for this
 // flag is optional.
@@ -14,6 +48,12 @@ type Option struct {
 	// automatically in the built-in help.
 	Description string
 
+	// A function providing the description of the option flag when the
+	// help or man page is written. This is useful for descriptions which
+	// contain dynamic data (e.g. the names of available plugins). If nil,
+	// Description is used.
+	DescriptionFunc func() string
+
 	// The short name of the option (a single character). If not 0, the
 	// option flag can be 'activated' using -<ShortName>. Either ShortName
 	// or LongName needs to be non-empty.
@@ -45,6 +85,11 @@ type Option struct {
 	// error.
 	Required bool
 
+	// If true, the option is not shown in the help, man page or
+	// completions (see also Parser.ShowHidden). The option can still be
+	// specified on the command line.
+	Hidden bool
+
 	// A name for the value of an option shown in the Help as --flag [ValueName]
 	ValueName string
 
@@ -53,6 +98,24 @@ type Option struct {
 	// passwords.
 	DefaultMask string
 
+	// The name of an environment variable from which the default value of
+	// the option is read when the option is not specified on the command
+	// line. The key is prefixed with the env namespaces of the groups the
+	// option belongs to (see EnvKeyWithNamespace).
+	EnvDefaultKey string
+
+	// Deprecated names of the environment variable, which are read (in
+	// order) when the environment variable named by EnvDefaultKey is not
+	// set. Reading the value from one of them adds a warning to the parser
+	// (see Parser.Warnings). Unlike EnvDefaultKey, the names are used as
+	// is, without env namespaces.
+	EnvAliasKeys []string
+
+	// The delimiter used to split the value of the environment variable
+	// into multiple values for slice and map options. If empty, the value
+	// of the environment variable is used as a single value.
+	EnvDefaultDelim string
+
 	// The group which the option belongs to
 	group *Group
 
@@ -62,6 +125,39 @@ type Option struct {
 	// The struct field value which the option represents.
 	value reflect.Value
 
+	// The values allowed for the option, or empty if any value is allowed
+	choices []string
+
+	// Values which are replaced by a canonical value, see the aliases tag
+	valueAliases map[string]string
+
+	// The function computing the default value at parse time, if any
+	defaultFunc func() string
+
+	// Formats the default value of the option in the help, see
+	// Group.SetDefaultFormatter
+	defaultFormatter func(value interface{}) string
+
+	// Converts values of the option instead of the built-in conversion,
+	// see SetValueParser
+	valueParser func(raw string) (interface{}, error)
+
+	// Where the current value of the option came from
+	source ValueSource
+
+	// The options which cannot be specified together with the option, see
+	// the conflicts tag
+	conflicts []*Option
+
+	// Whether the default value of the option is a template which still
+	// needs to be resolved
+	pendingDefault bool
+
+	// Whether the current value of the option is its default value or its
+	// value from the environment, which is replaced (rather than added to
+	// for slices and maps) when the option is set
+	defaulted bool
+
 	iniUsedName string
 	tag         multiTag
 	isSet       bool
@@ -79,45 +175,78 @@ func (option *Option) LongNameWithNamespace() string {
 	// fetch the namespace delimiter from the parser which is always at the
 	// end of the group hierarchy
 	namespaceDelimiter := ""
-	g := option.group
 
-	for {
-		if p, ok := g.parent.(*Parser); ok {
-			namespaceDelimiter = p.NamespaceDelimiter
-
-			break
-		}
-
-		switch i := g.parent.(type) {
-		case *Command:
-			g = i.Group
-		case *Group:
-			g = i
-		}
+	if p := option.group.parser(); p != nil {
+		namespaceDelimiter = p.NamespaceDelimiter
 	}
 
 	// concatenate long name with namespace
 	longName := option.LongName
-	g = option.group
+	g := option.group
 
 	for g != nil {
+		if g.Prefix != "" {
+			longName = g.Prefix + "-" + longName
+		}
+
 		if g.Namespace != "" {
 			longName = g.Namespace + namespaceDelimiter + longName
 		}
 
-		switch i := g.parent.(type) {
-		case *Command:
-			g = i.Group
-		case *Group:
-			g = i
-		case *Parser:
-			g = nil
-		}
+		g = g.parentGroup()
 	}
 
 	return longName
 }
 
+// EnvKeyWithNamespace returns the option's environment variable key with the
+// group env namespaces prepended by walking up the option's group tree.
+// Namespaces and the key itself are separated by the parser's env namespace
+// delimiter. If the env key is empty an empty string is returned.
+func (option *Option) EnvKeyWithNamespace() string {
+	if len(option.EnvDefaultKey) == 0 {
+		return ""
+	}
+
+	delimiter := ""
+
+	if p := option.group.parser(); p != nil {
+		delimiter = p.EnvNamespaceDelimiter
+	}
+
+	key := option.EnvDefaultKey
+	g := option.group
+
+	for g != nil {
+		if g.Prefix != "" {
+			key = g.Prefix + "_" + key
+		}
+
+		if g.EnvNamespace != "" {
+			key = g.EnvNamespace + delimiter + key
+		}
+
+		g = g.parentGroup()
+	}
+
+	return key
+}
+
+// Choices returns the list of values allowed for the option. An empty list
+// means that any value is allowed.
+func (option *Option) Choices() []string {
+	ret := make([]string, len(option.choices))
+	copy(ret, option.choices)
+
+	return ret
+}
+
+// IsRequired returns whether the option must be specified (on the command
+// line, in an ini file or through its environment variable).
+func (option *Option) IsRequired() bool {
+	return option.Required
+}
+
 // String converts an option to a human friendly readable string describing the
 // option.
 func (option *Option) String() string {
@@ -147,3 +276,23 @@ func (option *Option) String() string {
 func (option *Option) Value() interface{} {
 	return option.value.Interface()
 }
+
+// SetValueParser sets a function used to convert the values of the option
+// (from the command line, the environment, an ini file or the default),
+// instead of the built-in conversion. This allows options with a custom
+// grammar, e.g. --route='/api -> backend:8080' for a map option. The
+// function receives the value as specified and returns the converted
+// value, which must be assignable to the type of the option. For slice
+// options, the result can also be an element, which is appended, and for
+// map options, the entries of the resulting map are added to the map of the
+// option. An error returned by the function is reported as an invalid
+// argument for the option.
+func (option *Option) SetValueParser(parser func(raw string) (interface{}, error)) {
+	option.valueParser = parser
+}
+
+// Source returns where the current value of the option came from (the
+// command line, an ini file, the environment or the default).
+func (option *Option) Source() ValueSource {
+	return option.source
+}
@@ -1,7 +1,18 @@
 package flags
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
 )
 
 // Set the value of an option to the specified value. An error will be returned
@@ -10,17 +21,545 @@ import (
 func (option *Option) set(value *string) error {
 	option.isSet = true
 
+	if value != nil && len(option.tag.Get("secret")) != 0 {
+		resolved, err := option.resolveSecret(*value)
+
+		if err != nil {
+			return err
+		}
+
+		value = &resolved
+	}
+
+	if value == nil {
+		if option.isFunc() {
+			return option.call(nil)
+		}
+
+		return convert("", option.value, option.tag)
+	}
+
+	// Values converted as a whole are checked as a whole, other values
+	// are checked for each of their elements (see convertValue)
+	if option.isFunc() || option.valueParser != nil || len(option.tag.Get("bits")) != 0 {
+		checked, err := option.checkValue(*value)
+
+		if err != nil {
+			return err
+		}
+
+		value = &checked
+	}
+
 	if option.isFunc() {
 		return option.call(value)
-	} else if value != nil {
-		return convert(*value, option.value, option.tag)
 	}
 
-	return convert("", option.value, option.tag)
+	if len(option.tag.Get("bits")) != 0 {
+		return option.setBits(*value)
+	}
+
+	start := 0
+
+	if val := reflect.Indirect(option.value); val.Kind() == reflect.Slice {
+		start = val.Len()
+	}
+
+	if option.valueParser != nil {
+		if err := option.parseValue(*value); err != nil {
+			return err
+		}
+	} else if err := option.convertValue(*value, option.value); err != nil {
+		return err
+	}
+
+	if err := option.checkUnique(start); err != nil {
+		return err
+	}
+
+	option.dedup()
+
+	return option.checkPath()
+}
+
+// splitValue splits the value of a slice or map option into its elements
+// using the separator given by the sep tag (see splitSeparated). Values of
+// other options are a single element.
+func (option *Option) splitValue(value string) []string {
+	tp := option.value.Type()
+
+	for tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+
+	if tp.Kind() == reflect.Slice || tp.Kind() == reflect.Map {
+		return splitSeparated(value, option.tag)
+	}
+
+	return []string{value}
+}
+
+// checkValue checks a single element of the value of an option before it is
+// converted. The value is normalized (see Normalizer), value aliases are
+// replaced by their canonical value, empty values are rejected for non-empty
+// options, units are stripped and choices are checked. It returns the value
+// to convert.
+func (option *Option) checkValue(value string) (string, error) {
+	tp := option.value.Type()
+
+	if option.isFunc() && tp.NumIn() > 0 {
+		tp = tp.In(0)
+	}
+
+	value, err := normalizeValue(value, tp, option.tag)
+
+	if err != nil {
+		return "", err
+	}
+
+	if canonical, ok := option.valueAliases[value]; ok {
+		value = canonical
+	}
+
+	if len(value) == 0 && len(option.tag.Get("non-empty")) != 0 {
+		return "", newErrorf(ErrEmptyValue, "flag `%s' cannot have an empty value", option)
+	}
+
+	if len(option.tag.Get("unit")) != 0 {
+		number, err := option.stripUnit(value)
+
+		if err != nil {
+			return "", err
+		}
+
+		value = number
+	}
+
+	// The choices of an option with the bits tag are the names of its
+	// bits, which are checked by setBits
+	if len(option.choices) != 0 && len(option.tag.Get("bits")) == 0 {
+		if err := option.checkChoice(value); err != nil {
+			return "", err
+		}
+	}
+
+	return value, nil
+}
+
+// convertValue splits the value of the option into its elements, checks
+// each element (see checkValue) and converts it into retval.
+func (option *Option) convertValue(value string, retval reflect.Value) error {
+	for _, v := range option.splitValue(value) {
+		checked, err := option.checkValue(v)
+
+		if err != nil {
+			return err
+		}
+
+		if err := convert(checked, retval, option.tag); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseValueAliases parses the value of an aliases tag (e.g.
+// use1=us-east-1,virginia=us-east-1) into a map from alias to canonical
+// value.
+func parseValueAliases(tag string) (map[string]string, bool) {
+	ret := make(map[string]string)
+
+	for _, item := range strings.Split(tag, ",") {
+		parts := strings.SplitN(item, "=", 2)
+
+		if len(parts) != 2 || len(strings.TrimSpace(parts[0])) == 0 {
+			return nil, false
+		}
+
+		ret[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	return ret, true
+}
+
+// parseValue converts a value using the value parser of the option (see
+// Option.SetValueParser) and stores the result in the option.
+func (option *Option) parseValue(value string) error {
+	result, err := option.valueParser(value)
+
+	if err != nil {
+		return err
+	}
+
+	val := option.value
+	tp := val.Type()
+	rv := reflect.ValueOf(result)
+
+	if rv.IsValid() {
+		switch {
+		case rv.Type().AssignableTo(tp) && tp.Kind() == reflect.Map:
+			if val.IsNil() {
+				val.Set(reflect.MakeMap(tp))
+			}
+
+			for _, k := range rv.MapKeys() {
+				val.SetMapIndex(k, rv.MapIndex(k))
+			}
+
+			return nil
+		case rv.Type().AssignableTo(tp) && tp.Kind() == reflect.Slice:
+			val.Set(reflect.AppendSlice(val, rv))
+			return nil
+		case rv.Type().AssignableTo(tp):
+			val.Set(rv)
+			return nil
+		case tp.Kind() == reflect.Slice && rv.Type().AssignableTo(tp.Elem()):
+			val.Set(reflect.Append(val, rv))
+			return nil
+		}
+	}
+
+	return newErrorf(ErrMarshal, "value parser of flag `%s' returned %T (expected %s)", option, result, tp)
+}
+
+// checkUnique validates that the values which were added to a slice option
+// with the unique tag, starting at index start, do not equal any of the
+// values before them (including each other, when a single value adds
+// several values, e.g. using the sep tag). Values are compared after
+// conversion.
+func (option *Option) checkUnique(start int) error {
+	if len(option.tag.Get("unique")) == 0 {
+		return nil
+	}
+
+	val := reflect.Indirect(option.value)
+
+	if val.Kind() != reflect.Slice {
+		return nil
+	}
+
+	if start > val.Len() {
+		start = 0
+	}
+
+	for i := start; i < val.Len(); i++ {
+		item := val.Index(i).Interface()
+
+		for j := 0; j < i; j++ {
+			if reflect.DeepEqual(val.Index(j).Interface(), item) {
+				s, err := convertToString(val.Index(i), option.tag)
+
+				if err != nil {
+					s = fmt.Sprintf("%v", item)
+				}
+
+				return newErrorf(ErrDuplicatedValue, "value `%s' was specified more than once for flag `%s'", s, option)
+			}
+		}
+	}
+
+	return nil
+}
+
+// dedup removes the values of a slice option with the dedup tag which equal
+// a value before them, preserving the order of the remaining values. Values
+// are compared after conversion.
+func (option *Option) dedup() {
+	if len(option.tag.Get("dedup")) == 0 {
+		return
+	}
+
+	val := reflect.Indirect(option.value)
+
+	if val.Kind() != reflect.Slice {
+		return
+	}
+
+	n := 0
+
+	for i := 0; i < val.Len(); i++ {
+		item := val.Index(i).Interface()
+		seen := false
+
+		for j := 0; j < n; j++ {
+			if reflect.DeepEqual(val.Index(j).Interface(), item) {
+				seen = true
+				break
+			}
+		}
+
+		if !seen {
+			val.Index(n).Set(val.Index(i))
+			n++
+		}
+	}
+
+	val.SetLen(n)
+}
+
+// checkPath validates the path which was last set as the value of an option
+// with the must-exist, readable or writable tags.
+func (option *Option) checkPath() error {
+	mustExist := option.tag.Get("must-exist")
+	readable := len(option.tag.Get("readable")) != 0
+	writable := len(option.tag.Get("writable")) != 0
+
+	if len(mustExist) == 0 && !readable && !writable {
+		return nil
+	}
+
+	val := reflect.Indirect(option.value)
+
+	if val.Kind() == reflect.Slice {
+		if val.Len() == 0 {
+			return nil
+		}
+
+		val = reflect.Indirect(val.Index(val.Len() - 1))
+	}
+
+	if val.Kind() != reflect.String {
+		return nil
+	}
+
+	path := val.String()
+	info, err := os.Stat(path)
+
+	if err != nil && (!os.IsNotExist(err) || len(mustExist) != 0 || readable) {
+		if os.IsNotExist(err) {
+			return newErrorf(ErrInvalidPath, "path `%s' of flag `%s' does not exist", path, option)
+		}
+
+		return newErrorf(ErrInvalidPath, "invalid path `%s' of flag `%s': %s", path, option, err)
+	}
+
+	switch mustExist {
+	case "file":
+		if info.IsDir() {
+			return newErrorf(ErrInvalidPath, "path `%s' of flag `%s' is not a file", path, option)
+		}
+	case "dir":
+		if !info.IsDir() {
+			return newErrorf(ErrInvalidPath, "path `%s' of flag `%s' is not a directory", path, option)
+		}
+	}
+
+	if readable {
+		f, err := os.Open(path)
+
+		if err != nil {
+			return newErrorf(ErrInvalidPath, "path `%s' of flag `%s' is not readable", path, option)
+		}
+
+		f.Close()
+	}
+
+	if writable && !isWritable(path, info) {
+		return newErrorf(ErrInvalidPath, "path `%s' of flag `%s' is not writable", path, option)
+	}
+
+	return nil
+}
+
+// isWritable returns whether the file or directory at path (with the given
+// info, or nil if it does not exist) can be written. A path which does not
+// exist is writable if a file can be created in its directory.
+func isWritable(path string, info os.FileInfo) bool {
+	if info != nil && !info.IsDir() {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+
+		if err != nil {
+			return false
+		}
+
+		f.Close()
+		return true
+	}
+
+	dir := path
+
+	if info == nil {
+		dir = filepath.Dir(path)
+	}
+
+	f, err := ioutil.TempFile(dir, ".writable")
+
+	if err != nil {
+		return false
+	}
+
+	f.Close()
+	os.Remove(f.Name())
+
+	return true
+}
+
+func (option *Option) resolveSecret(value string) (string, error) {
+	p := option.group.parser()
+
+	if p == nil || p.SecretResolver == nil || len(p.SecretPrefix) == 0 || !strings.HasPrefix(value, p.SecretPrefix) {
+		return value, nil
+	}
+
+	resolved, err := p.SecretResolver(value)
+
+	if err != nil {
+		return "", newErrorf(ErrMarshal, "cannot resolve secret `%s' for flag `%s': %s", value, option, err)
+	}
+
+	return resolved, nil
+}
+
+func (option *Option) checkChoice(value string) error {
+	for _, choice := range option.choices {
+		if choice == value {
+			return nil
+		}
+	}
+
+	allowed := option.choices[0]
+
+	if len(option.choices) > 1 {
+		allowed = fmt.Sprintf("%s or %s",
+			strings.Join(option.choices[:len(option.choices)-1], ", "),
+			option.choices[len(option.choices)-1])
+	}
+
+	return newErrorf(ErrInvalidChoice,
+		"invalid value `%s' for flag `%s', allowed values are: %s",
+		value, option, allowed)
+}
+
+func (option *Option) helpValueName() string {
+	if len(option.ValueName) != 0 {
+		return option.ValueName
+	}
+
+	if len(option.choices) != 0 {
+		return "[" + strings.Join(option.choices, "|") + "]"
+	}
+
+	if words := sentinels(option.tag); len(words) != 0 {
+		return "[DURATION|" + strings.Join(words, "|") + "]"
+	}
+
+	return ""
 }
 
 func (option *Option) canCli() bool {
-	return option.ShortName != 0 || len(option.LongName) != 0
+	return !option.isEnvOnly() && (option.ShortName != 0 || len(option.LongName) != 0)
+}
+
+func (option *Option) isEnvOnly() bool {
+	return len(option.tag.Get("env-only")) != 0
+}
+
+// canIni returns whether the option can be read from and written to ini
+// files.
+func (option *Option) canIni() bool {
+	return !option.isEnvOnly() && len(option.tag.Get("no-ini")) == 0
+}
+
+// featureEnabled returns whether the feature required by the option (if
+// any) is enabled.
+func (option *Option) featureEnabled() bool {
+	feature := option.tag.Get("requires-feature")
+
+	if len(feature) == 0 {
+		return true
+	}
+
+	p := option.group.parser()
+	return p != nil && p.EnabledFeatures[feature]
+}
+
+func (option *Option) checkFeature() error {
+	if option.featureEnabled() {
+		return nil
+	}
+
+	return newErrorf(ErrFeatureDisabled,
+		"flag `%s' is an experimental option; enable it with the `%s' feature",
+		option, option.tag.Get("requires-feature"))
+}
+
+func (option *Option) description() string {
+	if option.DescriptionFunc != nil {
+		return option.DescriptionFunc()
+	}
+
+	return option.Description
+}
+
+func (option *Option) isHidden() bool {
+	if option.Hidden || !option.featureEnabled() {
+		return true
+	}
+
+	for g := option.group; g != nil; g = g.parentGroup() {
+		if g.Hidden {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isVisible returns whether the option is shown in the help, man page and
+// completions. Hidden options are only shown when the parser's ShowHidden
+// is set.
+func (option *Option) isVisible() bool {
+	if !option.canCli() {
+		return false
+	}
+
+	return option.isShown()
+}
+
+// isHelpVisible returns whether the option is shown in the help. Unlike
+// isVisible, this includes options which can only be set from the
+// environment.
+func (option *Option) isHelpVisible() bool {
+	if !option.canCli() && !option.isEnvOnly() {
+		return false
+	}
+
+	return option.isShown()
+}
+
+func (option *Option) isShown() bool {
+	if !option.isHidden() {
+		return true
+	}
+
+	p := option.group.parser()
+	return p != nil && p.ShowHidden
+}
+
+func (option *Option) consumesRest() bool {
+	return len(option.tag.Get("consumes-rest")) != 0
+}
+
+func (option *Option) slurps() bool {
+	return len(option.tag.Get("slurp")) != 0
+}
+
+func (option *Option) isShortCircuit() bool {
+	return len(option.tag.Get("short-circuit")) != 0
+}
+
+// hasBoolValue returns whether the option is a bool option accepting an
+// explicit value (see the bool-value tag).
+func (option *Option) hasBoolValue() bool {
+	return len(option.tag.Get("bool-value")) != 0
+}
+
+// isBoolValue returns whether the value is a literal accepted as the
+// explicit value of a bool option with the bool-value tag.
+func isBoolValue(value string) bool {
+	_, err := strconv.ParseBool(value)
+	return err == nil
 }
 
 func (option *Option) canArgument() bool {
@@ -45,12 +584,359 @@ func (option *Option) empty() {
 	option.value.Set(option.emptyValue())
 }
 
-func (option *Option) clearDefault() {
-	if len(option.Default) > 0 {
+func (option *Option) envDefault() (string, []string, error) {
+	return option.envValues(true)
+}
+
+// envValues returns the env key of the option (or the env alias which is
+// set) and the values of its environment variable, if set. When warn is
+// set, the use of a deprecated env alias is reported as a warning.
+func (option *Option) envValues(warn bool) (string, []string, error) {
+	key := option.EnvKeyWithNamespace()
+
+	if len(key) == 0 {
+		return "", nil, nil
+	}
+
+	if p := option.group.parser(); p != nil && p.ignoreEnv {
+		return key, nil, nil
+	}
+
+	value := os.Getenv(key)
+
+	if len(value) == 0 {
+		for _, alias := range option.EnvAliasKeys {
+			if value = os.Getenv(alias); len(value) != 0 {
+				if p := option.group.parser(); p != nil && warn {
+					p.warn(fmt.Sprintf("environment variable `%s' is deprecated, use `%s' instead", alias, key))
+				}
+
+				key = alias
+				break
+			}
+		}
+	}
+
+	if len(value) == 0 {
+		return key, nil, nil
+	}
+
+	if format := option.tag.Get("env-format"); len(format) != 0 {
+		values, err := option.decodeEnvValue(value, format)
+
+		if err != nil {
+			err = newErrorf(ErrMarshal, "invalid value for environment variable `%s' of flag `%s': %s", key, option, err)
+			return key, nil, withErrorSource(err, "environment variable "+key)
+		}
+
+		return key, values, nil
+	}
+
+	if len(option.EnvDefaultDelim) != 0 {
+		return key, strings.Split(value, option.EnvDefaultDelim), nil
+	}
+
+	return key, []string{value}, nil
+}
+
+// decodeEnvValue decodes the structured value of an environment variable
+// (see the env-format tag) into the values of a slice or map option.
+func (option *Option) decodeEnvValue(value string, format string) ([]string, error) {
+	// Strings are used as is, other values (e.g. numbers) are converted
+	// from their JSON representation
+	decode := func(raw json.RawMessage) string {
+		var s string
+
+		if err := json.Unmarshal(raw, &s); err == nil {
+			return s
+		}
+
+		return string(raw)
+	}
+
+	if option.value.Kind() == reflect.Map {
+		var items map[string]json.RawMessage
+
+		if err := json.Unmarshal([]byte(value), &items); err != nil {
+			return nil, err
+		}
+
+		keys := make([]string, 0, len(items))
+
+		for k := range items {
+			keys = append(keys, k)
+		}
+
+		sort.Strings(keys)
+
+		ret := make([]string, len(keys))
+
+		for i, k := range keys {
+			ret[i] = k + keyValueDelimiter(option.tag) + decode(items[k])
+		}
+
+		return ret, nil
+	}
+
+	var items []json.RawMessage
+
+	if err := json.Unmarshal([]byte(value), &items); err != nil {
+		return nil, err
+	}
+
+	ret := make([]string, len(items))
+
+	for i, item := range items {
+		ret[i] = decode(item)
+	}
+
+	return ret, nil
+}
+
+func (option *Option) defaultValues() []string {
+	if len(option.Default) == 0 && option.defaultFunc != nil {
+		return []string{option.defaultFunc()}
+	}
+
+	return option.Default
+}
+
+// parseEnvBool converts the boolean literals accepted in environment
+// variables to a value understood by strconv.ParseBool.
+func parseEnvBool(value string) (string, bool) {
+	switch strings.ToLower(value) {
+	case "1", "true", "yes", "on":
+		return "true", true
+	case "0", "false", "no", "off":
+		return "false", true
+	}
+
+	return "", false
+}
+
+// envConflict returns the env key of the option and whether the value of its
+// environment variable differs from the current value of the option, when
+// the environment variable is set. The values are compared after
+// conversion. The values from the environment are converted into a scratch
+// value, without the side effects of setting the option (e.g. resolving
+// secrets or checking paths).
+func (option *Option) envConflict() (string, bool) {
+	if option.isFunc() || option.valueParser != nil || len(option.tag.Get("secret")) != 0 {
+		return "", false
+	}
+
+	key, envdefs, err := option.envValues(false)
+
+	if err != nil || envdefs == nil {
+		return "", false
+	}
+
+	value := reflect.New(option.value.Type()).Elem()
+
+	for _, d := range envdefs {
+		if option.isBool() {
+			b, ok := parseEnvBool(d)
+
+			if !ok {
+				return "", false
+			}
+
+			d = b
+		}
+
+		if err := option.convertValue(d, value); err != nil {
+			return "", false
+		}
+	}
+
+	return key, !reflect.DeepEqual(value.Interface(), option.value.Interface())
+}
+
+// hasDefaultTemplate returns whether the default value of the option is a
+// template referencing other options (e.g. {{.DataDir}}/logs).
+func (option *Option) hasDefaultTemplate() bool {
+	for _, d := range option.Default {
+		if strings.Contains(d, "{{") {
+			return true
+		}
+	}
+
+	return false
+}
+
+var defaultTemplateAction = regexp.MustCompile(`{{.*?}}`)
+var defaultTemplateField = regexp.MustCompile(`\.([A-Za-z_][A-Za-z0-9_]*)`)
+
+// resolveDefaultTemplate executes the default value template of the option
+// and sets the option to the result. The templates of the options of the
+// same group which are referenced are resolved first. The options being
+// resolved are passed in resolving, to detect cycles.
+func (option *Option) resolveDefaultTemplate(resolving []*Option) error {
+	if !option.pendingDefault {
+		return nil
+	}
+
+	for i, other := range resolving {
+		if other != option {
+			continue
+		}
+
+		if i == len(resolving)-1 {
+			return newErrorf(ErrTag, "default value of option `%s' refers to itself", option)
+		}
+
+		var names []string
+
+		for _, o := range resolving[i:] {
+			names = append(names, "`"+o.String()+"'")
+		}
+
+		return newErrorf(ErrTag, "default values of options refer to each other: %s -> `%s'",
+			strings.Join(names, " -> "), option)
+	}
+
+	resolving = append(resolving, option)
+
+	fields := make(map[string]*Option)
+
+	for _, other := range option.group.options {
+		fields[other.field.Name] = other
+	}
+
+	for _, d := range option.Default {
+		for _, action := range defaultTemplateAction.FindAllString(d, -1) {
+			for _, m := range defaultTemplateField.FindAllStringSubmatch(action, -1) {
+				if other, ok := fields[m[1]]; ok {
+					if err := other.resolveDefaultTemplate(resolving); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	data := make(map[string]interface{})
+
+	for name, other := range fields {
+		if other != option && !other.isFunc() {
+			data[name] = other.value.Interface()
+		}
+	}
+
+	option.pendingDefault = false
+	option.defaulted = true
+	option.empty()
+	option.source = SourceDefault
+
+	for _, d := range option.Default {
+		tmpl, err := template.New(option.field.Name).Option("missingkey=error").Parse(d)
+
+		var buf bytes.Buffer
+
+		if err == nil {
+			err = tmpl.Execute(&buf, data)
+		}
+
+		if err != nil {
+			return newErrorf(ErrTag, "invalid default value `%s' for option `%s': %s", d, option, err)
+		}
+
+		value := buf.String()
+
+		if err := option.set(&value); err != nil {
+			msg := fmt.Sprintf("invalid default value `%s' for flag `%s' (expected %s): %s",
+				value, option, option.value.Type(), err)
+
+			return wrapMarshalError(err, msg)
+		}
+	}
+
+	return nil
+}
+
+// formatDefault formats the default value of the option, given its default
+// values (if any), using the default formatter of the option.
+func (option *Option) formatDefault(defs []string) string {
+	val := option.value
+
+	if len(defs) != 0 {
+		val = reflect.New(option.value.Type()).Elem()
+
+		for _, d := range defs {
+			if err := convert(d, val, option.tag); err != nil {
+				return strings.Join(defs, ", ")
+			}
+		}
+	}
+
+	return option.defaultFormatter(val.Interface())
+}
+
+func (option *Option) clearDefault() error {
+	defs := option.defaultValues()
+	key, envdefs, err := option.envDefault()
+
+	if err != nil {
+		return err
+	}
+
+	if envdefs != nil {
+		defs = envdefs
+	} else if option.source == SourceIni {
+		if p := option.group.parser(); p != nil && p.loading {
+			// Values read from ini files take precedence over defaults
+			return nil
+		}
+	} else if option.hasDefaultTemplate() {
+		// Resolved once all other options have their values, see
+		// Parser.resolveDefaultTemplates
+		option.pendingDefault = true
+		return nil
+	}
+
+	if envdefs != nil {
+		if err := option.checkFeature(); err != nil {
+			return err
+		}
+	}
+
+	// An empty list of values from the environment (e.g. an empty JSON
+	// array) also clears the option
+	if len(defs) > 0 || envdefs != nil {
+		option.defaulted = true
 		option.empty()
 
-		for _, d := range option.Default {
-			option.set(&d)
+		if envdefs != nil {
+			option.source = SourceEnv
+		} else {
+			option.source = SourceDefault
+		}
+
+		for _, d := range defs {
+			if envdefs != nil && option.isBool() && !option.isFunc() {
+				b, ok := parseEnvBool(d)
+
+				if !ok {
+					err := newErrorf(ErrMarshal,
+						"invalid value `%s' for environment variable `%s' of flag `%s' (expected one of 1, 0, true, false, yes, no, on or off)",
+						d, key, option)
+
+					return withErrorSource(err, "environment variable "+key)
+				}
+
+				d = b
+			}
+
+			err := option.set(&d)
+
+			// Errors in default tags are ignored, but values coming
+			// from the environment are user input and are reported
+			if err != nil && envdefs != nil {
+				msg := fmt.Sprintf("invalid value `%s' for environment variable `%s' of flag `%s' (expected %s): %s",
+					d, key, option, option.value.Type(), err)
+
+				return withErrorSource(wrapMarshalError(err, msg), "environment variable "+key)
+			}
 		}
 	} else {
 		tp := option.value.Type()
@@ -66,6 +952,8 @@ func (option *Option) clearDefault() {
 			}
 		}
 	}
+
+	return nil
 }
 
 func (option *Option) valueIsDefault() bool {
@@ -78,10 +966,8 @@ func (option *Option) valueIsDefault() bool {
 
 	checkval.Set(emptyval)
 
-	if len(option.Default) != 0 {
-		for _, v := range option.Default {
-			convert(v, checkval, option.tag)
-		}
+	for _, v := range option.defaultValues() {
+		option.convertValue(v, checkval)
 	}
 
 	return reflect.DeepEqual(option.value.Interface(), checkval.Interface())
@@ -111,6 +997,12 @@ func (option *Option) isUnmarshaler() Unmarshaler {
 	return nil
 }
 
+// isSpecified returns whether a value was specified for the option in the
+// last parse, as opposed to the option having its default value.
+func (option *Option) isSpecified() bool {
+	return option.isSet && option.source != SourceDefault
+}
+
 func (option *Option) isBool() bool {
 	tp := option.value.Type()
 
@@ -1,6 +1,14 @@
 package flags
 
 import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -24,6 +32,32 @@ func TestPassDoubleDash(t *testing.T) {
 	assertStringArray(t, ret, []string{"-v", "-g"})
 }
 
+func TestArgsSeparator(t *testing.T) {
+	var opts = struct {
+		Value bool `short:"v"`
+
+		Positional struct {
+			Rest []string
+		} `positional-args:"yes"`
+	}{}
+
+	p := NewParser(&opts, PassDoubleDash)
+	p.ArgsSeparator = "--args"
+
+	ret, err := p.ParseArgs([]string{"-v", "--args", "-v", "--args", "--"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !opts.Value {
+		t.Errorf("Expected Value to be true")
+	}
+
+	assertStringArray(t, opts.Positional.Rest, []string{"-v", "--args", "--"})
+	assertStringArray(t, ret, []string{})
+}
+
 func TestPassAfterNonOption(t *testing.T) {
 	var opts = struct {
 		Value bool `short:"v"`
@@ -43,3 +77,990 @@ func TestPassAfterNonOption(t *testing.T) {
 
 	assertStringArray(t, ret, []string{"arg", "-v", "-g"})
 }
+
+func TestOptionAccessors(t *testing.T) {
+	var opts = struct {
+		Level string `short:"l" long:"level" description:"Log level" default:"info" choice:"info" choice:"debug" env:"LEVEL" required:"yes"`
+
+		Group struct {
+			Host string `long:"host" env:"HOST"`
+		} `group:"Database" namespace:"db" env-namespace:"DB"`
+	}{}
+
+	p := NewParser(&opts, None)
+	options := p.Groups()[0].Options()
+
+	if len(options) != 1 {
+		t.Fatalf("Expected 1 option, but got %d", len(options))
+	}
+
+	level := options[0]
+
+	assertStringArray(t, level.Choices(), []string{"info", "debug"})
+	assertStringArray(t, level.Default, []string{"info"})
+	assertString(t, level.EnvKeyWithNamespace(), "LEVEL")
+
+	if !level.IsRequired() {
+		t.Errorf("Expected option to be required")
+	}
+
+	host := p.Groups()[0].Find("Database").Options()[0]
+
+	assertString(t, host.LongNameWithNamespace(), "db.host")
+	assertString(t, host.EnvKeyWithNamespace(), "DB_HOST")
+
+	if host.IsRequired() {
+		t.Errorf("Expected option to not be required")
+	}
+
+	if len(host.Choices()) != 0 {
+		t.Errorf("Expected no choices, but got %v", host.Choices())
+	}
+}
+
+func TestChoice(t *testing.T) {
+	var opts = struct {
+		Level string `long:"level" choice:"info" choice:"debug" choice:"trace"`
+	}{}
+
+	assertParseSuccess(t, &opts, "--level=debug")
+	assertString(t, opts.Level, "debug")
+
+	assertParseFail(t, ErrInvalidChoice, "invalid value `error' for flag `--level', allowed values are: info, debug or trace", &opts, "--level=error")
+}
+
+func TestChoiceJoined(t *testing.T) {
+	var opts = struct {
+		Level  string `long:"level" choice:"info, debug,trace"`
+		Format string `long:"format" choice:"a,b" choice:"c"`
+		Range  string `long:"range" choice:"1,2|3,4" choice:"5,6" choice-sep:"|"`
+	}{}
+
+	assertParseSuccess(t, &opts, "--level=debug", "--format=a,b", "--range=3,4")
+	assertString(t, opts.Level, "debug")
+	assertString(t, opts.Format, "a,b")
+	assertString(t, opts.Range, "3,4")
+
+	assertParseSuccess(t, &opts, "--range=5,6")
+	assertString(t, opts.Range, "5,6")
+
+	assertParseFail(t, ErrInvalidChoice, "invalid value `info,debug' for flag `--level', allowed values are: info, debug or trace", &opts, "--level=info,debug")
+	assertParseFail(t, ErrInvalidChoice, "invalid value `a' for flag `--format', allowed values are: a,b or c", &opts, "--format=a")
+	assertParseFail(t, ErrInvalidChoice, "invalid value `3' for flag `--range', allowed values are: 1,2, 3,4 or 5,6", &opts, "--range=3")
+}
+
+func TestChoiceSeparated(t *testing.T) {
+	var opts = struct {
+		Tags []string `long:"tag" sep:"," choice:"a" choice:"b" aliases:"x=a" non-empty:"yes"`
+	}{}
+
+	assertParseSuccess(t, &opts, "--tag=a,b", "--tag=x")
+	assertStringArray(t, opts.Tags, []string{"a", "b", "a"})
+
+	opts.Tags = nil
+	assertParseFail(t, ErrInvalidChoice, "invalid value `c' for flag `--tag', allowed values are: a or b", &opts, "--tag=a,c")
+
+	opts.Tags = nil
+	assertParseFail(t, ErrEmptyValue, "flag `--tag' cannot have an empty value", &opts, "--tag=a,,b")
+}
+
+func TestValueAliases(t *testing.T) {
+	var opts = struct {
+		Region  string   `long:"region" choice:"us-east-1" choice:"eu-west-1" aliases:"use1=us-east-1, virginia=us-east-1"`
+		Regions []string `long:"regions" aliases:"euw1=eu-west-1"`
+	}{}
+
+	assertParseSuccess(t, &opts, "--region=virginia", "--regions", "euw1", "--regions", "other")
+	assertString(t, opts.Region, "us-east-1")
+	assertStringArray(t, opts.Regions, []string{"eu-west-1", "other"})
+
+	assertParseSuccess(t, &opts, "--region=eu-west-1")
+	assertString(t, opts.Region, "eu-west-1")
+
+	assertParseFail(t, ErrInvalidChoice, "invalid value `use2' for flag `--region', allowed values are: us-east-1 or eu-west-1", &opts, "--region=use2")
+
+	var invalid = struct {
+		Region string `long:"region" aliases:"use1"`
+	}{}
+
+	assertParseFail(t, ErrTag, "invalid aliases `use1' for option `--region' (expected alias=value pairs separated by commas)", &invalid)
+}
+
+type positionalsFirstOptions struct {
+	Verbose bool `short:"v"`
+
+	Positional struct {
+		First  string
+		Second string
+		Rest   []string
+	} `positional-args:"yes"`
+}
+
+func TestPassAfterNonOptionPositional(t *testing.T) {
+	var opts positionalsFirstOptions
+
+	p := NewParser(&opts, PassAfterNonOption)
+	ret, err := p.ParseArgs([]string{"file1", "-v", "file2", "file3", "-v"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+		return
+	}
+
+	if !opts.Verbose {
+		t.Errorf("Expected Verbose to be true")
+	}
+
+	assertString(t, opts.Positional.First, "file1")
+	assertString(t, opts.Positional.Second, "file2")
+	assertStringArray(t, opts.Positional.Rest, []string{"file3"})
+	assertStringArray(t, ret, []string{})
+}
+
+func TestPositionalsFirst(t *testing.T) {
+	var opts positionalsFirstOptions
+
+	p := NewParser(&opts, PassAfterNonOption|PositionalsFirst)
+	ret, err := p.ParseArgs([]string{"file1", "-v", "file2", "file3", "-v"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+		return
+	}
+
+	if !opts.Verbose {
+		t.Errorf("Expected Verbose to be true")
+	}
+
+	assertString(t, opts.Positional.First, "file1")
+	assertString(t, opts.Positional.Second, "file2")
+	assertStringArray(t, opts.Positional.Rest, []string{"file3", "-v"})
+	assertStringArray(t, ret, []string{})
+}
+
+func TestPositionalsInterspersed(t *testing.T) {
+	var opts positionalsFirstOptions
+
+	ret := assertParseSuccess(t, &opts, "file1", "file2", "file3", "-v", "file4")
+
+	if !opts.Verbose {
+		t.Errorf("Expected Verbose to be true")
+	}
+
+	assertString(t, opts.Positional.First, "file1")
+	assertString(t, opts.Positional.Second, "file2")
+	assertStringArray(t, opts.Positional.Rest, []string{"file3", "file4"})
+	assertStringArray(t, ret, []string{})
+}
+
+func TestSecretResolver(t *testing.T) {
+	var opts = struct {
+		Token string `long:"token" secret:"yes"`
+		Other string `long:"other"`
+	}{}
+
+	p := NewParser(&opts, None)
+	p.SecretResolver = func(uri string) (string, error) {
+		if uri != "secret://vault/token" {
+			return "", fmt.Errorf("not found")
+		}
+
+		return "s3cr3t", nil
+	}
+
+	if _, err := p.ParseArgs([]string{"--token", "secret://vault/token", "--other", "secret://vault/token"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertString(t, opts.Token, "s3cr3t")
+	assertString(t, opts.Other, "secret://vault/token")
+
+	if _, err := p.ParseArgs([]string{"--token", "plain"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertString(t, opts.Token, "plain")
+
+	_, err := p.ParseArgs([]string{"--token", "secret://vault/missing"})
+	assertError(t, err, ErrMarshal, "cannot resolve secret `secret://vault/missing' for flag `--token': not found")
+}
+
+func TestConsumesRest(t *testing.T) {
+	var opts = struct {
+		Verbose bool     `short:"v"`
+		Exec    []string `short:"e" long:"exec" consumes-rest:"yes"`
+	}{}
+
+	ret := assertParseSuccess(t, &opts, "-v", "--exec", "ls", "-la", "--", "/tmp")
+
+	assertStringArray(t, ret, []string{})
+	assertStringArray(t, opts.Exec, []string{"ls", "-la", "--", "/tmp"})
+
+	if !opts.Verbose {
+		t.Errorf("Expected Verbose to be true")
+	}
+
+	opts.Exec = nil
+	opts.Verbose = false
+
+	ret = assertParseSuccess(t, &opts, "--exec=ls", "-v")
+
+	assertStringArray(t, ret, []string{})
+	assertStringArray(t, opts.Exec, []string{"ls", "-v"})
+
+	if opts.Verbose {
+		t.Errorf("Expected Verbose to be false")
+	}
+
+	assertParseFail(t, ErrExpectedArgument, fmt.Sprintf("expected argument for flag `%ce, %sexec'", defaultShortOptDelimiter, defaultLongOptDelimiter), &opts, "-v", "--exec")
+}
+
+func TestConsumesRestNotSlice(t *testing.T) {
+	var opts = struct {
+		Exec string `long:"exec" consumes-rest:"yes"`
+	}{}
+
+	assertParseFail(t, ErrTag, fmt.Sprintf("option `%sexec' consumes the remaining arguments but is not a slice", defaultLongOptDelimiter), &opts)
+}
+
+func TestSlurp(t *testing.T) {
+	var opts = struct {
+		Verbose bool     `short:"v"`
+		Files   []string `short:"f" long:"files" slurp:"yes"`
+	}{}
+
+	ret := assertParseSuccess(t, &opts, "--files", "a", "b", "c", "-v", "d")
+
+	assertStringArray(t, ret, []string{"d"})
+	assertStringArray(t, opts.Files, []string{"a", "b", "c"})
+
+	if !opts.Verbose {
+		t.Errorf("Expected Verbose to be true")
+	}
+
+	opts.Files = nil
+
+	ret = assertParseSuccess(t, &opts, "-fa", "b", "--files=c", "--", "d")
+
+	assertStringArray(t, ret, []string{"d"})
+	assertStringArray(t, opts.Files, []string{"a", "b", "c"})
+
+	var invalid = struct {
+		Files string `long:"files" slurp:"yes"`
+	}{}
+
+	assertParseFail(t, ErrTag, fmt.Sprintf("option `%sfiles' slurps arguments but is not a slice", defaultLongOptDelimiter), &invalid)
+}
+
+func TestConflicts(t *testing.T) {
+	oldEnv := NewEnvSnapshot()
+	defer oldEnv.Restore()
+
+	var opts = struct {
+		Quiet   bool `long:"quiet" conflicts:"verbose, output.format"`
+		Verbose bool `long:"verbose"`
+		Level   int  `long:"level" default:"1" conflicts:"quiet"`
+		Color   bool `long:"color" env:"TEST_COLOR"`
+
+		Output struct {
+			Format string `long:"format" conflicts:"color"`
+		} `group:"Output" namespace:"output"`
+	}{}
+
+	assertParseSuccess(t, &opts, "--quiet")
+	assertParseSuccess(t, &opts, "--verbose", "--level", "2")
+	assertParseSuccess(t, &opts, "--verbose", "--output.format", "json")
+
+	assertParseFail(t, ErrConflictingFlags, "flag `--quiet' cannot be specified together with flag `--verbose'", &opts, "--verbose", "--quiet")
+	assertParseFail(t, ErrConflictingFlags, "flag `--quiet' cannot be specified together with flag `--output.format'", &opts, "--quiet", "--output.format", "json")
+	assertParseFail(t, ErrConflictingFlags, "flag `--level' cannot be specified together with flag `--quiet'", &opts, "--level", "2", "--quiet")
+
+	os.Setenv("TEST_COLOR", "yes")
+	assertParseFail(t, ErrConflictingFlags, "flag `--output.format' cannot be specified together with flag `--color'", &opts, "--output.format", "json")
+
+	var cmdOpts = struct {
+		Verbose bool `long:"verbose"`
+
+		Run struct {
+			Dry bool `long:"dry" conflicts:"verbose"`
+		} `command:"run"`
+	}{}
+
+	assertParseSuccess(t, &cmdOpts, "run", "--dry")
+	assertParseFail(t, ErrConflictingFlags, "flag `--dry' cannot be specified together with flag `--verbose'", &cmdOpts, "--verbose", "run", "--dry")
+
+	var invalid = struct {
+		Quiet bool `long:"quiet" conflicts:"verbos"`
+	}{}
+
+	assertParseFail(t, ErrTag, "option `--quiet' conflicts with unknown option `verbos'", &invalid)
+}
+
+func TestDefaultTemplate(t *testing.T) {
+	oldEnv := NewEnvSnapshot()
+	defer oldEnv.Restore()
+
+	type options struct {
+		DataDir  string   `long:"data-dir" default:"/var/lib/app"`
+		LogDir   string   `long:"log-dir" default:"{{.DataDir}}/logs"`
+		LogFile  string   `long:"log-file" default:"{{.LogDir}}/{{.Name}}.log"`
+		Name     string   `long:"name" default:"app" env:"TEST_NAME"`
+		Port     int      `long:"port" default:"8000"`
+		Admin    int      `long:"admin-port" default:"{{.Port}}1"`
+		Mirrors  []string `long:"mirror" default:"{{.DataDir}}/a" default:"{{.DataDir}}/b"`
+		CacheDir string   `long:"cache-dir" default:"{{.DataDir}}/cache" env:"TEST_CACHE_DIR"`
+	}
+
+	var opts options
+	assertParseSuccess(t, &opts)
+
+	assertString(t, opts.LogDir, "/var/lib/app/logs")
+	assertString(t, opts.LogFile, "/var/lib/app/logs/app.log")
+	assertStringArray(t, opts.Mirrors, []string{"/var/lib/app/a", "/var/lib/app/b"})
+	assertString(t, opts.CacheDir, "/var/lib/app/cache")
+
+	if opts.Admin != 80001 {
+		t.Errorf("Expected admin port 80001 but got %d", opts.Admin)
+	}
+
+	os.Setenv("TEST_NAME", "web")
+	os.Setenv("TEST_CACHE_DIR", "/tmp/cache")
+
+	opts = options{}
+	p, _ := assertParserSuccess(t, &opts, "--data-dir", "/srv", "--log-file", "/dev/stdout")
+
+	assertString(t, opts.LogDir, "/srv/logs")
+	assertString(t, opts.LogFile, "/dev/stdout")
+	assertString(t, opts.CacheDir, "/tmp/cache")
+
+	if source := p.Groups()[0].Options()[1].Source(); source != SourceDefault {
+		t.Errorf("Expected source of --log-dir to be default but got %s", source)
+	}
+
+	opts = options{}
+	assertParseSuccess(t, &opts, "--log-dir", "/logs")
+	assertString(t, opts.LogFile, "/logs/web.log")
+
+	var cycle = struct {
+		A string `long:"a" default:"{{.B}}"`
+		B string `long:"b" default:"{{.A}}"`
+	}{}
+
+	assertParseFail(t, ErrTag, "default values of options refer to each other: `--a' -> `--b' -> `--a'", &cycle)
+	assertParseSuccess(t, &cycle, "--b", "x")
+	assertString(t, cycle.A, "x")
+
+	var self = struct {
+		A string `long:"a" default:"x{{.A}}"`
+	}{}
+
+	assertParseFail(t, ErrTag, "default value of option `--a' refers to itself", &self)
+
+	// Values specified on the command line replace the templated default
+	// values of slices when parsing again with the same struct
+	var reused options
+
+	p, _ = assertParserSuccess(t, &reused)
+
+	if _, err := p.ParseArgs([]string{"--mirror", "/m"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertStringArray(t, reused.Mirrors, []string{"/m"})
+
+	var invalid = struct {
+		A string `long:"a" default:"{{.C}}"`
+	}{}
+
+	p = NewParser(&invalid, None)
+	_, err := p.ParseArgs(nil)
+
+	if e, ok := err.(*Error); !ok || e.Type != ErrTag || !strings.Contains(e.Message, "invalid default value `{{.C}}' for option `--a'") {
+		t.Errorf("Expected tag error but got %v", err)
+	}
+
+	var invalidValue = struct {
+		Port int    `long:"port" default:"{{.Name}}"`
+		Name string `long:"name" default:"x"`
+	}{}
+
+	assertParseFail(t, ErrMarshal, "invalid default value `x' for flag `--port' (expected int): strconv.ParseInt: parsing \"x\": invalid syntax", &invalidValue)
+}
+
+func TestMapKeyValueDelimiter(t *testing.T) {
+	var opts = struct {
+		Env    map[string]string `long:"env" key-value-delimiter:"="`
+		Labels map[string]string `long:"label"`
+		Limits map[string]int    `long:"limit" key-value-delimiter:"=" sep:","`
+	}{}
+
+	p, _ := assertParserSuccess(t, &opts, "--env=A=B=C", "--env", "PATH=/bin", "--label", "url:http://x", "--limit", "cpu=2,mem=512")
+
+	if !reflect.DeepEqual(opts.Env, map[string]string{"A": "B=C", "PATH": "/bin"}) {
+		t.Errorf("Unexpected values %v", opts.Env)
+	}
+
+	if !reflect.DeepEqual(opts.Labels, map[string]string{"url": "http://x"}) {
+		t.Errorf("Unexpected values %v", opts.Labels)
+	}
+
+	if !reflect.DeepEqual(opts.Limits, map[string]int{"cpu": 2, "mem": 512}) {
+		t.Errorf("Unexpected values %v", opts.Limits)
+	}
+
+	var buf bytes.Buffer
+	NewIniParser(p).Write(&buf, IniNone)
+
+	if !strings.Contains(buf.String(), "Env = A=B=C\nEnv = PATH=/bin\n") {
+		t.Errorf("Expected map values to be written using the delimiter, but got:\n%s", buf.String())
+	}
+
+	assertParseFail(t, ErrMarshal, "invalid argument for flag `--limit' (expected map[string]int): strconv.ParseInt: parsing \"\": invalid syntax", &opts, "--limit", "cpu")
+}
+
+func TestDedup(t *testing.T) {
+	var opts = struct {
+		Include []string `long:"include" dedup:"yes"`
+		Ports   []int    `long:"port" dedup:"yes" sep:","`
+	}{}
+
+	p := NewParser(&opts, None)
+
+	err := NewIniParser(p).Parse(strings.NewReader("[Application Options]\ninclude = /usr/include\ninclude = /opt/include\ninclude = /usr/include\n"))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	assertStringArray(t, opts.Include, []string{"/usr/include", "/opt/include"})
+
+	_, err = p.ParseArgs([]string{"--include", "/opt/include", "--include", "./include", "--port", "80,0x50,443,80"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	assertStringArray(t, opts.Include, []string{"/usr/include", "/opt/include", "./include"})
+
+	if !reflect.DeepEqual(opts.Ports, []int{80, 443}) {
+		t.Errorf("Unexpected values %v", opts.Ports)
+	}
+
+	var invalid = struct {
+		Include string `long:"include" dedup:"yes"`
+	}{}
+
+	assertParseFail(t, ErrTag, "option `--include' is dedup but is not a slice", &invalid)
+}
+
+func TestUnit(t *testing.T) {
+	var opts = struct {
+		Interval int       `long:"interval" unit:"ms"`
+		Timeout  uint      `long:"timeout" unit:"ms,s=1000,m=60000"`
+		Ratio    float64   `long:"ratio" unit:"%"`
+		Sizes    []int64   `long:"size" unit:"B,KB=1024"`
+		Delay    int       `long:"delay" unit:"ms" default:"250ms"`
+		Limit    int8      `long:"limit" unit:"s,m=60"`
+		Weights  []float32 `long:"weight" unit:"g,kg=1000"`
+	}{}
+
+	p, _ := assertParserSuccess(t, &opts, "--interval=500ms", "--timeout", "2m", "--ratio=12.5%", "--size", "3KB", "--size", "7B", "--weight", "1.5kg")
+
+	if opts.Interval != 500 || opts.Timeout != 120000 || opts.Ratio != 12.5 || opts.Delay != 250 {
+		t.Errorf("Unexpected values %d, %d, %g, %d", opts.Interval, opts.Timeout, opts.Ratio, opts.Delay)
+	}
+
+	if !reflect.DeepEqual(opts.Sizes, []int64{3072, 7}) || !reflect.DeepEqual(opts.Weights, []float32{1500}) {
+		t.Errorf("Unexpected values %v, %v", opts.Sizes, opts.Weights)
+	}
+
+	var buf bytes.Buffer
+	NewIniParser(p).Write(&buf, IniNone)
+
+	if !strings.Contains(buf.String(), "Interval = 500ms\n") || !strings.Contains(buf.String(), "Timeout = 120000ms\n") {
+		t.Errorf("Expected values to be written with their unit, but got:\n%s", buf.String())
+	}
+
+	assertParseFail(t, ErrMarshal, "invalid value `500' for flag `--interval' (expected a number followed by a unit, one of ms, e.g. 10ms)", &opts, "--interval=500")
+	assertParseFail(t, ErrMarshal, "invalid value `s' for flag `--timeout' (expected a number followed by a unit, one of ms, s or m, e.g. 10ms)", &opts, "--timeout=s")
+	assertParseFail(t, ErrRange, "invalid argument for flag `--limit' (expected int8): strconv.ParseInt: parsing \"180\": value out of range", &opts, "--limit=3m")
+	assertParseFail(t, ErrMarshal, "invalid argument for flag `--timeout' (expected uint): strconv.ParseUint: parsing \"x\": invalid syntax", &opts, "--timeout=xs")
+
+	var based = struct {
+		Timeout int `long:"timeout" unit:"ms,s=1000"`
+		Mask    int `long:"mask" base:"16" unit:"B,KB=1024"`
+	}{}
+
+	assertParseSuccess(t, &based, "--timeout", "0x2s", "--mask", "10KB")
+
+	if based.Timeout != 2000 || based.Mask != 16384 {
+		t.Errorf("Unexpected values %d, %d", based.Timeout, based.Mask)
+	}
+
+	var separated = struct {
+		Intervals []int `long:"i" sep:"," unit:"ms,s=1000"`
+	}{}
+
+	assertParseSuccess(t, &separated, "--i=1ms,2s", "--i", "3ms")
+
+	if !reflect.DeepEqual(separated.Intervals, []int{1, 2000, 3}) {
+		t.Errorf("Unexpected values %v", separated.Intervals)
+	}
+
+	separated.Intervals = nil
+	assertParseFail(t, ErrMarshal, "invalid value `2' for flag `--i' (expected a number followed by a unit, one of ms or s, e.g. 10ms)", &separated, "--i=1ms,2")
+
+	var invalid = struct {
+		Timeout int `long:"timeout" unit:"s=1000"`
+	}{}
+
+	assertParseFail(t, ErrTag, "invalid unit `s=1000' for option `--timeout' (expected unit suffixes separated by commas, with a factor for all but the base unit, e.g. ms,s=1000)", &invalid)
+
+	var invalidType = struct {
+		Name string `long:"name" unit:"ms"`
+	}{}
+
+	assertParseFail(t, ErrTag, "option `--name' has a unit but is not a number", &invalidType)
+}
+
+func TestRequiredEmptyValue(t *testing.T) {
+	var opts = struct {
+		Name string `long:"name" required:"yes"`
+	}{}
+
+	assertParseSuccess(t, &opts, "--name=")
+	assertString(t, opts.Name, "")
+
+	assertParseSuccess(t, &opts, "--name", "")
+	assertString(t, opts.Name, "")
+}
+
+func TestNonEmpty(t *testing.T) {
+	var opts = struct {
+		Name string `long:"name" required:"yes" non-empty:"yes"`
+	}{}
+
+	msg := fmt.Sprintf("flag `%sname' cannot have an empty value", defaultLongOptDelimiter)
+
+	assertParseFail(t, ErrEmptyValue, msg, &opts, "--name=")
+	assertParseFail(t, ErrEmptyValue, msg, &opts, "--name", "")
+	assertParseFail(t, ErrRequired, fmt.Sprintf("the required flag `%sname' was not specified", defaultLongOptDelimiter), &opts)
+
+	assertParseSuccess(t, &opts, "--name", "x")
+	assertString(t, opts.Name, "x")
+}
+
+func TestEnvOnly(t *testing.T) {
+	var opts = struct {
+		Verbose  bool   `short:"v" long:"verbose" description:"Be verbose"`
+		Password string `long:"password" env:"TEST_PASSWORD" env-only:"yes" description:"The password"`
+		Token    string `env:"TEST_TOKEN" env-only:"yes" description:"The token"`
+	}{}
+
+	oldEnv := NewEnvSnapshot()
+	defer oldEnv.Restore()
+
+	os.Setenv("TEST_PASSWORD", "secret")
+	os.Setenv("TEST_TOKEN", "token")
+
+	assertParseSuccess(t, &opts, "-v")
+
+	assertString(t, opts.Password, "secret")
+	assertString(t, opts.Token, "token")
+
+	assertParseFail(t, ErrUnknownFlag, "unknown flag `password'", &opts, "--password", "x")
+
+	p := NewNamedParser("TestEnvOnly", None)
+	p.AddGroup("Application Options", "", &opts)
+
+	var b bytes.Buffer
+	p.WriteHelp(&b)
+
+	expected := `Usage:
+  TestEnvOnly [OPTIONS]
+
+Application Options:
+  -v, --verbose  Be verbose
+                 The password [$TEST_PASSWORD]
+                 The token [$TEST_TOKEN]
+`
+
+	if runtime.GOOS == "windows" {
+		expected = `Usage:
+  TestEnvOnly [OPTIONS]
+
+Application Options:
+  /v, /verbose   Be verbose
+                 The password [$TEST_PASSWORD]
+                 The token [$TEST_TOKEN]
+`
+	}
+
+	if b.String() != expected {
+		msg, _ := helpDiff(b.String(), expected)
+		t.Errorf("Unexpected help message:\n\n%s", msg)
+	}
+
+	var invalid = struct {
+		Token string `env-only:"yes"`
+	}{}
+
+	assertParseFail(t, ErrTag, "env-only option for field `Token' has no env key", &invalid)
+}
+
+func TestRequiresFeature(t *testing.T) {
+	var opts = struct {
+		Verbose bool   `short:"v" long:"verbose" description:"Be verbose"`
+		Turbo   bool   `long:"turbo" requires-feature:"experimental" description:"Go faster"`
+		Mode    string `long:"mode" env:"TEST_MODE" requires-feature:"experimental"`
+	}{}
+
+	p := NewNamedParser("TestRequiresFeature", None)
+	p.AddGroup("Application Options", "", &opts)
+
+	_, err := p.ParseArgs([]string{"--turbo"})
+	assertError(t, err, ErrFeatureDisabled, fmt.Sprintf("flag `%sturbo' is an experimental option; enable it with the `experimental' feature", defaultLongOptDelimiter))
+
+	oldEnv := NewEnvSnapshot()
+	defer oldEnv.Restore()
+
+	os.Setenv("TEST_MODE", "fast")
+
+	_, err = p.ParseArgs([]string{})
+	assertError(t, err, ErrFeatureDisabled, fmt.Sprintf("flag `%smode' is an experimental option; enable it with the `experimental' feature", defaultLongOptDelimiter))
+
+	os.Unsetenv("TEST_MODE")
+
+	var b bytes.Buffer
+	p.WriteHelp(&b)
+
+	if strings.Contains(b.String(), "turbo") {
+		t.Errorf("Expected turbo to be hidden but got:\n\n%s", b.String())
+	}
+
+	p.EnabledFeatures = map[string]bool{"experimental": true}
+
+	if _, err := p.ParseArgs([]string{"--turbo"}); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if !opts.Turbo {
+		t.Errorf("Expected Turbo to be true")
+	}
+
+	b.Reset()
+	p.WriteHelp(&b)
+
+	if !strings.Contains(b.String(), "turbo") {
+		t.Errorf("Expected turbo to be shown but got:\n\n%s", b.String())
+	}
+}
+
+func TestShortCircuit(t *testing.T) {
+	called := false
+
+	var opts = struct {
+		Name        string `long:"name" required:"yes"`
+		Level       int    `long:"level" default:"3"`
+		PrintConfig bool   `long:"print-config" short-circuit:"yes"`
+		Dump        func() `long:"dump" short-circuit:"yes"`
+
+		Command struct {
+		} `command:"cmd"`
+	}{}
+
+	opts.Dump = func() {
+		called = true
+	}
+
+	p := NewParser(&opts, Default)
+
+	ret, err := p.ParseArgs([]string{"--print-config", "--unknown"})
+	assertError(t, err, ErrShortCircuit, fmt.Sprintf("flag `%sprint-config' was specified", defaultLongOptDelimiter))
+	assertStringArray(t, ret, []string{"--print-config", "--unknown"})
+
+	if !opts.PrintConfig {
+		t.Errorf("Expected PrintConfig to be true")
+	}
+
+	if opts.Level != 3 {
+		t.Errorf("Expected default Level 3 but got %d", opts.Level)
+	}
+
+	_, err = p.ParseArgs([]string{"--level", "4", "--dump"})
+	assertError(t, err, ErrShortCircuit, fmt.Sprintf("flag `%sdump' was specified", defaultLongOptDelimiter))
+
+	if !called || opts.Level != 4 {
+		t.Errorf("Expected Dump to be called and Level to be 4")
+	}
+
+	var invalid = struct {
+		Value string `long:"value" short-circuit:"yes"`
+	}{}
+
+	assertParseFail(t, ErrTag, fmt.Sprintf("option `%svalue' is short-circuit but is not a bool or func", defaultLongOptDelimiter), &invalid)
+}
+
+func TestMustExist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+
+	if err != nil {
+		t.Fatalf("Cannot create temporary directory: %s", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "config.ini")
+
+	if err := ioutil.WriteFile(file, []byte{}, 0644); err != nil {
+		t.Fatalf("Cannot write file: %s", err)
+	}
+
+	missing := filepath.Join(dir, "missing")
+
+	var opts = struct {
+		Config string   `long:"config" must-exist:"file" readable:"yes"`
+		Dir    string   `long:"dir" must-exist:"dir"`
+		Output string   `long:"output" writable:"yes"`
+		Inputs []string `long:"input" readable:"yes"`
+	}{}
+
+	assertParseSuccess(t, &opts, "--config", file, "--dir", dir, "--output", missing, "--input", file)
+	assertString(t, opts.Config, file)
+
+	assertParseFail(t, ErrInvalidPath, fmt.Sprintf("path `%s' of flag `--config' does not exist", missing), &opts, "--config", missing)
+	assertParseFail(t, ErrInvalidPath, fmt.Sprintf("path `%s' of flag `--config' is not a file", dir), &opts, "--config", dir)
+	assertParseFail(t, ErrInvalidPath, fmt.Sprintf("path `%s' of flag `--dir' is not a directory", file), &opts, "--dir", file)
+	assertParseFail(t, ErrInvalidPath, fmt.Sprintf("path `%s' of flag `--input' does not exist", missing), &opts, "--input", file, "--input", missing)
+
+	unwritable := filepath.Join(missing, "output")
+	assertParseFail(t, ErrInvalidPath, fmt.Sprintf("path `%s' of flag `--output' is not writable", unwritable), &opts, "--output", unwritable)
+
+	var invalid = struct {
+		Path string `long:"path" must-exist:"yes"`
+	}{}
+
+	assertParseFail(t, ErrTag, "invalid must-exist value `yes' for option `--path' (expected file or dir)", &invalid)
+}
+
+func TestBoolValue(t *testing.T) {
+	var opts = struct {
+		Feature bool   `short:"f" long:"feature" bool-value:"yes"`
+		Verbose bool   `short:"v" long:"verbose"`
+		Flags   []bool `long:"flag" bool-value:"yes"`
+	}{}
+
+	ret := assertParseSuccess(t, &opts, "--feature", "false", "--verbose", "true", "--flag", "1", "--flag=false", "--flag")
+	assertStringArray(t, ret, []string{"true"})
+	assertBoolArray(t, []bool{opts.Feature, opts.Verbose}, []bool{false, true})
+	assertBoolArray(t, opts.Flags, []bool{true, false, true})
+
+	ret = assertParseSuccess(t, &opts, "-f", "file")
+	assertStringArray(t, ret, []string{"file"})
+	assertBoolArray(t, []bool{opts.Feature}, []bool{true})
+
+	ret = assertParseSuccess(t, &opts, "--feature=true", "false")
+	assertStringArray(t, ret, []string{"false"})
+	assertBoolArray(t, []bool{opts.Feature}, []bool{true})
+
+	assertParseFail(t, ErrMarshal, "invalid argument for flag `-f, --feature' (expected bool): strconv.ParseBool: parsing \"maybe\": invalid syntax", &opts, "--feature=maybe")
+
+	var invalid = struct {
+		Value string `long:"value" bool-value:"yes"`
+	}{}
+
+	assertParseFail(t, ErrTag, "option `--value' has a bool-value but is not a bool", &invalid)
+}
+
+func TestBits(t *testing.T) {
+	var opts = struct {
+		Features uint8 `long:"enable" bits:"cache=1, compression=2,tracing=0x8" default:"tracing" description:"Enabled features"`
+	}{}
+
+	assertParseSuccess(t, &opts, "--enable=cache", "--enable", "compression")
+
+	if opts.Features != 3 {
+		t.Errorf("Expected Features to be 3 but got %d", opts.Features)
+	}
+
+	p, _ := assertParserSuccess(t, &opts)
+
+	if opts.Features != 8 {
+		t.Errorf("Expected Features to be 8 but got %d", opts.Features)
+	}
+
+	assertParseFail(t, ErrInvalidChoice, "invalid value `fast' for flag `--enable', allowed values are: cache, compression or tracing", &opts, "--enable=fast")
+
+	var b bytes.Buffer
+	p.WriteHelp(&b)
+
+	if !strings.Contains(b.String(), "--enable=[cache|compression|tracing]") {
+		t.Errorf("Expected help to enumerate the bit names but got:\n\n%s", b.String())
+	}
+
+	opts.Features = 1 | 8
+
+	inip := NewIniParser(p)
+	b.Reset()
+	inip.Write(&b, IniNone)
+
+	assertString(t, b.String(), "[Application Options]\nFeatures = cache,tracing\n\n")
+
+	opts.Features = 0
+
+	if err := inip.Parse(&b); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if opts.Features != 9 {
+		t.Errorf("Expected Features to be 9 but got %d", opts.Features)
+	}
+
+	opts.Features = 0
+	assertParseSuccess(t, &opts, "--enable=3")
+
+	if opts.Features != 3 {
+		t.Errorf("Expected Features to be 3 but got %d", opts.Features)
+	}
+
+	assertParseFail(t, ErrInvalidChoice, "invalid value `16' for flag `--enable', allowed values are: cache, compression or tracing", &opts, "--enable=16")
+
+	var overflow = struct {
+		Features int8 `long:"enable" bits:"low=1,high=0x100"`
+	}{}
+
+	assertParseFail(t, ErrRange, "value `high' for flag `--enable' is out of range", &overflow, "--enable=high")
+
+	var invalid = struct {
+		Features string `long:"enable" bits:"cache=1"`
+	}{}
+
+	assertParseFail(t, ErrTag, "option `--enable' has bits but is not an integer", &invalid)
+
+	var malformed = struct {
+		Features int `long:"enable" bits:"cache"`
+	}{}
+
+	assertParseFail(t, ErrTag, "invalid bits `cache' for option `--enable' (expected name=value pairs separated by commas)", &malformed)
+
+	var choices = struct {
+		Features int `long:"enable" bits:"cache=1" choice:"cache"`
+	}{}
+
+	assertParseFail(t, ErrTag, "option `--enable' cannot have both bits and choices", &choices)
+}
+
+func TestUnique(t *testing.T) {
+	var opts = struct {
+		Tags  []string `long:"tag" unique:"yes"`
+		Ports []int    `long:"port" unique:"yes"`
+		Names []string `long:"name"`
+	}{}
+
+	assertParseSuccess(t, &opts, "--tag", "a", "--tag", "b", "--name", "x", "--name", "x")
+	assertStringArray(t, opts.Tags, []string{"a", "b"})
+	assertStringArray(t, opts.Names, []string{"x", "x"})
+
+	assertParseFail(t, ErrDuplicatedValue, "value `a' was specified more than once for flag `--tag'", &opts, "--tag", "a", "--tag", "b", "--tag", "a")
+	assertParseFail(t, ErrDuplicatedValue, "value `80' was specified more than once for flag `--port'", &opts, "--port", "80", "--port", "0x50")
+
+	var separated = struct {
+		Tags []string `long:"tag" unique:"yes" sep:","`
+	}{}
+
+	assertParseFail(t, ErrDuplicatedValue, "value `a' was specified more than once for flag `--tag'", &separated, "--tag", "a,b", "--tag", "a,c")
+
+	separated.Tags = nil
+	assertParseFail(t, ErrDuplicatedValue, "value `b' was specified more than once for flag `--tag'", &separated, "--tag", "b,c,b")
+
+	separated.Tags = nil
+	assertParseSuccess(t, &separated, "--tag", "a,b", "--tag", "c")
+	assertStringArray(t, separated.Tags, []string{"a", "b", "c"})
+
+	var invalid = struct {
+		Tag string `long:"tag" unique:"yes"`
+	}{}
+
+	assertParseFail(t, ErrTag, "option `--tag' is unique but is not a slice", &invalid)
+}
+
+func TestIgnoredFields(t *testing.T) {
+	type state struct {
+		Count int `long:"count"`
+
+		Sub struct {
+			Name string `long:"name"`
+		} `group:"Sub Options"`
+	}
+
+	var opts struct {
+		Verbose bool   `short:"v" long:"verbose" description:"Show verbose information"`
+		Legacy  string `long:"legacy" flags:"-"`
+		Old     string `long:"old" no-flag:"yes"`
+
+		State state  `flags:"-"`
+		Cache *state `flags:"-"`
+
+		Run struct {
+			Force bool `long:"force"`
+		} `command:"run" flags:"-"`
+
+		Args struct {
+			File  string `name:"file"`
+			Cache string `name:"cache" flags:"-"`
+		} `positional-args:"yes"`
+	}
+
+	p := NewNamedParser("TestIgnoredFields", None)
+	p.AddGroup("Application Options", "", &opts)
+
+	ret, err := p.ParseArgs([]string{"-v", "a.txt", "run"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertStringArray(t, ret, []string{"run"})
+
+	if !opts.Verbose || opts.Args.File != "a.txt" || opts.Args.Cache != "" {
+		t.Errorf("Unexpected options %+v", opts)
+	}
+
+	if opts.Cache != nil {
+		t.Errorf("Expected ignored pointer field to be left nil")
+	}
+
+	for _, name := range []string{"legacy", "old", "count", "name", "sub.name"} {
+		_, err := p.ParseArgs([]string{"--" + name, "x"})
+		assertError(t, err, ErrUnknownFlag, "unknown flag `"+name+"'")
+	}
+
+	var buf bytes.Buffer
+	p.WriteHelp(&buf)
+
+	var expected string
+
+	if runtime.GOOS == "windows" {
+		expected = `Usage:
+  TestIgnoredFields [OPTIONS] [file]
+
+Application Options:
+  /v, /verbose   Show verbose information
+
+Arguments:
+  file
+`
+	} else {
+		expected = `Usage:
+  TestIgnoredFields [OPTIONS] [file]
+
+Application Options:
+  -v, --verbose  Show verbose information
+
+Arguments:
+  file
+`
+	}
+
+	assertString(t, buf.String(), expected)
+}
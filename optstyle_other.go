@@ -4,6 +4,7 @@ package flags
 
 import (
 	"strings"
+	"unicode/utf8"
 )
 
 const (
@@ -33,7 +34,11 @@ func stripOptionPrefix(optname string) (prefix string, name string, islong bool)
 func splitOption(prefix string, option string, islong bool) (string, string, *string) {
 	pos := strings.Index(option, "=")
 
-	if (islong && pos >= 0) || (!islong && pos == 1) {
+	// The argument of a short option can only directly follow its (single
+	// rune) name
+	_, n := utf8.DecodeRuneInString(option)
+
+	if (islong && pos >= 0) || (!islong && pos > 0 && pos == n) {
 		rest := option[pos+1:]
 		return option[:pos], "=", &rest
 	}
@@ -51,5 +56,7 @@ func (c *Command) addHelpGroup(showHelp func() error) *Group {
 	ret, _ := c.AddGroup("Help Options", "", &help)
 	ret.isBuiltinHelp = true
 
+	c.setHelpNames(ret.options[0])
+
 	return ret
 }
@@ -2,6 +2,7 @@ package flags
 
 import (
 	"strings"
+	"unicode/utf8"
 )
 
 // Windows uses a front slash for both short and long options.  Also it uses
@@ -63,7 +64,11 @@ func splitOption(prefix string, option string, islong bool) (string, string, *st
 		pos = strings.Index(option, sp)
 	}
 
-	if (islong && pos >= 0) || (!islong && pos == 1) {
+	// The argument of a short option can only directly follow its (single
+	// rune) name
+	_, n := utf8.DecodeRuneInString(option)
+
+	if (islong && pos >= 0) || (!islong && pos > 0 && pos == n) {
 		rest := option[pos+1:]
 		return option[:pos], sp, &rest
 	}
@@ -86,5 +91,7 @@ func (c *Command) addHelpGroup(showHelp func() error) *Group {
 	ret, _ := c.AddGroup("Help Options", "", &help)
 	ret.isBuiltinHelp = true
 
+	c.setHelpNames(ret.options[1])
+
 	return ret
 }
@@ -0,0 +1,66 @@
+package flags
+
+import (
+	"strings"
+)
+
+// KeyValue is a single entry of an OrderedStringMap.
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// MarshalFlag marshals the entry as key:value.
+func (kv KeyValue) MarshalFlag() (string, error) {
+	return kv.Key + ":" + kv.Value, nil
+}
+
+// OrderedStringMap is an option value type collecting key:value pairs, like
+// a map[string]string, while preserving the order in which the keys were
+// first specified (on the command line, in the environment or in an ini
+// file). Specifying an existing key again replaces its value but keeps its
+// position. Values without a colon are stored as a key with an empty value.
+// The entries are written to ini files in order.
+type OrderedStringMap []KeyValue
+
+// UnmarshalFlag parses a key:value pair and adds it to the map.
+func (m *OrderedStringMap) UnmarshalFlag(value string) error {
+	parts := strings.SplitN(value, ":", 2)
+	kv := KeyValue{Key: parts[0]}
+
+	if len(parts) == 2 {
+		kv.Value = parts[1]
+	}
+
+	for i := range *m {
+		if (*m)[i].Key == kv.Key {
+			(*m)[i].Value = kv.Value
+			return nil
+		}
+	}
+
+	*m = append(*m, kv)
+	return nil
+}
+
+// Keys returns the keys of the map in order.
+func (m OrderedStringMap) Keys() []string {
+	ret := make([]string, len(m))
+
+	for i, kv := range m {
+		ret[i] = kv.Key
+	}
+
+	return ret
+}
+
+// Get returns the value of the given key and whether the key exists.
+func (m OrderedStringMap) Get(key string) (string, bool) {
+	for _, kv := range m {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+
+	return "", false
+}
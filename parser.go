@@ -5,6 +5,9 @@
 package flags
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"os"
 	"path"
 )
@@ -24,7 +27,199 @@ type Parser struct {
 	// NamespaceDelimiter separates group namespaces and option long names
 	NamespaceDelimiter string
 
-	internalError error
+	// EnvNamespaceDelimiter separates group env namespaces and env keys
+	EnvNamespaceDelimiter string
+
+	// ResponseFilePrefix, when not 0, enables response files. Any argument
+	// starting with this prefix (e.g. '@') is replaced by the arguments
+	// read from the file named by the rest of the argument. Arguments in
+	// the file are separated by whitespace and can be quoted using single
+	// or double quotes. Response files can themselves refer to other
+	// response files. An argument starting with the prefix twice is
+	// passed literally, with one prefix removed.
+	ResponseFilePrefix byte
+
+	// MaxNameColumn limits the length of option and argument names (including
+	// namespaces and value names) taken into account when aligning their
+	// descriptions in the help message. The description of an option with a
+	// longer name starts on the next line instead of pushing the description
+	// column of all options further to the right. A value of 0 means no
+	// limit.
+	MaxNameColumn int
+
+	// UseArgv0Name shows the base name of the running binary (i.e. of
+	// os.Args[0], without the .exe extension on windows) as the name of
+	// the parser in the usage line of the help message, determined when
+	// the help is written, if the name of the parser is empty. This supports binaries which are invoked through
+	// different names (e.g. symlinks to a multi-call binary).
+	UseArgv0Name bool
+
+	// HelpWidth is the width (in columns) to which the help message is
+	// wrapped. When 0, the width of the terminal is used if the help is
+	// written to a terminal, and DefaultHelpWidth otherwise, such that
+	// the help is wrapped the same way regardless of the terminal when it
+	// is piped or captured.
+	HelpWidth int
+
+	// EnvAnnotationFormat, when set, is called by WriteHelp for each option
+	// with an env key to produce the annotation following its description,
+	// instead of the default [$KEY] (e.g. to show the current value of the
+	// environment variable). An empty annotation is omitted.
+	EnvAnnotationFormat func(opt *Option) string
+
+	// ShowHidden shows hidden groups and options in the help, man page and
+	// completions.
+	ShowHidden bool
+
+	// UnknownCommandHandler, when set, is called when a command is required
+	// but the first positional argument does not match any command. It
+	// receives the unknown command name and the arguments following it.
+	// Returning nil suppresses the default ErrUnknownCommand error, in
+	// which case all arguments are returned as remaining arguments. A
+	// non-nil error is returned from the parser instead of the default
+	// error. See also SuggestCommands.
+	UnknownCommandHandler func(name string, args []string) error
+
+	// UnknownOptionHandler, when set, is called for each option specified
+	// on the command line which is not known to the parser. It receives
+	// the name of the option (without prefix and value), the option as
+	// specified and the arguments following it. For an unknown short
+	// option in a bundle of short options (e.g. x in -vx), the rest of the
+	// bundle is passed as its value. When the handler returns
+	// consumed as true, parsing continues with newArgs as the remaining
+	// arguments (allowing the handler to consume arguments, or to replace
+	// them, e.g. to translate legacy options). Otherwise the option is
+	// handled as if there was no handler (see IgnoreUnknown). A non-nil
+	// error stops parsing and is returned from the parser.
+	UnknownOptionHandler func(name string, arg SplitArgument, args []string) (consumed bool, newArgs []string, err error)
+
+	// ArgsPreprocessor, when set, is called by ParseArgs with the command
+	// line arguments (after expanding response files) before they are
+	// parsed. The returned arguments are parsed instead, which allows
+	// rewriting legacy forms of arguments (e.g. renaming --old-name to
+	// --new-name). A non-nil error stops parsing and is returned from the
+	// parser.
+	ArgsPreprocessor func(args []string) ([]string, error)
+
+	// SecretResolver, when set, resolves values of options tagged with
+	// secret starting with SecretPrefix (e.g. secret://vault/path) to the
+	// actual value of the option, before the value is converted. This
+	// allows secrets to be kept out of the command line, environment and
+	// ini files. The resolver receives the full value, including the
+	// prefix.
+	SecretResolver func(uri string) (string, error)
+
+	// SecretPrefix is the prefix of option values which are resolved by the
+	// SecretResolver. The default is "secret://".
+	SecretPrefix string
+
+	// Messages contains the strings used in the help message, allowing
+	// them to be localized.
+	Messages Messages
+
+	// The version of the application, shown by the built-in --version
+	// option (see VersionFlag).
+	Version string
+
+	// HelpShort is the short name of the built-in help option (see
+	// HelpFlag). The default (0) is 'h'. A value of -1 disables the short
+	// name of the help option.
+	HelpShort rune
+
+	// HelpLong is the long name of the built-in help option (see
+	// HelpFlag). The default (empty) is "help".
+	HelpLong string
+
+	// EnabledFeatures contains the features which are enabled. Options
+	// tagged with requires-feature can only be used when their feature is
+	// enabled, and are hidden otherwise.
+	EnabledFeatures map[string]bool
+
+	// OptionPrefixes, when not nil, replaces the prefixes by which options
+	// are recognized on the command line (by default - and -- and, on
+	// Windows, also /). An argument starting with a prefix of more than
+	// one character is a long option and an argument starting with a
+	// single character prefix is a short option (or a bundle of short
+	// options). The longest matching prefix is used. When both + and -
+	// are prefixes, they form a pair: +x sets the bool option x to true
+	// and -x sets it to false (options of other types are not affected,
+	// and function options are not called when set to false).
+	OptionPrefixes []string
+
+	// ManFiles lists the files used by the application (e.g. the
+	// locations of its configuration files), shown in the FILES section
+	// of the man page (see WriteManPage).
+	ManFiles []string
+
+	// WarnOnEnvCliConflict adds a warning (see Warnings) for each option
+	// specified on the command line with a value which differs from the
+	// value of its environment variable (which is overridden by the
+	// command line), to help diagnose configuration mistakes.
+	WarnOnEnvCliConflict bool
+
+	// HelpStyle determines how the options are laid out in the help
+	// message. The default is HelpStyleFull.
+	HelpStyle HelpStyle
+
+	// GroupRequiredFirst lists the required options of the parser and of
+	// each active command in a separate Required block in the help
+	// message, before the other options.
+	GroupRequiredFirst bool
+
+	// HelpHeader is written before the usage in the help message (see
+	// WriteHelp), followed by an empty line.
+	HelpHeader string
+
+	// HelpFooter is written after all other content of the help message,
+	// preceded by an empty line.
+	HelpFooter string
+
+	// ExtraHelpFunc, when set, is called after the standard content of the
+	// help message has been written (and before HelpFooter) to write
+	// additional sections, such as examples, to the help message.
+	ExtraHelpFunc func(writer io.Writer)
+
+	// ArgsSeparator is the argument marking the end of the options, after
+	// which all arguments are passed verbatim (see PassDoubleDash and
+	// DoubleDashPerCommand). The default (empty) is "--". Only the first
+	// occurrence is a separator, any following argument equal to it is
+	// passed as is.
+	ArgsSeparator string
+
+	// DeferExecute disables executing the active command (see Commander)
+	// at the end of parsing. The application can then inspect the parsed
+	// options and decide whether to run the command using
+	// RunActiveCommand.
+	DeferExecute bool
+
+	// Context is the context passed to commands implementing
+	// CommanderContext when they are executed. When nil,
+	// context.Background() is used.
+	Context context.Context
+
+	internalError     error
+	hasBuiltinVersion bool
+	warnings          []string
+
+	// Set while parsing the command line in Load
+	loading   bool
+	ignoreEnv bool
+
+	// Set while parsing the command line in ParseUntilCommand
+	untilCommand   bool
+	unknownCommand []string
+}
+
+// SplitArgument represents an option as specified on the command line, split
+// into its name and its value (see Parser.UnknownOptionHandler).
+type SplitArgument interface {
+	// Name returns the option as specified, including its prefix and
+	// without its value (e.g. --name for --name=value).
+	Name() string
+
+	// Value returns the value specified together with the option (e.g.
+	// value for --name=value) and whether a value was specified.
+	Value() (string, bool)
 }
 
 // Options provides parser options that change the behavior of the option
@@ -39,12 +234,14 @@ const (
 	// -h and --help options. When either -h or --help is specified on the
 	// command line, the parser will return the special error of type
 	// ErrHelp. When PrintErrors is also specified, then the help message
-	// will also be automatically printed to os.Stderr.
+	// will also be automatically printed to os.Stderr. The names of the
+	// help option can be changed using Parser.HelpShort and
+	// Parser.HelpLong.
 	HelpFlag = 1 << iota
 
 	// PassDoubleDash passes all arguments after a double dash, --, as
 	// remaining command line arguments (i.e. they will not be parsed for
-	// flags).
+	// flags). The double dash can be changed using Parser.ArgsSeparator.
 	PassDoubleDash
 
 	// IgnoreUnknown ignores any unknown options and passes them as
@@ -57,9 +254,63 @@ const (
 
 	// PassAfterNonOption passes all arguments after the first non option
 	// as remaining command line arguments. This is equivalent to strict
-	// POSIX processing.
+	// POSIX processing. When positional arguments are declared, options
+	// can still be interspersed with them and arguments are only passed
+	// once all positional arguments have been filled.
 	PassAfterNonOption
 
+	// PositionalsFirst changes PassAfterNonOption such that arguments are
+	// also passed when a trailing slice positional argument is reached.
+	// Since a trailing slice positional argument is greedy, it then
+	// receives all remaining arguments, including the ones that look like
+	// options. Without PassAfterNonOption this option has no effect.
+	PositionalsFirst
+
+	// VersionFlag adds a --version option to the Help Options group of the
+	// parser. When --version is specified on the command line, the parser
+	// will return the special error of type ErrVersion, containing the
+	// value of Parser.Version. When PrintErrors is also specified, then
+	// the version will also be automatically printed to os.Stderr. If the
+	// application already defines a version long option, the built-in
+	// option is not added.
+	VersionFlag
+
+	// DoubleDashPerCommand scopes a double dash, --, to the command level
+	// at which it occurs. All arguments following it are treated as non
+	// options for the current (sub)command: they are assigned to its
+	// positional arguments or, once all positional arguments have been
+	// filled, passed as remaining command line arguments. If the current
+	// command has no positional arguments left and an argument names one
+	// of its subcommands, that subcommand is activated and option parsing
+	// resumes for it (such that it can have a double dash of its own).
+	// A trailing slice positional argument receives all arguments after the
+	// double dash verbatim, e.g. for exec pod -- cmd -la. This option takes
+	// precedence over PassDoubleDash.
+	DoubleDashPerCommand
+
+	// NoBundling disables bundling of short options. Instead of -abc being
+	// equivalent to -a -b -c, the characters following the first short
+	// option are always its argument, i.e. -abc is equivalent to -a bc
+	// (which results in an ErrNoArgumentForBool error if -a is a bool
+	// option). The -a=bc and -a bc forms are not affected.
+	NoBundling
+
+	// PrintUsageOnError prints the usage of the active command (i.e. the
+	// first lines of the help message) to os.Stderr after an error which
+	// occurred during parsing, when PrintErrors is also specified. The
+	// usage is not printed for the help and version messages.
+	PrintUsageOnError
+
+	// DisallowExtraArgs makes non option arguments which cannot be
+	// assigned to a positional argument of the active command (i.e. all
+	// positional arguments have been filled and there is no trailing slice
+	// positional argument) an error of type ErrExtraArgs, listing these
+	// arguments, instead of passing them as remaining command line
+	// arguments. Arguments which are passed deliberately (see
+	// PassDoubleDash, PassAfterNonOption, IgnoreUnknown and
+	// Command.Passthrough) are not affected.
+	DisallowExtraArgs
+
 	// Default is a convenient default set of options which should cover
 	// most of the uses of the flags package.
 	Default = HelpFlag | PrintErrors | PassDoubleDash
@@ -97,6 +348,7 @@ func NewParser(data interface{}, options Options) *Parser {
 
 		if err == nil {
 			g.parent = p
+			g.isDefault = true
 		}
 
 		p.internalError = err
@@ -110,20 +362,77 @@ func NewParser(data interface{}, options Options) *Parser {
 // be added to this parser by using AddGroup and AddCommand.
 func NewNamedParser(appname string, options Options) *Parser {
 	p := &Parser{
-		Command:            newCommand(appname, "", "", nil),
-		Options:            options,
-		NamespaceDelimiter: ".",
+		Command:               newCommand(appname, "", "", nil),
+		Options:               options,
+		NamespaceDelimiter:    ".",
+		EnvNamespaceDelimiter: "_",
+		SecretPrefix:          "secret://",
 	}
 
 	p.Command.parent = p
 
 	if len(os.Getenv("GO_FLAGS_COMPLETION")) != 0 {
-		p.AddCommand("__complete", "completion", "automatic flags completion", &completion{parser: p})
+		if c, err := p.AddCommand("__complete", "completion", "automatic flags completion", &completion{parser: p}); err == nil {
+			c.Hidden = true
+		}
 	}
 
 	return p
 }
 
+// RemoveGroup removes a group, and all its options and subgroups, from the
+// parser. The group can belong to the parser itself, to any of its commands
+// or to another group. The removed group is no longer parsed or shown in the
+// help. An error of type ErrUnknownGroup is returned if the group is not
+// part of the parser, and an error of type ErrRequired if any of its options
+// is required by a command (see Command.Require).
+func (p *Parser) RemoveGroup(group *Group) error {
+	var parent *Group
+
+	p.eachCommand(func(c *Command) {
+		c.eachGroup(func(g *Group) {
+			for _, gg := range g.groups {
+				if gg == group {
+					parent = g
+				}
+			}
+		})
+	}, true)
+
+	if parent == nil {
+		return newErrorf(ErrUnknownGroup, "group `%s' does not belong to the parser", group.ShortDescription)
+	}
+
+	var options []*Option
+
+	group.eachGroup(func(g *Group) {
+		options = append(options, g.options...)
+	})
+
+	if err := p.checkRequiredBy(options); err != nil {
+		return err
+	}
+
+	for i, gg := range parent.groups {
+		if gg == group {
+			parent.groups = append(parent.groups[:i], parent.groups[i+1:]...)
+			break
+		}
+	}
+
+	group.parent = nil
+
+	return nil
+}
+
+// SuggestCommands returns the names of the subcommands of the active command
+// which are similar to the given (unknown) command name, ordered by
+// similarity. It is intended to be used from an UnknownCommandHandler to
+// provide "did you mean" suggestions.
+func (p *Parser) SuggestCommands(name string) []string {
+	return p.activeCommand().suggestCommands(name)
+}
+
 // Parse parses the command line arguments from os.Args using Parser.ParseArgs.
 // For more detailed information see ParseArgs.
 func (p *Parser) Parse() ([]string, error) {
@@ -145,13 +454,42 @@ func (p *Parser) ParseArgs(args []string) ([]string, error) {
 		return nil, p.internalError
 	}
 
+	if err := p.resolveConflicts(); err != nil {
+		return nil, err
+	}
+
+	if p.ResponseFilePrefix != 0 {
+		expanded, err := p.expandResponseFiles(args, nil)
+
+		if err != nil {
+			return args, p.printError(err)
+		}
+
+		args = expanded
+	}
+
+	if p.ArgsPreprocessor != nil {
+		processed, err := p.ArgsPreprocessor(args)
+
+		if err != nil {
+			return args, p.printError(wrapError(err))
+		}
+
+		args = processed
+	}
+
 	p.clearIsSet()
+	p.warnings = nil
 
 	// Add built-in help group to all commands if necessary
 	if (p.Options & HelpFlag) != None {
 		p.addHelpGroups(p.showBuiltinHelp)
 	}
 
+	if (p.Options & VersionFlag) != None {
+		p.addVersionOption()
+	}
+
 	s := &parseState{
 		args:    args,
 		retargs: make([]string, 0, len(args)),
@@ -162,17 +500,39 @@ func (p *Parser) ParseArgs(args []string) ([]string, error) {
 	for !s.eof() {
 		arg := s.pop()
 
+		// When DoubleDashPerCommand is set, all arguments following a --
+		// are non options for the current command
+		if (p.Options & DoubleDashPerCommand) != None {
+			if arg == p.argsSeparator() && !s.doubleDash {
+				s.doubleDash = true
+				continue
+			}
+
+			if s.doubleDash {
+				if err := p.parseNonOption(s); err != nil {
+					s.err = wrapMarshalError(err, err.Error())
+					break
+				}
+
+				continue
+			}
+		}
+
 		// When PassDoubleDash is set and we encounter a --, then
 		// simply append all the rest as arguments and break out
-		if (p.Options&PassDoubleDash) != None && arg == "--" {
-			s.addArgs(s.args...)
+		if (p.Options&PassDoubleDash) != None && arg == p.argsSeparator() {
+			if err := s.addArgs(s.args...); err != nil {
+				s.err = wrapMarshalError(err, err.Error())
+			}
+
 			break
 		}
 
-		if !argumentIsOption(arg) {
-			// Note: this also sets s.err, so we can just check for
-			// nil here and use s.err later
-			if p.parseNonOption(s) != nil {
+		if !p.argumentIsOption(arg) {
+			// Errors converting positional arguments are reported as
+			// marshalling errors
+			if err := p.parseNonOption(s); err != nil {
+				s.err = wrapMarshalError(err, err.Error())
 				break
 			}
 
@@ -181,15 +541,35 @@ func (p *Parser) ParseArgs(args []string) ([]string, error) {
 
 		var err error
 
-		prefix, optname, islong := stripOptionPrefix(arg)
+		prefix, optname, islong := p.stripOptionPrefix(arg)
 		optname, _, argument := splitOption(prefix, optname, islong)
 
+		s.untoggle = p.isUntogglePrefix(prefix)
+
 		if islong {
 			err = p.parseLong(s, optname, argument)
 		} else {
 			err = p.parseShort(s, optname, argument)
 		}
 
+		if err != nil && p.UnknownOptionHandler != nil && wrapError(err).Type == ErrUnknownFlag {
+			if !islong {
+				optname, argument = s.unknownShort, s.unknownShortArgument
+			}
+
+			consumed, newArgs, herr := p.UnknownOptionHandler(optname, splitArgument{prefix + optname, argument}, s.args)
+
+			if herr != nil {
+				s.err = wrapError(herr)
+				break
+			}
+
+			if consumed {
+				s.args = newArgs
+				err = nil
+			}
+		}
+
 		if err != nil {
 			ignoreUnknown := (p.Options & IgnoreUnknown) != None
 			parseErr := wrapError(err)
@@ -203,6 +583,10 @@ func (p *Parser) ParseArgs(args []string) ([]string, error) {
 				s.addArgs(arg)
 			}
 		}
+
+		if s.shortCircuit != nil {
+			break
+		}
 	}
 
 	if s.err == nil {
@@ -210,25 +594,53 @@ func (p *Parser) ParseArgs(args []string) ([]string, error) {
 			c.eachGroup(func(g *Group) {
 				for _, option := range g.options {
 					if option.isSet {
+						if p.WarnOnEnvCliConflict && option.source == SourceCommandLine {
+							if key, ok := option.envConflict(); ok {
+								p.warn(fmt.Sprintf("flag `%s' specified on the command line overrides a different value of environment variable `%s'", option, key))
+							}
+						}
+
 						continue
 					}
 
-					option.clearDefault()
+					if err := option.clearDefault(); err != nil && s.err == nil {
+						s.err = err
+					}
 				}
 			})
 		}, true)
 
-		s.checkRequired(p)
+		if s.err == nil {
+			s.err = p.resolveDefaultTemplates()
+		}
+
+		if s.err == nil && s.shortCircuit == nil {
+			if s.checkConflicts(p) == nil {
+				s.checkRequired(p)
+			}
+		}
 	}
 
 	var reterr error
 
 	if s.err != nil {
 		reterr = p.printError(s.err)
-	} else if len(s.command.commands) != 0 && !s.command.SubcommandsOptional {
-		reterr = p.printError(s.estimateCommand())
-	} else if cmd, ok := s.command.data.(Commander); ok {
-		reterr = p.printError(cmd.Execute(s.retargs))
+	} else if s.shortCircuit != nil {
+		reterr = newErrorf(ErrShortCircuit, "flag `%s' was specified", s.shortCircuit)
+	} else if s.unknownCommand != nil {
+		// The unknown command is handled by the caller of
+		// ParseUntilCommand
+		p.unknownCommand = s.unknownCommand
+	} else if len(s.command.commands) != 0 && !s.command.SubcommandsOptional && !(s.command.Passthrough && len(s.retargs) != 0) {
+		if len(s.retargs) != 0 && p.UnknownCommandHandler != nil {
+			reterr = p.printError(p.UnknownCommandHandler(s.retargs[0], s.retargs[1:]))
+		} else {
+			reterr = p.printError(s.estimateCommand())
+		}
+	} else if (p.Options&DisallowExtraArgs) != None && len(s.extraArgs) != 0 {
+		reterr = p.printError(s.extraArgsError())
+	} else if s.command.isExecutable() && !p.DeferExecute {
+		reterr = p.printError(s.command.Execute(s.retargs))
 	}
 
 	if reterr != nil {
@@ -237,3 +649,208 @@ func (p *Parser) ParseArgs(args []string) ([]string, error) {
 
 	return s.retargs, nil
 }
+
+// Load resolves the options of the parser from all sources in one call, in
+// order of increasing precedence: default values, the given ini files (in
+// order, such that values in later files override values in earlier files),
+// the environment (when useEnv is set) and finally the command line
+// arguments. Unlike parsing the ini files and then calling ParseArgs, values
+// read from ini files are not replaced by default values, and values of
+// slice and map options specified on the command line replace, rather than
+// add to, the values read from ini files. Ini files which do not exist are
+// skipped. The remaining command line arguments are returned, as with
+// ParseArgs. Loading stops at the first error, which is either an error from
+// parsing an ini file (see IniParser.ParseFile) or from ParseArgs.
+func (p *Parser) Load(args []string, iniFiles []string, useEnv bool) ([]string, error) {
+	p.eachCommand(func(c *Command) {
+		c.eachGroup(func(g *Group) {
+			for _, option := range g.options {
+				option.source = SourceDefault
+			}
+		})
+	}, true)
+
+	inip := NewIniParser(p)
+
+	for _, filename := range iniFiles {
+		if _, err := os.Stat(filename); os.IsNotExist(err) {
+			continue
+		}
+
+		if err := inip.ParseFile(filename); err != nil {
+			return args, err
+		}
+	}
+
+	p.loading = true
+	p.ignoreEnv = !useEnv
+
+	defer func() {
+		p.loading = false
+		p.ignoreEnv = false
+	}()
+
+	return p.ParseArgs(args)
+}
+
+// SetDefaults sets all options of the parser and its commands to their
+// default values, without parsing any arguments. Like ParseArgs, values of
+// options with an env key are read from the environment instead, if set, and
+// default value templates are resolved. This is useful to inspect or display
+// the default configuration. Calling SetDefaults more than once has the same
+// effect as calling it once, and values set by SetDefaults are overridden by
+// a later parse.
+func (p *Parser) SetDefaults() error {
+	if p.internalError != nil {
+		return p.internalError
+	}
+
+	p.clearIsSet()
+	p.warnings = nil
+
+	var err error
+
+	p.eachCommand(func(c *Command) {
+		c.eachGroup(func(g *Group) {
+			for _, option := range g.options {
+				if e := option.clearDefault(); e != nil && err == nil {
+					err = e
+				}
+			}
+		})
+	}, true)
+
+	if err == nil {
+		err = p.resolveDefaultTemplates()
+	}
+
+	return err
+}
+
+// ParseUntilCommand parses the command line arguments like ParseArgs, but
+// stops at the first non option argument which is not a known command, as
+// long as the active command (or the parser itself) accepts commands and
+// has no positional arguments left to fill. This allows dispatching to
+// external commands, e.g. app --verbose plugin --flag x, where plugin is
+// not a command of the parser. The name of the unknown command and the
+// arguments following it are returned untouched, together with the
+// remaining arguments as returned by ParseArgs. Known commands are
+// selected as usual. When no unknown command is found, the returned command
+// name is empty and the result is the same as for ParseArgs. Note that when
+// parsing stops at an unknown command, no command is executed, even if the
+// active command implements Commander.
+func (p *Parser) ParseUntilCommand(args []string) (globalRemaining []string, commandName string, commandArgs []string, err error) {
+	p.untilCommand = true
+	p.unknownCommand = nil
+
+	defer func() {
+		p.untilCommand = false
+		p.unknownCommand = nil
+	}()
+
+	globalRemaining, err = p.ParseArgs(args)
+
+	if err == nil && p.unknownCommand != nil {
+		commandName = p.unknownCommand[0]
+		commandArgs = p.unknownCommand[1:]
+	}
+
+	return globalRemaining, commandName, commandArgs, err
+}
+
+// Warnings returns the warnings of the last parse, such as the use of
+// deprecated environment variables (see the env-alias tag). Warnings do not
+// cause parsing to fail. When PrintErrors is set, warnings are also printed
+// to os.Stderr.
+func (p *Parser) Warnings() []string {
+	return p.warnings
+}
+
+// RunActiveCommand executes the innermost active command (see
+// Command.Execute) with the given arguments, typically the remaining
+// arguments returned from ParseArgs. This is useful in combination with
+// DeferExecute, to parse the command line once, inspect the result and then
+// decide whether to run the command. Only the Execute method of the command
+// is called, there are no separate hooks which run before or after it.
+func (p *Parser) RunActiveCommand(args []string) error {
+	return p.activeCommand().Execute(args)
+}
+
+// ParseKnown parses only the options of the parser (not of its commands)
+// which it recognizes and returns all other arguments, untouched and in
+// order, as remaining arguments. Unlike ParseArgs, unknown options are not
+// an error, commands are not selected, required options and arguments are
+// not checked and default values are not applied. This is useful for
+// applications which split option parsing between multiple layers.
+//
+// Option arguments can be specified in the same ways as with ParseArgs
+// (e.g. --name=value, --name value or -nvalue). A bundle of short options
+// (e.g. -abc) is only parsed if all of its options are known, otherwise the
+// whole bundle is returned as remaining argument. Parsing stops at a double
+// dash, --, which is returned together with all following arguments.
+//
+// Besides setting the values of the parsed options, ParseKnown returns the
+// parsed values, keyed by the long name (including namespaces) of their
+// option, or by its short name if the option has no long name. Options
+// without an argument have the value "true" and for options specified
+// multiple times, the last value is returned.
+func (p *Parser) ParseKnown(args []string) (map[string]string, []string, error) {
+	if p.internalError != nil {
+		return nil, nil, p.internalError
+	}
+
+	if (p.Options & HelpFlag) != None {
+		p.addHelpGroups(p.showBuiltinHelp)
+	}
+
+	if (p.Options & VersionFlag) != None {
+		p.addVersionOption()
+	}
+
+	values := make(map[string]string)
+	remaining := make([]string, 0, len(args))
+
+	s := &parseState{
+		args: args,
+	}
+
+	p.fillParseState(s)
+
+	for !s.eof() {
+		arg := s.pop()
+
+		if arg == p.argsSeparator() {
+			remaining = append(append(remaining, arg), s.args...)
+			break
+		}
+
+		if !p.argumentIsOption(arg) {
+			remaining = append(remaining, arg)
+			continue
+		}
+
+		prefix, optname, islong := p.stripOptionPrefix(arg)
+		optname, _, argument := splitOption(prefix, optname, islong)
+
+		s.untoggle = p.isUntogglePrefix(prefix)
+
+		var err error
+		var known bool
+
+		if islong {
+			known, err = p.parseKnownLong(s, values, optname, argument)
+		} else {
+			known, err = p.parseKnownShort(s, values, optname, argument)
+		}
+
+		if err != nil {
+			return nil, nil, p.printError(err)
+		}
+
+		if !known {
+			remaining = append(remaining, arg)
+		}
+	}
+
+	return values, remaining, nil
+}
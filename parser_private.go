@@ -1,11 +1,16 @@
 package flags
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
 	"sort"
 	"strings"
+	"unicode"
 	"unicode/utf8"
 )
 
@@ -18,6 +23,31 @@ type parseState struct {
 
 	command *Command
 	lookup  lookup
+
+	// Whether a double dash was encountered for the current command (see
+	// DoubleDashPerCommand)
+	doubleDash bool
+
+	// The short-circuit option which stopped parsing, if any
+	shortCircuit *Option
+
+	// Whether the current option was specified with the prefix setting
+	// bool options to false (see Parser.OptionPrefixes)
+	untoggle bool
+
+	// The non option arguments which were not assigned to a positional
+	// argument (see DisallowExtraArgs)
+	extraArgs []string
+
+	// The unknown command at which parsing stopped, followed by its
+	// arguments (see Parser.ParseUntilCommand)
+	unknownCommand []string
+
+	// The unknown short option at which parsing of a bundle of short
+	// options stopped and its argument, being the rest of the bundle (see
+	// Parser.UnknownOptionHandler)
+	unknownShort         string
+	unknownShortArgument *string
 }
 
 func (p *parseState) eof() bool {
@@ -61,6 +91,12 @@ func (p *parseState) checkRequired(parser *Parser) error {
 	}
 
 	if len(required) == 0 {
+		for c = parser.Command; c != nil; c = c.Active {
+			if err := p.checkCommandRequired(c); err != nil {
+				return err
+			}
+		}
+
 		if len(p.positional) > 0 && p.command.ArgsRequired {
 			reqnames := make([]string, 0)
 
@@ -113,8 +149,67 @@ func (p *parseState) checkRequired(parser *Parser) error {
 	return p.err
 }
 
+// checkConflicts checks that no options of the active commands were
+// specified together with an option they conflict with (see the conflicts
+// tag).
+func (p *parseState) checkConflicts(parser *Parser) error {
+	for c := parser.Command; c != nil && p.err == nil; c = c.Active {
+		c.eachGroup(func(g *Group) {
+			for _, option := range g.options {
+				if p.err != nil || !option.isSpecified() {
+					continue
+				}
+
+				for _, other := range option.conflicts {
+					if other.isSpecified() {
+						p.err = newErrorf(ErrConflictingFlags, "flag `%s' cannot be specified together with flag `%s'", option, other)
+						break
+					}
+				}
+			}
+		})
+	}
+
+	return p.err
+}
+
+// checkCommandRequired checks the options which are required by the active
+// command c (see Command.Require).
+func (p *parseState) checkCommandRequired(c *Command) error {
+	names := make([]string, 0)
+
+	for _, option := range c.requires {
+		if !option.isSet {
+			names = append(names, "`"+option.String()+"'")
+		}
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	sort.Strings(names)
+
+	var msg string
+
+	if len(names) == 1 {
+		msg = fmt.Sprintf("the flag %s is required for the `%s' command", names[0], c.Name)
+	} else {
+		msg = fmt.Sprintf("the flags %s and %s are required for the `%s' command",
+			strings.Join(names[:len(names)-1], ", "), names[len(names)-1], c.Name)
+	}
+
+	p.err = newError(ErrRequired, msg)
+	return p.err
+}
+
 func (p *parseState) estimateCommand() error {
-	commands := p.command.sortedCommands()
+	commands := p.command.visibleCommands()
+
+	if len(commands) == 0 {
+		commands = p.command.sortedCommands()
+	}
+
 	cmdnames := make([]string, len(commands))
 
 	for i, v := range commands {
@@ -157,13 +252,43 @@ func (p *parseState) estimateCommand() error {
 }
 
 func (p *Parser) parseOption(s *parseState, name string, option *Option, canarg bool, argument *string) (err error) {
-	if !option.canArgument() {
+	if err := option.checkFeature(); err != nil {
+		return err
+	}
+
+	// Values specified on the command line replace the default values of
+	// slices and maps, as well as the values read from ini files when
+	// loading
+	if option.defaulted || (p.loading && !option.isSet && option.source == SourceIni) {
+		option.empty()
+		option.defaulted = false
+	}
+
+	option.source = SourceCommandLine
+
+	if option.consumesRest() {
+		return p.parseRestOption(s, option, argument)
+	}
+
+	if option.hasBoolValue() && (argument != nil || (canarg && !s.eof() && isBoolValue(s.peek()))) {
+		if argument == nil {
+			arg := s.pop()
+			argument = &arg
+		}
+
+		err = option.set(argument)
+	} else if !option.canArgument() {
 		if argument != nil {
 			msg := fmt.Sprintf("bool flag `%s' cannot have an argument", option)
 			return newError(ErrNoArgumentForBool, msg)
 		}
 
-		err = option.set(nil)
+		if !s.untoggle {
+			err = option.set(nil)
+		} else if !option.isFunc() {
+			v := "false"
+			err = option.set(&v)
+		}
 	} else if argument != nil {
 		err = option.set(argument)
 	} else if canarg && !s.eof() {
@@ -184,18 +309,146 @@ func (p *Parser) parseOption(s *parseState, name string, option *Option, canarg
 		err = newError(ErrExpectedArgument, msg)
 	}
 
+	// A slurping option also takes all following non option arguments,
+	// up to the next option
+	for err == nil && option.slurps() && canarg && !s.eof() && !p.argumentIsOption(s.peek()) && s.peek() != p.argsSeparator() {
+		arg := s.pop()
+		err = option.set(&arg)
+	}
+
 	if err != nil {
-		if _, ok := err.(*Error); !ok {
-			msg := fmt.Sprintf("invalid argument for flag `%s' (expected %s): %s",
-				option,
-				option.value.Type(),
-				err.Error())
+		err = p.wrapOptionError(option, err)
+	} else if option.isShortCircuit() {
+		s.shortCircuit = option
+	}
+
+	return err
+}
+
+func (p *Parser) wrapOptionError(option *Option, err error) error {
+	if _, ok := err.(*Error); ok {
+		return withErrorSource(err, "command line")
+	}
+
+	msg := fmt.Sprintf("invalid argument for flag `%s' (expected %s): %s",
+		option,
+		option.value.Type(),
+		err.Error())
+
+	return withErrorSource(wrapMarshalError(err, msg), "command line")
+}
+
+// parseRestOption sets all the remaining arguments, without parsing them, as
+// values of an option with the consumes-rest tag.
+func (p *Parser) parseRestOption(s *parseState, option *Option, argument *string) error {
+	if argument == nil && s.eof() {
+		msg := fmt.Sprintf("expected argument for flag `%s'", option)
+		return newError(ErrExpectedArgument, msg)
+	}
 
-			err = newError(ErrMarshal, msg)
+	if argument != nil {
+		if err := option.set(argument); err != nil {
+			return p.wrapOptionError(option, err)
 		}
 	}
 
-	return err
+	for !s.eof() {
+		arg := s.pop()
+
+		if err := option.set(&arg); err != nil {
+			return p.wrapOptionError(option, err)
+		}
+	}
+
+	return nil
+}
+
+// parseKnownOption parses an option for ParseKnown, storing its value in
+// values.
+func (p *Parser) parseKnownOption(s *parseState, values map[string]string, option *Option, canarg bool, argument *string) error {
+	value := "true"
+
+	if s.untoggle && !option.canArgument() {
+		value = "false"
+	}
+
+	if argument != nil {
+		value = *argument
+	} else if option.consumesRest() {
+		value = strings.Join(s.args, " ")
+	} else if option.hasBoolValue() && canarg && !s.eof() && isBoolValue(s.peek()) {
+		value = s.peek()
+	} else if option.canArgument() && canarg && !s.eof() {
+		value = s.peek()
+	} else if option.OptionalArgument && len(option.OptionalValue) != 0 {
+		value = option.OptionalValue[len(option.OptionalValue)-1]
+	}
+
+	if err := p.parseOption(s, "", option, canarg, argument); err != nil {
+		return err
+	}
+
+	name := option.LongNameWithNamespace()
+
+	if len(name) == 0 {
+		name = string(option.ShortName)
+	}
+
+	values[name] = value
+	return nil
+}
+
+func (p *Parser) parseKnownLong(s *parseState, values map[string]string, name string, argument *string) (bool, error) {
+	option := s.lookup.longNames[name]
+
+	if option == nil {
+		return false, nil
+	}
+
+	return true, p.parseKnownOption(s, values, option, !option.OptionalArgument, argument)
+}
+
+func (p *Parser) parseKnownShort(s *parseState, values map[string]string, optname string, argument *string) (bool, error) {
+	if argument == nil {
+		optname, argument = p.splitShortConcatArg(s, optname)
+	}
+
+	// Only parse a bundle of short options if all of them are known
+	for _, c := range optname {
+		if s.lookup.shortNames[string(c)] == nil {
+			return false, nil
+		}
+	}
+
+	for i, c := range optname {
+		option := s.lookup.shortNames[string(c)]
+		canarg := (i+utf8.RuneLen(c) == len(optname)) && !option.OptionalArgument
+
+		if err := p.parseKnownOption(s, values, option, canarg, argument); err != nil {
+			return true, err
+		}
+
+		argument = nil
+	}
+
+	return true, nil
+}
+
+type splitArgument struct {
+	name  string
+	value *string
+}
+
+func (a splitArgument) Name() string {
+	return a.name
+}
+
+func (a splitArgument) Value() (string, bool) {
+	if a.value == nil {
+		return "", false
+	}
+
+	return *a.value, true
 }
 
 func (p *Parser) parseLong(s *parseState, name string, argument *string) error {
@@ -219,6 +472,11 @@ func (p *Parser) splitShortConcatArg(s *parseState, optname string) (string, *st
 
 	first := string(c)
 
+	if (p.Options & NoBundling) != None {
+		arg := optname[n:]
+		return first, &arg
+	}
+
 	if option := s.lookup.shortNames[first]; option != nil && option.canArgument() {
 		arg := optname[n:]
 		return first, &arg
@@ -244,6 +502,13 @@ func (p *Parser) parseShort(s *parseState, optname string, argument *string) err
 				return err
 			}
 		} else {
+			if rest := optname[i+utf8.RuneLen(c):]; len(rest) != 0 {
+				argument = &rest
+			}
+
+			s.unknownShort = shortname
+			s.unknownShortArgument = argument
+
 			return newError(ErrUnknownFlag, fmt.Sprintf("unknown flag `%s'", shortname))
 		}
 
@@ -259,8 +524,14 @@ func (s *parseState) addArgs(args ...string) error {
 	for len(s.positional) > 0 && len(args) > 0 {
 		arg := s.positional[0]
 
-		if err := convert(args[0], arg.value, arg.tag); err != nil {
-			return err
+		value, err := normalizeValue(args[0], arg.value.Type(), arg.tag)
+
+		if err == nil {
+			err = convert(value, arg.value, arg.tag)
+		}
+
+		if err != nil {
+			return s.wrapArgError(arg, args[0], err)
 		}
 
 		if !arg.isRemaining() {
@@ -274,54 +545,402 @@ func (s *parseState) addArgs(args ...string) error {
 	return nil
 }
 
+// addPositional adds a non option argument, recording it as an extra
+// argument if there is no positional argument left to assign it to.
+func (s *parseState) addPositional(arg string) error {
+	if len(s.positional) == 0 {
+		s.extraArgs = append(s.extraArgs, arg)
+	}
+
+	return s.addArgs(arg)
+}
+
+// extraArgsError returns an error listing the extra arguments (see
+// DisallowExtraArgs).
+func (s *parseState) extraArgsError() error {
+	names := make([]string, len(s.extraArgs))
+
+	for i, arg := range s.extraArgs {
+		names[i] = "`" + arg + "'"
+	}
+
+	if len(names) == 1 {
+		return newErrorf(ErrExtraArgs, "unexpected argument %s", names[0])
+	}
+
+	return newErrorf(ErrExtraArgs, "unexpected arguments %s and %s",
+		strings.Join(names[:len(names)-1], ", "), names[len(names)-1])
+}
+
+// wrapArgError wraps an error converting the value of a positional argument,
+// identifying the positional argument by its name and position.
+func (s *parseState) wrapArgError(arg *Arg, value string, err error) error {
+	if _, ok := err.(*Error); ok {
+		return err
+	}
+
+	tp := arg.value.Type()
+
+	if arg.isRemaining() {
+		tp = tp.Elem()
+	}
+
+	// The pending positional arguments are always a suffix of the
+	// positional arguments of the active command
+	pos := len(s.command.args) - len(s.positional) + 1
+
+	msg := fmt.Sprintf("invalid value `%s' for positional argument `%s' at position %d (expected %s): %s",
+		value,
+		arg.Name,
+		pos,
+		tp,
+		err.Error())
+
+	return wrapMarshalError(err, msg)
+}
+
+func (s *parseState) addRemainingArgs() error {
+	if err := s.addArgs(s.arg); err != nil {
+		return err
+	}
+
+	if err := s.addArgs(s.args...); err != nil {
+		return err
+	}
+
+	s.args = []string{}
+	return nil
+}
+
 func (p *Parser) parseNonOption(s *parseState) error {
 	if len(s.positional) > 0 {
-		return s.addArgs(s.arg)
+		// With PassAfterNonOption and PositionalsFirst, all remaining
+		// arguments are passed once the trailing slice positional
+		// argument is reached
+		if (p.Options&(PassAfterNonOption|PositionalsFirst)) == PassAfterNonOption|PositionalsFirst &&
+			s.positional[0].isRemaining() {
+			return s.addRemainingArgs()
+		}
+
+		return s.addPositional(s.arg)
 	}
 
 	if cmd := s.lookup.commands[s.arg]; cmd != nil {
 		s.command.Active = cmd
+		s.doubleDash = false
 		cmd.fillParseState(s)
-	} else if (p.Options & PassAfterNonOption) != None {
-		// If PassAfterNonOption is set then all remaining arguments
-		// are considered positional
-		if err := s.addArgs(s.arg); err != nil {
-			return err
+	} else if p.untilCommand && (len(s.command.commands) != 0 || s.command == p.Command) {
+		s.unknownCommand = append([]string{s.arg}, s.args...)
+		s.args = nil
+	} else if s.command.Passthrough || (p.Options&PassAfterNonOption) != None {
+		// If PassAfterNonOption is set, or the command passes through
+		// unknown subcommands, then all remaining arguments are
+		// considered positional
+		return s.addRemainingArgs()
+	} else {
+		return s.addPositional(s.arg)
+	}
+
+	return nil
+}
+
+func (p *Parser) expandResponseFiles(args []string, stack []string) ([]string, error) {
+	prefix := p.ResponseFilePrefix
+	ret := make([]string, 0, len(args))
+
+	for _, arg := range args {
+		if len(arg) == 0 || arg[0] != prefix {
+			ret = append(ret, arg)
+			continue
 		}
 
-		if err := s.addArgs(s.args...); err != nil {
-			return err
+		// A double prefix escapes a literal argument starting with the
+		// prefix
+		if len(arg) > 1 && arg[1] == prefix {
+			ret = append(ret, arg[1:])
+			continue
 		}
 
-		s.args = []string{}
-	} else {
-		return s.addArgs(s.arg)
+		filename, err := filepath.Abs(arg[1:])
+
+		if err != nil {
+			return nil, newErrorf(ErrResponseFile, "cannot read response file `%s': %s", arg[1:], err)
+		}
+
+		for _, f := range stack {
+			if f == filename {
+				return nil, newErrorf(ErrResponseFile, "response file `%s' includes itself recursively", arg[1:])
+			}
+		}
+
+		data, err := ioutil.ReadFile(filename)
+
+		if err != nil {
+			return nil, newErrorf(ErrResponseFile, "cannot read response file `%s': %s", arg[1:], err)
+		}
+
+		nested, err := p.expandResponseFiles(splitResponseFile(string(data)), append(stack, filename))
+
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, nested...)
 	}
 
-	return nil
+	return ret, nil
+}
+
+func splitResponseFile(data string) []string {
+	var ret []string
+	var arg bytes.Buffer
+
+	var quote rune
+	inarg := false
+
+	for _, c := range data {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(c)
+			}
+		case c == '"' || c == '\'':
+			quote = c
+			inarg = true
+		case unicode.IsSpace(c):
+			if inarg {
+				ret = append(ret, arg.String())
+				arg.Reset()
+
+				inarg = false
+			}
+		default:
+			arg.WriteRune(c)
+			inarg = true
+		}
+	}
+
+	if inarg {
+		ret = append(ret, arg.String())
+	}
+
+	return ret
+}
+
+// hasOptions returns whether the parser has any options which can be
+// specified on the command line, including the built-in help and version
+// options.
+func (p *Parser) hasOptions() bool {
+	return (p.Options&(HelpFlag|VersionFlag)) != None || p.hasCliOptions()
 }
 
 func (p *Parser) showBuiltinHelp() error {
 	var b bytes.Buffer
 
-	p.WriteHelp(&b)
+	// The help is printed to os.Stderr when PrintErrors is set
+	p.writeHelp(&b, false, p.helpWidth(os.Stderr))
 	return newError(ErrHelp, b.String())
 }
 
+func (p *Parser) showBuiltinVersion() error {
+	return newError(ErrVersion, p.Version)
+}
+
+func (p *Parser) addVersionOption() {
+	if p.hasBuiltinVersion {
+		return
+	}
+
+	p.hasBuiltinVersion = true
+
+	var grp *Group
+	userVersion := false
+
+	p.Command.eachGroup(func(g *Group) {
+		if g.isBuiltinHelp {
+			grp = g
+		}
+
+		for _, option := range g.options {
+			if option.LongNameWithNamespace() == "version" {
+				userVersion = true
+			}
+		}
+	})
+
+	// Defer to the version option of the application, if any
+	if userVersion {
+		return
+	}
+
+	if grp == nil {
+		grp, _ = p.AddGroup("Help Options", "", &struct{}{})
+		grp.isBuiltinHelp = true
+	}
+
+	version := &struct {
+		ShowVersion func() error `long:"version" description:"Show the version information"`
+	}{
+		ShowVersion: p.showBuiltinVersion,
+	}
+
+	grp.scanStruct(reflect.ValueOf(version).Elem(), nil, grp.scanSubGroupHandler)
+}
+
 func (p *Parser) printError(err error) error {
+	if e, ok := err.(*Error); ok && e.Type == ErrShortCircuit {
+		return err
+	}
+
 	if err != nil && (p.Options&PrintErrors) != None {
 		fmt.Fprintln(os.Stderr, err)
+
+		e, ok := err.(*Error)
+
+		if (p.Options&PrintUsageOnError) != None && len(p.helpName()) != 0 && !(ok && (e.Type == ErrHelp || e.Type == ErrVersion)) {
+			wr := bufio.NewWriter(os.Stderr)
+
+			fmt.Fprintln(wr)
+			p.writeUsage(wr)
+
+			wr.Flush()
+		}
 	}
 
 	return err
 }
 
+// warn adds a warning to the warnings of the current parse (see
+// Parser.Warnings), printing it to os.Stderr when PrintErrors is set.
+func (p *Parser) warn(message string) {
+	p.warnings = append(p.warnings, message)
+
+	if (p.Options & PrintErrors) != None {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", message)
+	}
+}
+
+// resolveDefaultTemplates sets the options with a default value template
+// (see the default tag) which were not otherwise set to the result of their
+// templates, once all other options have their values.
+func (p *Parser) resolveDefaultTemplates() error {
+	var err error
+
+	p.eachCommand(func(c *Command) {
+		c.eachGroup(func(g *Group) {
+			for _, option := range g.options {
+				if err == nil {
+					err = option.resolveDefaultTemplate(nil)
+				}
+			}
+		})
+	}, true)
+
+	return err
+}
+
+// resolveConflicts resolves the names of the conflicts tags of all options
+// to the conflicting options.
+func (p *Parser) resolveConflicts() error {
+	var err error
+
+	p.eachCommand(func(c *Command) {
+		c.eachGroup(func(g *Group) {
+			for _, option := range g.options {
+				option.conflicts = nil
+
+				tag := option.tag.Get("conflicts")
+
+				if len(tag) == 0 {
+					continue
+				}
+
+				for _, name := range strings.Split(tag, ",") {
+					name = strings.TrimSpace(name)
+					other := c.findLongOption(name)
+
+					if other == nil {
+						if err == nil {
+							err = newErrorf(ErrTag, "option `%s' conflicts with unknown option `%s'", option, name)
+						}
+
+						continue
+					}
+
+					option.conflicts = append(option.conflicts, other)
+				}
+			}
+		})
+	}, true)
+
+	return err
+}
+
 func (p *Parser) clearIsSet() {
 	p.eachCommand(func(c *Command) {
 		c.eachGroup(func(g *Group) {
 			for _, option := range g.options {
 				option.isSet = false
+				option.pendingDefault = false
 			}
 		})
 	}, true)
 }
+
+func (p *Parser) argumentIsOption(arg string) bool {
+	if p.OptionPrefixes == nil {
+		return argumentIsOption(arg)
+	}
+
+	for _, prefix := range p.OptionPrefixes {
+		// A prefix on its own (e.g. - for stdin) is not an option
+		if len(prefix) != 0 && len(arg) > len(prefix) && strings.HasPrefix(arg, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// stripOptionPrefix strips the longest of the configured option prefixes
+// (see OptionPrefixes) from the option.
+func (p *Parser) stripOptionPrefix(optname string) (prefix string, name string, islong bool) {
+	if p.OptionPrefixes == nil {
+		return stripOptionPrefix(optname)
+	}
+
+	for _, pr := range p.OptionPrefixes {
+		if len(pr) > len(prefix) && strings.HasPrefix(optname, pr) {
+			prefix = pr
+		}
+	}
+
+	return prefix, optname[len(prefix):], len(prefix) > 1
+}
+
+// isUntogglePrefix returns whether options specified with the given prefix
+// set bool options to false, which is the case for - when + is also an
+// option prefix.
+func (p *Parser) isUntogglePrefix(prefix string) bool {
+	if prefix != "-" {
+		return false
+	}
+
+	for _, pr := range p.OptionPrefixes {
+		if pr == "+" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Parser) argsSeparator() string {
+	if len(p.ArgsSeparator) == 0 {
+		return "--"
+	}
+
+	return p.ArgsSeparator
+}
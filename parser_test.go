@@ -1,7 +1,15 @@
 package flags
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
 )
@@ -96,3 +104,898 @@ func TestDefaults(t *testing.T) {
 		}
 	}
 }
+
+type EnvSnapshot struct {
+	env map[string]string
+}
+
+func NewEnvSnapshot() *EnvSnapshot {
+	ret := &EnvSnapshot{
+		env: make(map[string]string),
+	}
+
+	for _, v := range os.Environ() {
+		parts := strings.SplitN(v, "=", 2)
+
+		if len(parts) == 2 {
+			ret.env[parts[0]] = parts[1]
+		}
+	}
+
+	return ret
+}
+
+func (e *EnvSnapshot) Restore() {
+	os.Clearenv()
+
+	for k, v := range e.env {
+		os.Setenv(k, v)
+	}
+}
+
+func TestEnvDefaults(t *testing.T) {
+	var tests = []struct {
+		msg      string
+		args     []string
+		env      map[string]string
+		expected envDefaultOptions
+	}{
+		{
+			msg:  "no arguments, no env, expecting default values",
+			args: []string{},
+			expected: envDefaultOptions{
+				Int:   1,
+				Slice: []int{1, 2},
+				Map:   map[string]int{"a": 1},
+			},
+		},
+		{
+			msg:  "no arguments, env defaults, expecting env default values",
+			args: []string{},
+			env: map[string]string{
+				"TEST_I":     "2",
+				"TEST_S":     "3,4",
+				"TEST_M":     "b:2;c:3",
+				"APP_TEST_N": "4",
+			},
+			expected: envDefaultOptions{
+				Int:   2,
+				Slice: []int{3, 4},
+				Map:   map[string]int{"b": 2, "c": 3},
+				Group: envDefaultGroup{
+					Nested: 4,
+				},
+			},
+		},
+		{
+			msg:  "non-zero value arguments, expecting overwritten arguments",
+			args: []string{"--i=3", "--s=5", "--m=d:4", "--n=6"},
+			env: map[string]string{
+				"TEST_I":     "2",
+				"TEST_S":     "3,4",
+				"TEST_M":     "b:2;c:3",
+				"APP_TEST_N": "4",
+			},
+			expected: envDefaultOptions{
+				Int:   3,
+				Slice: []int{5},
+				Map:   map[string]int{"d": 4},
+				Group: envDefaultGroup{
+					Nested: 6,
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		var opts envDefaultOptions
+
+		oldEnv := NewEnvSnapshot()
+
+		for envKey, envValue := range test.env {
+			os.Setenv(envKey, envValue)
+		}
+
+		_, err := ParseArgs(&opts, test.args)
+
+		oldEnv.Restore()
+
+		if err != nil {
+			t.Fatalf("%s:\nUnexpected error: %v", test.msg, err)
+		}
+
+		if opts.Map == nil {
+			opts.Map = map[string]int{}
+		}
+
+		if !reflect.DeepEqual(opts, test.expected) {
+			t.Errorf("%s:\nUnexpected options with arguments %+v\nexpected\n%+v\nbut got\n%+v\n", test.msg, test.args, test.expected, opts)
+		}
+	}
+}
+
+type envDefaultGroup struct {
+	Nested int `long:"n" env:"TEST_N"`
+}
+
+type envDefaultOptions struct {
+	Int   int            `long:"i" default:"1" env:"TEST_I"`
+	Slice []int          `long:"s" default:"1" default:"2" env:"TEST_S" env-delim:","`
+	Map   map[string]int `long:"m" default:"a:1" env:"TEST_M" env-delim:";"`
+
+	Group envDefaultGroup `group:"Group" env-namespace:"APP"`
+}
+
+func TestEnvDefaultsInvalid(t *testing.T) {
+	var opts struct {
+		Int int `long:"i" env:"TEST_I"`
+	}
+
+	oldEnv := NewEnvSnapshot()
+	defer oldEnv.Restore()
+
+	os.Setenv("TEST_I", "nan")
+
+	assertParseFail(t, ErrMarshal, "invalid value `nan' for environment variable `TEST_I' of flag `--i' (expected int): strconv.ParseInt: parsing \"nan\": invalid syntax", &opts)
+}
+
+func TestEnvDefaultsBool(t *testing.T) {
+	var tests = []struct {
+		value    string
+		expected bool
+	}{
+		{"1", true},
+		{"0", false},
+		{"true", true},
+		{"False", false},
+		{"yes", true},
+		{"no", false},
+		{"ON", true},
+		{"off", false},
+	}
+
+	oldEnv := NewEnvSnapshot()
+	defer oldEnv.Restore()
+
+	for _, test := range tests {
+		var opts struct {
+			Feature bool `long:"feature" default:"true" env:"TEST_FEATURE"`
+		}
+
+		os.Setenv("TEST_FEATURE", test.value)
+		assertParseSuccess(t, &opts)
+
+		if opts.Feature != test.expected {
+			t.Errorf("Expected Feature to be %v for %q, but got %v", test.expected, test.value, opts.Feature)
+		}
+	}
+
+	var opts struct {
+		Feature bool `long:"feature" env:"TEST_FEATURE"`
+	}
+
+	os.Setenv("TEST_FEATURE", "enabled")
+	assertParseFail(t, ErrMarshal, "invalid value `enabled' for environment variable `TEST_FEATURE' of flag `--feature' (expected one of 1, 0, true, false, yes, no, on or off)", &opts)
+}
+
+func TestEnvDefaultsJSON(t *testing.T) {
+	oldEnv := NewEnvSnapshot()
+	defer oldEnv.Restore()
+
+	var opts struct {
+		Tags   []string          `long:"tag" env:"TEST_TAGS" env-format:"json" default:"x"`
+		Ports  []int             `long:"port" env:"TEST_PORTS" env-format:"json"`
+		Labels map[string]string `long:"label" env:"TEST_LABELS" env-format:"json"`
+	}
+
+	os.Setenv("TEST_TAGS", `["a,b", "c d"]`)
+	os.Setenv("TEST_PORTS", `[80, 443]`)
+	os.Setenv("TEST_LABELS", `{"env": "prod", "url": "http://x:1"}`)
+
+	assertParseSuccess(t, &opts)
+	assertStringArray(t, opts.Tags, []string{"a,b", "c d"})
+
+	if !reflect.DeepEqual(opts.Ports, []int{80, 443}) {
+		t.Errorf("Expected ports [80 443] but got %v", opts.Ports)
+	}
+
+	if !reflect.DeepEqual(opts.Labels, map[string]string{"env": "prod", "url": "http://x:1"}) {
+		t.Errorf("Unexpected labels %v", opts.Labels)
+	}
+
+	os.Setenv("TEST_TAGS", `[]`)
+	assertParseSuccess(t, &opts)
+	assertStringArray(t, opts.Tags, []string{})
+
+	os.Setenv("TEST_TAGS", `["a",`)
+	assertParseFail(t, ErrMarshal, "invalid value for environment variable `TEST_TAGS' of flag `--tag': unexpected end of JSON input", &opts)
+
+	var invalid struct {
+		Tag string `long:"tag" env:"TEST_TAGS" env-format:"json"`
+	}
+
+	assertParseFail(t, ErrTag, "option `--tag' has an env-format but is not a slice or map", &invalid)
+}
+
+func TestEnvAlias(t *testing.T) {
+	oldEnv := NewEnvSnapshot()
+	defer oldEnv.Restore()
+
+	var opts struct {
+		Timeout int `long:"timeout" env:"APP_TIMEOUT" env-alias:"OLD_TIMEOUT" env-alias:"TIMEOUT" default:"10"`
+	}
+
+	os.Setenv("TIMEOUT", "20")
+
+	p, _ := assertParserSuccess(t, &opts)
+
+	if opts.Timeout != 20 {
+		t.Errorf("Expected timeout 20 but got %d", opts.Timeout)
+	}
+
+	assertStringArray(t, p.Warnings(), []string{"environment variable `TIMEOUT' is deprecated, use `APP_TIMEOUT' instead"})
+
+	os.Setenv("APP_TIMEOUT", "30")
+
+	if _, err := p.ParseArgs(nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if opts.Timeout != 30 {
+		t.Errorf("Expected timeout 30 but got %d", opts.Timeout)
+	}
+
+	assertStringArray(t, p.Warnings(), nil)
+
+	os.Unsetenv("APP_TIMEOUT")
+	os.Setenv("OLD_TIMEOUT", "x")
+
+	_, err := p.ParseArgs(nil)
+	assertError(t, err, ErrMarshal, "invalid value `x' for environment variable `OLD_TIMEOUT' of flag `--timeout' (expected int): strconv.ParseInt: parsing \"x\": invalid syntax")
+
+	var invalid struct {
+		Timeout int `long:"timeout" env-alias:"OLD_TIMEOUT"`
+	}
+
+	assertParseFail(t, ErrTag, "option `--timeout' has an env-alias but no env", &invalid)
+}
+
+func TestWarnOnEnvCliConflict(t *testing.T) {
+	oldEnv := NewEnvSnapshot()
+	defer oldEnv.Restore()
+
+	var opts struct {
+		Level   int      `long:"level" env:"TEST_LEVEL"`
+		Verbose bool     `long:"verbose" env:"TEST_VERBOSE"`
+		Tags    []string `long:"tag" env:"TEST_TAGS" env-delim:","`
+		Name    string   `long:"name" env:"TEST_NAME"`
+		Delays  []int    `long:"delay" env:"TEST_DELAYS" sep:"," unit:"ms,s=1000"`
+	}
+
+	os.Setenv("TEST_LEVEL", "3")
+	os.Setenv("TEST_VERBOSE", "yes")
+	os.Setenv("TEST_TAGS", "a,b")
+	os.Setenv("TEST_DELAYS", "500ms,1s")
+
+	p := NewParser(&opts, None)
+	p.WarnOnEnvCliConflict = true
+
+	if _, err := p.ParseArgs([]string{"--level", "03", "--verbose", "--tag", "a", "--tag", "b", "--name", "x", "--delay", "500ms,1000ms"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertStringArray(t, p.Warnings(), nil)
+
+	if _, err := p.ParseArgs([]string{"--level", "5", "--tag", "a", "--delay", "1s"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertStringArray(t, p.Warnings(), []string{
+		"flag `--level' specified on the command line overrides a different value of environment variable `TEST_LEVEL'",
+		"flag `--tag' specified on the command line overrides a different value of environment variable `TEST_TAGS'",
+		"flag `--delay' specified on the command line overrides a different value of environment variable `TEST_DELAYS'",
+	})
+
+	p.WarnOnEnvCliConflict = false
+
+	if _, err := p.ParseArgs([]string{"--level", "5"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertStringArray(t, p.Warnings(), nil)
+}
+
+func TestWarnOnEnvCliConflictNoSideEffects(t *testing.T) {
+	oldEnv := NewEnvSnapshot()
+	defer oldEnv.Restore()
+
+	var opts struct {
+		Level int    `long:"level" env:"TEST_LEVEL" env-alias:"TEST_OLD_LEVEL"`
+		Token string `long:"token" env:"TEST_TOKEN" secret:"yes"`
+	}
+
+	os.Unsetenv("TEST_LEVEL")
+	os.Setenv("TEST_OLD_LEVEL", "3")
+	os.Setenv("TEST_TOKEN", "secret://env")
+
+	resolved := 0
+
+	p := NewParser(&opts, None)
+	p.WarnOnEnvCliConflict = true
+	p.SecretResolver = func(uri string) (string, error) {
+		resolved++
+		return "resolved", nil
+	}
+
+	if _, err := p.ParseArgs([]string{"--level", "5", "--token", "secret://cli"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if resolved != 1 {
+		t.Errorf("Expected the secret to be resolved once, but it was resolved %d times", resolved)
+	}
+
+	assertStringArray(t, p.Warnings(), []string{
+		"flag `--level' specified on the command line overrides a different value of environment variable `TEST_OLD_LEVEL'",
+	})
+}
+
+func TestDefaultFunc(t *testing.T) {
+	var opts struct {
+		Dir   string `long:"dir" env:"TEST_DIR" description:"The directory"`
+		Level string `long:"level" default:"info"`
+	}
+
+	p := NewNamedParser("TestDefaultFunc", None)
+	g, err := p.AddGroup("Application Options", "The application options", &opts)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	dir := "/initial"
+
+	if err := g.SetDefaultFunc("Dir", func() string { return dir }); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := g.SetDefaultFunc("Level", func() string { return "debug" }); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertError(t, g.SetDefaultFunc("Missing", func() string { return "" }), ErrUnknownFlag, "unknown option field `Missing'")
+
+	dir = "/computed"
+
+	if _, err := p.ParseArgs([]string{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertString(t, opts.Dir, "/computed")
+	assertString(t, opts.Level, "info")
+
+	oldEnv := NewEnvSnapshot()
+	os.Setenv("TEST_DIR", "/env")
+
+	_, err = p.ParseArgs([]string{})
+	oldEnv.Restore()
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertString(t, opts.Dir, "/env")
+
+	if _, err := p.ParseArgs([]string{"--dir", "/cli"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertString(t, opts.Dir, "/cli")
+
+	var buf bytes.Buffer
+	p.WriteHelp(&buf)
+
+	if !strings.Contains(buf.String(), "The directory (/computed) [$TEST_DIR]") {
+		t.Errorf("Expected computed default in help, but got:\n%s", buf.String())
+	}
+}
+
+func TestResponseFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-flags-response")
+
+	if err != nil {
+		t.Fatalf("Cannot create temporary directory: %s", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	outer := filepath.Join(dir, "outer.txt")
+	inner := filepath.Join(dir, "inner.txt")
+
+	ioutil.WriteFile(outer, []byte("-v\n--name 'some name'\n@"+inner+"\n"), 0644)
+	ioutil.WriteFile(inner, []byte("--value=\"a b\" @@literal rest\n"), 0644)
+
+	var opts struct {
+		Verbose bool     `short:"v"`
+		Name    string   `long:"name"`
+		Value   []string `long:"value"`
+	}
+
+	p := NewParser(&opts, None)
+	p.ResponseFilePrefix = '@'
+
+	ret, err := p.ParseArgs([]string{"@" + outer, "--value", "c", "@@arg"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !opts.Verbose {
+		t.Errorf("Expected Verbose to be true")
+	}
+
+	assertString(t, opts.Name, "some name")
+	assertStringArray(t, opts.Value, []string{"a b", "c"})
+	assertStringArray(t, ret, []string{"@literal", "rest", "@arg"})
+}
+
+func TestResponseFileErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-flags-response")
+
+	if err != nil {
+		t.Fatalf("Cannot create temporary directory: %s", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	first := filepath.Join(dir, "first.txt")
+	second := filepath.Join(dir, "second.txt")
+
+	ioutil.WriteFile(first, []byte("@"+second), 0644)
+	ioutil.WriteFile(second, []byte("-v @"+first), 0644)
+
+	var opts struct {
+		Verbose bool `short:"v"`
+	}
+
+	p := NewParser(&opts, None)
+	p.ResponseFilePrefix = '@'
+
+	_, err = p.ParseArgs([]string{"@" + first})
+	assertError(t, err, ErrResponseFile, "response file `"+first+"' includes itself recursively")
+
+	_, err = p.ParseArgs([]string{"@" + filepath.Join(dir, "missing.txt")})
+
+	if e, ok := err.(*Error); !ok || e.Type != ErrResponseFile {
+		t.Errorf("Expected ErrResponseFile error, but got %v", err)
+	}
+
+	p.ResponseFilePrefix = 0
+
+	ret, err := p.ParseArgs([]string{"@" + first})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertStringArray(t, ret, []string{"@" + first})
+}
+
+func TestParseKnown(t *testing.T) {
+	var opts struct {
+		Verbose []bool `short:"v" long:"verbose"`
+		Name    string `short:"n" long:"name"`
+		Quiet   bool   `short:"q"`
+		Level   int    `long:"level"`
+
+		Command struct {
+			Other bool `long:"other"`
+		} `command:"cmd"`
+	}
+
+	p := NewNamedParser("TestParseKnown", None)
+	p.AddGroup("Application Options", "", &opts)
+
+	values, remaining, err := p.ParseKnown([]string{
+		"-vq", "--unknown", "x", "--name=test", "-vx", "cmd", "--other",
+		"--level", "3", "-nshort", "--", "--name", "after",
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	assertStringArray(t, remaining, []string{"--unknown", "x", "-vx", "cmd", "--other", "--", "--name", "after"})
+
+	expected := map[string]string{
+		"verbose": "true",
+		"q":       "true",
+		"name":    "short",
+		"level":   "3",
+	}
+
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected values %v but got %v", expected, values)
+	}
+
+	assertString(t, opts.Name, "short")
+	assertBoolArray(t, opts.Verbose, []bool{true})
+
+	if !opts.Quiet || opts.Level != 3 || opts.Command.Other {
+		t.Errorf("Unexpected option values %+v", opts)
+	}
+
+	_, _, err = p.ParseKnown([]string{"--level", "x"})
+	assertError(t, err, ErrMarshal, fmt.Sprintf("invalid argument for flag `%slevel' (expected int): strconv.ParseInt: parsing \"x\": invalid syntax", defaultLongOptDelimiter))
+
+	_, _, err = p.ParseKnown([]string{"--name"})
+	assertError(t, err, ErrExpectedArgument, fmt.Sprintf("expected argument for flag `%cn, %sname'", defaultShortOptDelimiter, defaultLongOptDelimiter))
+}
+
+func TestOptionPrefixes(t *testing.T) {
+	var opts struct {
+		Verbose bool   `short:"v" long:"verbose"`
+		Color   bool   `short:"c"`
+		Bell    bool   `short:"b"`
+		Name    string `short:"n" long:"name"`
+	}
+
+	opts.Color = true
+
+	p := NewParser(&opts, None)
+	p.OptionPrefixes = []string{"++", "+", "-"}
+
+	ret, err := p.ParseArgs([]string{"+vb", "-c", "-n", "x", "++name=y", "arg"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertStringArray(t, ret, []string{"arg"})
+	assertBoolArray(t, []bool{opts.Verbose, opts.Color, opts.Bell}, []bool{true, false, true})
+	assertString(t, opts.Name, "y")
+
+	if _, err := p.ParseArgs([]string{"-vb"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertBoolArray(t, []bool{opts.Verbose, opts.Bell}, []bool{false, false})
+
+	// Without the + prefix, - does not set bool options to false
+	p.OptionPrefixes = []string{"/", "-"}
+
+	if _, err := p.ParseArgs([]string{"/v", "-c"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertBoolArray(t, []bool{opts.Verbose, opts.Color}, []bool{true, true})
+
+	// A prefix on its own is not an option
+	ret, err = p.ParseArgs([]string{"-n", "-", "/", "-"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertString(t, opts.Name, "-")
+	assertStringArray(t, ret, []string{"/", "-"})
+}
+
+func TestErrorSource(t *testing.T) {
+	oldEnv := NewEnvSnapshot()
+	defer oldEnv.Restore()
+
+	var opts struct {
+		Timeout int `long:"timeout" env:"TEST_TIMEOUT"`
+	}
+
+	p := NewParser(&opts, None)
+
+	_, err := p.ParseArgs([]string{"--timeout", "x"})
+	assertError(t, err, ErrMarshal, fmt.Sprintf("invalid argument for flag `%stimeout' (expected int): strconv.ParseInt: parsing \"x\": invalid syntax", defaultLongOptDelimiter))
+	assertString(t, err.(*Error).Source, "command line")
+
+	os.Setenv("TEST_TIMEOUT", "y")
+
+	_, err = p.ParseArgs([]string{})
+	assertError(t, err, ErrMarshal, fmt.Sprintf("invalid value `y' for environment variable `TEST_TIMEOUT' of flag `%stimeout' (expected int): strconv.ParseInt: parsing \"y\": invalid syntax", defaultLongOptDelimiter))
+	assertString(t, err.(*Error).Source, "environment variable TEST_TIMEOUT")
+
+	file, err := ioutil.TempFile("", "")
+
+	if err != nil {
+		t.Fatalf("Cannot create temporary file: %s", err)
+	}
+
+	defer os.Remove(file.Name())
+
+	file.WriteString("; comment\ntimeout = z\n")
+	file.Close()
+
+	err = NewIniParser(p).ParseFile(file.Name())
+	assertError(t, err, ErrMarshal, fmt.Sprintf("invalid value `z' for ini option `timeout' of flag `%stimeout' in file %s line 2 (expected int): strconv.ParseInt: parsing \"z\": invalid syntax", defaultLongOptDelimiter, file.Name()))
+	assertString(t, err.(*Error).Source, fmt.Sprintf("file %s line 2", file.Name()))
+}
+
+func TestPrintUsageOnError(t *testing.T) {
+	var opts struct {
+		Verbose bool `short:"v"`
+
+		Add struct {
+			Force bool `short:"f"`
+		} `command:"add"`
+	}
+
+	stderr := os.Stderr
+	defer func() { os.Stderr = stderr }()
+
+	r, w, err := os.Pipe()
+
+	if err != nil {
+		t.Fatalf("Cannot create pipe: %s", err)
+	}
+
+	os.Stderr = w
+
+	p := NewNamedParser("TestPrintUsageOnError", HelpFlag|PrintErrors|PrintUsageOnError)
+	p.AddGroup("Application Options", "", &opts)
+
+	_, err = p.ParseArgs([]string{"add", "-x"})
+	assertError(t, err, ErrUnknownFlag, "unknown flag `x'")
+
+	_, err = p.ParseArgs([]string{"--help"})
+
+	var help string
+
+	if runtime.GOOS == "windows" {
+		help = `Usage:
+  TestPrintUsageOnError [OPTIONS] <add>
+
+Application Options:
+  /v
+
+Help Options:
+  /h, /help   Show this help message
+
+Available commands:
+  add
+`
+	} else {
+		help = `Usage:
+  TestPrintUsageOnError [OPTIONS] <add>
+
+Application Options:
+  -v
+
+Help Options:
+  -h, --help  Show this help message
+
+Available commands:
+  add
+`
+	}
+
+	assertError(t, err, ErrHelp, help)
+
+	w.Close()
+
+	output, _ := ioutil.ReadAll(r)
+	expected := "unknown flag `x'\n\nUsage:\n  TestPrintUsageOnError [OPTIONS] add [add-OPTIONS]\n"
+
+	if !strings.HasPrefix(string(output), expected) {
+		t.Errorf("Expected output to start with %q but got %q", expected, output)
+	}
+
+	if strings.Count(string(output), "Usage:") != 2 {
+		t.Errorf("Expected the usage only after the error and in the help but got %q", output)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	oldEnv := NewEnvSnapshot()
+	defer oldEnv.Restore()
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Cannot create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	system := filepath.Join(dir, "system.ini")
+	user := filepath.Join(dir, "user.ini")
+
+	if err := ioutil.WriteFile(system, []byte("Name = system\nLevel = 1\nColor = blue\nTags = a\n"), 0644); err != nil {
+		t.Fatalf("Cannot write file: %s", err)
+	}
+
+	if err := ioutil.WriteFile(user, []byte("Level = 2\nMode = fast\n"), 0644); err != nil {
+		t.Fatalf("Cannot write file: %s", err)
+	}
+
+	type loadOptions struct {
+		Name  string   `long:"name" default:"none"`
+		Level int      `long:"level" default:"0" env:"TEST_LOAD_LEVEL"`
+		Color string   `long:"color" default:"red"`
+		Mode  string   `long:"mode" default:"slow" env:"TEST_LOAD_MODE"`
+		Tags  []string `long:"tag" default:"x"`
+		Size  int      `long:"size" default:"10"`
+	}
+
+	os.Setenv("TEST_LOAD_LEVEL", "3")
+	os.Setenv("TEST_LOAD_MODE", "normal")
+
+	var opts loadOptions
+	p := NewParser(&opts, None)
+
+	ret, err := p.Load([]string{"--color", "green", "--tag", "b", "arg"}, []string{system, filepath.Join(dir, "missing.ini"), user}, true)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	assertStringArray(t, ret, []string{"arg"})
+
+	expected := loadOptions{
+		Name:  "system",
+		Level: 3,
+		Color: "green",
+		Mode:  "normal",
+		Tags:  []string{"b"},
+		Size:  10,
+	}
+
+	if !reflect.DeepEqual(opts, expected) {
+		t.Errorf("Expected %+v but got %+v", expected, opts)
+	}
+
+	options := p.Groups()[0].Options()
+
+	for i, source := range []ValueSource{SourceIni, SourceEnv, SourceCommandLine, SourceEnv, SourceCommandLine, SourceDefault} {
+		if s := options[i].Source(); s != source {
+			t.Errorf("Expected source of %s to be %s but got %s", options[i], source, s)
+		}
+	}
+
+	opts = loadOptions{}
+	p = NewParser(&opts, None)
+
+	if _, err := p.Load(nil, []string{system, user}, false); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected = loadOptions{
+		Name:  "system",
+		Level: 2,
+		Color: "blue",
+		Mode:  "fast",
+		Tags:  []string{"a"},
+		Size:  10,
+	}
+
+	if !reflect.DeepEqual(opts, expected) {
+		t.Errorf("Expected %+v but got %+v", expected, opts)
+	}
+
+	if err := ioutil.WriteFile(user, []byte("Level = high\n"), 0644); err != nil {
+		t.Fatalf("Cannot write file: %s", err)
+	}
+
+	opts = loadOptions{}
+	p = NewParser(&opts, None)
+
+	if _, err := p.Load(nil, []string{system, user}, true); err == nil {
+		t.Fatalf("Expected error for invalid ini value")
+	}
+}
+
+func TestArgsPreprocessor(t *testing.T) {
+	var opts struct {
+		Name    string `long:"new-name"`
+		Verbose []bool `short:"v"`
+	}
+
+	p := NewParser(&opts, None)
+
+	p.ArgsPreprocessor = func(args []string) ([]string, error) {
+		var ret []string
+
+		for _, arg := range args {
+			switch {
+			case arg == "--old-name":
+				ret = append(ret, "--new-name")
+			case arg == "--debug":
+				ret = append(ret, "-vvv")
+			case arg == "--fail":
+				return nil, errors.New("legacy option --fail is no longer supported")
+			default:
+				ret = append(ret, arg)
+			}
+		}
+
+		return ret, nil
+	}
+
+	ret, err := p.ParseArgs([]string{"--old-name", "x", "--debug", "arg"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	assertStringArray(t, ret, []string{"arg"})
+	assertString(t, opts.Name, "x")
+	assertBoolArray(t, opts.Verbose, []bool{true, true, true})
+
+	_, err = p.ParseArgs([]string{"--fail"})
+	assertError(t, err, ErrUnknown, "legacy option --fail is no longer supported")
+}
+
+func TestSetDefaults(t *testing.T) {
+	oldEnv := NewEnvSnapshot()
+	defer oldEnv.Restore()
+
+	var opts struct {
+		Level  int               `long:"level" default:"2"`
+		Tags   []string          `long:"tag" default:"a" default:"b"`
+		Labels map[string]int    `long:"label" default:"x:1" default:"y:2"`
+		Hosts  []string          `long:"host" env:"TEST_HOSTS" env-delim:","`
+		Name   string            `long:"name" default:"app" env:"TEST_NAME"`
+		Path   string            `long:"path" default:"/var/{{.Name}}"`
+		Extra  map[string]string `long:"extra"`
+
+		Run struct {
+			Retries int `long:"retries" default:"3"`
+		} `command:"run"`
+	}
+
+	os.Setenv("TEST_HOSTS", "h1,h2")
+	os.Setenv("TEST_NAME", "web")
+
+	p := NewParser(&opts, None)
+
+	for i := 0; i < 2; i++ {
+		if err := p.SetDefaults(); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		if opts.Level != 2 || opts.Run.Retries != 3 {
+			t.Errorf("Expected defaults 2 and 3 but got %d and %d", opts.Level, opts.Run.Retries)
+		}
+
+		assertStringArray(t, opts.Tags, []string{"a", "b"})
+		assertStringArray(t, opts.Hosts, []string{"h1", "h2"})
+		assertString(t, opts.Name, "web")
+		assertString(t, opts.Path, "/var/web")
+
+		if !reflect.DeepEqual(opts.Labels, map[string]int{"x": 1, "y": 2}) {
+			t.Errorf("Unexpected values %v", opts.Labels)
+		}
+
+		if opts.Extra == nil || len(opts.Extra) != 0 {
+			t.Errorf("Expected an empty map but got %v", opts.Extra)
+		}
+	}
+
+	if _, err := p.ParseArgs([]string{"--level", "5", "--tag", "c", "run"}); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if opts.Level != 5 {
+		t.Errorf("Expected level 5 but got %d", opts.Level)
+	}
+
+	assertStringArray(t, opts.Tags, []string{"c"})
+
+	os.Setenv("TEST_HOSTS", "")
+	os.Setenv("TEST_NAME", "")
+
+	if err := p.SetDefaults(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	assertStringArray(t, opts.Tags, []string{"a", "b"})
+	assertString(t, opts.Name, "app")
+
+	if opts.Level != 2 {
+		t.Errorf("Expected level 2 but got %d", opts.Level)
+	}
+}
@@ -0,0 +1,239 @@
+package flags
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// escapeReST escapes the characters which have a meaning in inline markup.
+// Underscores are only escaped at the end of a word, where they would make
+// the word a reference.
+func escapeReST(s string) string {
+	escape := strings.NewReplacer("\\", "\\\\", "*", "\\*", "|", "\\|", "`", "\\`")
+	s = escape.Replace(s)
+
+	var ret bytes.Buffer
+
+	for i, c := range s {
+		if c == '_' {
+			next, _ := utf8.DecodeRuneInString(s[i+1:])
+
+			if i+1 == len(s) || !(unicode.IsLetter(next) || unicode.IsDigit(next)) {
+				ret.WriteRune('\\')
+			}
+		}
+
+		ret.WriteRune(c)
+	}
+
+	return ret.String()
+}
+
+// formatForReST converts a description to reStructuredText. Text quoted as
+// `text' is written as an inline literal and characters which have a
+// meaning in inline markup are escaped.
+func formatForReST(s string) string {
+	var ret bytes.Buffer
+
+	for {
+		idx := strings.IndexRune(s, '`')
+
+		if idx < 0 {
+			ret.WriteString(escapeReST(s))
+			break
+		}
+
+		end := strings.IndexRune(s[idx+1:], '\'')
+
+		if end <= 0 {
+			ret.WriteString(escapeReST(s))
+			break
+		}
+
+		ret.WriteString(escapeReST(s[:idx]))
+		ret.WriteString("``" + s[idx+1:idx+1+end] + "``")
+
+		s = s[idx+end+2:]
+	}
+
+	return ret.String()
+}
+
+// writeReSTHeading writes a section title, underlined with the given
+// character.
+func writeReSTHeading(wr io.Writer, title string, underline rune) {
+	fmt.Fprintf(wr, "%s\n%s\n\n", title, strings.Repeat(string(underline), utf8.RuneCountInString(title)))
+}
+
+// writeReSTParagraph writes a description as a paragraph, indented by the
+// given prefix.
+func writeReSTParagraph(wr io.Writer, indent string, s string) {
+	for _, line := range strings.Split(formatForReST(s), "\n") {
+		if len(strings.TrimSpace(line)) == 0 {
+			fmt.Fprintln(wr, "")
+		} else {
+			fmt.Fprintf(wr, "%s%s\n", indent, line)
+		}
+	}
+
+	fmt.Fprintln(wr, "")
+}
+
+// restOptionName returns the names of an option as used in the option
+// directive (e.g. -o <file>, --output=<file>).
+func restOptionName(opt *Option) string {
+	var names []string
+
+	var arg string
+
+	if len(opt.ValueName) != 0 && !opt.isBool() {
+		arg = "<" + opt.ValueName + ">"
+	}
+
+	if opt.ShortName != 0 {
+		name := "-" + string(opt.ShortName)
+
+		if len(arg) != 0 {
+			name += " " + arg
+		}
+
+		names = append(names, name)
+	}
+
+	if len(opt.LongName) != 0 {
+		name := "--" + opt.LongNameWithNamespace()
+
+		if len(arg) != 0 {
+			name += "=" + arg
+		}
+
+		names = append(names, name)
+	}
+
+	return strings.Join(names, ", ")
+}
+
+func writeReSTOptions(wr io.Writer, grp *Group) {
+	grp.eachGroup(func(group *Group) {
+		// The long description of the group of a command is the long
+		// description of the command itself
+		describe := group != grp && len(group.LongDescription) != 0
+
+		for _, opt := range group.options {
+			if !opt.isVisible() {
+				continue
+			}
+
+			if describe {
+				writeReSTParagraph(wr, "", group.LongDescription)
+				describe = false
+			}
+
+			fmt.Fprintf(wr, ".. option:: %s\n\n", restOptionName(opt))
+
+			if desc := opt.description(); len(desc) != 0 {
+				writeReSTParagraph(wr, "   ", desc)
+			}
+		}
+	})
+}
+
+func writeReSTArgs(wr io.Writer, args []*Arg) {
+	for _, arg := range args {
+		fmt.Fprintf(wr, ".. describe:: %s\n\n", arg.usageName())
+
+		if len(arg.Description) != 0 {
+			writeReSTParagraph(wr, "   ", arg.Description)
+		}
+	}
+}
+
+func writeReSTSubcommands(wr io.Writer, program string, name string, root *Command) {
+	for _, c := range root.visibleCommands() {
+		var nn string
+
+		if len(name) != 0 {
+			nn = name + " " + c.Name
+		} else {
+			nn = c.Name
+		}
+
+		writeReSTCommand(wr, program, nn, c)
+	}
+}
+
+func writeReSTCommand(wr io.Writer, program string, name string, command *Command) {
+	writeReSTHeading(wr, name, '~')
+
+	fmt.Fprintf(wr, ".. program:: %s %s\n\n", program, name)
+
+	if len(command.ShortDescription) != 0 {
+		writeReSTParagraph(wr, "", command.ShortDescription)
+	}
+
+	if len(command.LongDescription) != 0 {
+		writeReSTParagraph(wr, "", command.LongDescription)
+	}
+
+	if len(command.Aliases) > 0 {
+		fmt.Fprintf(wr, "**Aliases**: %s\n\n", strings.Join(command.Aliases, ", "))
+	}
+
+	writeReSTOptions(wr, command.Group)
+	writeReSTArgs(wr, command.args)
+	writeReSTSubcommands(wr, program, name, command)
+}
+
+// WriteReST writes documentation of the parser in reStructuredText format
+// to the specified writer, e.g. to include a reference of the command line
+// interface in Sphinx documentation. Like the man page, it documents the
+// options, arguments and commands of the parser. Options are written using
+// the option directive, preceded by a program directive for the parser and
+// each command, such that they can be referenced using the option role.
+func (p *Parser) WriteReST(wr io.Writer) {
+	writeReSTHeading(wr, p.Name, '=')
+
+	fmt.Fprintf(wr, ".. program:: %s\n\n", p.Name)
+
+	if len(p.ShortDescription) != 0 {
+		writeReSTParagraph(wr, "", p.ShortDescription)
+	}
+
+	writeReSTHeading(wr, "Synopsis", '-')
+
+	usage := p.Usage
+
+	if len(usage) == 0 && p.hasOptions() {
+		usage = "[OPTIONS]"
+	}
+
+	if len(usage) != 0 {
+		fmt.Fprintf(wr, "::\n\n   %s %s\n\n", p.Name, usage)
+	} else {
+		fmt.Fprintf(wr, "::\n\n   %s\n\n", p.Name)
+	}
+
+	if len(p.LongDescription) != 0 {
+		writeReSTHeading(wr, "Description", '-')
+		writeReSTParagraph(wr, "", p.LongDescription)
+	}
+
+	if p.hasOptions() {
+		writeReSTHeading(wr, "Options", '-')
+		writeReSTOptions(wr, p.Command.Group)
+	}
+
+	if len(p.args) > 0 {
+		writeReSTHeading(wr, "Arguments", '-')
+		writeReSTArgs(wr, p.args)
+	}
+
+	if len(p.visibleCommands()) > 0 {
+		writeReSTHeading(wr, "Commands", '-')
+		writeReSTSubcommands(wr, p.Name, "", p.Command)
+	}
+}
@@ -27,6 +27,42 @@ func TestShortTooLong(t *testing.T) {
 	assertParseFail(t, ErrShortNameTooLong, "short names can only be 1 character long, not `vv'", &opts)
 }
 
+func TestShortInvalid(t *testing.T) {
+	var opts = struct {
+		Value bool `short:"-"`
+	}{}
+
+	assertParseFail(t, ErrTag, "invalid short name `-'", &opts)
+
+	var opts2 = struct {
+		Value bool `short:" "`
+	}{}
+
+	assertParseFail(t, ErrTag, "invalid short name ` '", &opts2)
+}
+
+func TestShortDigitAndNonASCII(t *testing.T) {
+	var opts = struct {
+		One   bool   `short:"1"`
+		Value string `short:"é"`
+	}{}
+
+	ret := assertParseSuccess(t, &opts, "-1", "-é=abc")
+
+	assertStringArray(t, ret, []string{})
+
+	if !opts.One {
+		t.Errorf("Expected One to be true")
+	}
+
+	assertString(t, opts.Value, "abc")
+
+	ret = assertParseSuccess(t, &opts, "-éxyz")
+
+	assertStringArray(t, ret, []string{})
+	assertString(t, opts.Value, "xyz")
+}
+
 func TestShortRequired(t *testing.T) {
 	var opts = struct {
 		Value bool `short:"v" required:"true"`
@@ -192,3 +228,37 @@ func TestShortOptional(t *testing.T) {
 	assertStringArray(t, ret, []string{"f"})
 	assertString(t, opts.Value, "value")
 }
+
+func TestShortNoBundling(t *testing.T) {
+	var opts = struct {
+		F     []bool `short:"f"`
+		Level int    `short:"1"`
+		Value string `short:"v"`
+	}{}
+
+	p := NewParser(&opts, None|NoBundling)
+	ret, err := p.ParseArgs([]string{"-f", "-vff", "-123", "rest"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertStringArray(t, ret, []string{"rest"})
+	assertBoolArray(t, opts.F, []bool{true})
+	assertString(t, opts.Value, "ff")
+
+	if opts.Level != 23 {
+		t.Errorf("Expected Level to be 23 but got %d", opts.Level)
+	}
+
+	for _, args := range [][]string{{"-v=value"}, {"-v", "value"}} {
+		if _, err := p.ParseArgs(args); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		assertString(t, opts.Value, "value")
+	}
+
+	_, err = p.ParseArgs([]string{"-fv"})
+	assertError(t, err, ErrNoArgumentForBool, fmt.Sprintf("bool flag `%cf' cannot have an argument", defaultShortOptDelimiter))
+}
@@ -0,0 +1,19 @@
+package flags
+
+// StringList is an option value type collecting strings, like a []string,
+// for options which usually take a single value but accept a list as well.
+// Like other slice options, every occurrence of the option (on the command
+// line, in the environment or in an ini file) adds a value, and the sep tag
+// can be used to accept a list in a single value (e.g. --name a,b). Values
+// are written to ini files one per line.
+type StringList []string
+
+// One returns the value of the list if it contains exactly one value, and
+// whether this is the case.
+func (l StringList) One() (string, bool) {
+	if len(l) != 1 {
+		return "", false
+	}
+
+	return l[0], true
+}
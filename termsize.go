@@ -12,17 +12,19 @@ type winsize struct {
 	xpixel, ypixel uint16
 }
 
-func getTerminalColumns() int {
+// getTerminalColumns returns the number of columns of the terminal with the
+// given file descriptor, or 0 if it is not a terminal.
+func getTerminalColumns(fd uintptr) int {
 	ws := winsize{}
 
 	if tIOCGWINSZ != 0 {
 		syscall.Syscall(syscall.SYS_IOCTL,
-			uintptr(0),
+			fd,
 			uintptr(tIOCGWINSZ),
 			uintptr(unsafe.Pointer(&ws)))
 
 		return int(ws.col)
 	}
 
-	return 80
+	return 0
 }
@@ -0,0 +1,166 @@
+package flags
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// valueUnit is a unit suffix of an option with the unit tag, together with
+// the factor by which values specified in the unit are multiplied.
+type valueUnit struct {
+	suffix string
+	factor uint64
+}
+
+// parseUnits parses the value of a unit tag (e.g. ms or ms,s=1000). A unit
+// without a factor is the base unit (factor 1), which must be present.
+func parseUnits(tag string) ([]valueUnit, bool) {
+	var ret []valueUnit
+	hasBase := false
+
+	for _, item := range strings.Split(tag, ",") {
+		parts := strings.SplitN(item, "=", 2)
+		unit := valueUnit{suffix: strings.TrimSpace(parts[0]), factor: 1}
+
+		if len(parts) == 2 {
+			factor, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 64)
+
+			if err != nil || factor == 0 {
+				return nil, false
+			}
+
+			unit.factor = factor
+		}
+
+		if len(unit.suffix) == 0 {
+			return nil, false
+		}
+
+		if unit.factor == 1 {
+			hasBase = true
+		}
+
+		ret = append(ret, unit)
+	}
+
+	return ret, hasBase
+}
+
+// baseUnit returns the suffix of the base unit of the unit tag.
+func baseUnit(tag string) string {
+	units, _ := parseUnits(tag)
+
+	for _, unit := range units {
+		if unit.factor == 1 {
+			return unit.suffix
+		}
+	}
+
+	return ""
+}
+
+// unitKind returns the kind of the values of the option (i.e. the kind of
+// the elements of slices and maps).
+func (option *Option) unitKind() reflect.Kind {
+	tp := option.value.Type()
+
+	for tp.Kind() == reflect.Ptr || tp.Kind() == reflect.Slice || tp.Kind() == reflect.Map {
+		tp = tp.Elem()
+	}
+
+	return tp.Kind()
+}
+
+// stripUnit converts a value of an option with the unit tag to a plain
+// number in the base unit of the option. The longest unit suffix matching
+// the value is used.
+func (option *Option) stripUnit(value string) (string, error) {
+	units, _ := parseUnits(option.tag.Get("unit"))
+
+	var unit *valueUnit
+
+	for i, u := range units {
+		if strings.HasSuffix(value, u.suffix) && (unit == nil || len(u.suffix) > len(unit.suffix)) {
+			unit = &units[i]
+		}
+	}
+
+	if unit == nil || len(value) == len(unit.suffix) {
+		suffixes := make([]string, len(units))
+
+		for i, u := range units {
+			suffixes[i] = u.suffix
+		}
+
+		var expected string
+
+		if len(suffixes) == 1 {
+			expected = suffixes[0]
+		} else {
+			expected = strings.Join(suffixes[:len(suffixes)-1], ", ") + " or " + suffixes[len(suffixes)-1]
+		}
+
+		return "", newErrorf(ErrMarshal, "invalid value `%s' for flag `%s' (expected a number followed by a unit, one of %s, e.g. 10%s)",
+			value, option, expected, units[0].suffix)
+	}
+
+	number := strings.TrimSpace(value[:len(value)-len(unit.suffix)])
+
+	if unit.factor == 1 {
+		return number, nil
+	}
+
+	overflow := newErrorf(ErrRange, "value `%s' for flag `%s' is out of range", value, option)
+
+	// Integers are parsed like by convert and formatted in the same base,
+	// such that convert reads back the scaled number
+	base, err := getBase(option.tag, 0)
+
+	if err != nil {
+		return "", err
+	}
+
+	formatBase := base
+
+	if formatBase == 0 {
+		formatBase = 10
+	}
+
+	switch option.unitKind() {
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(number, 64)
+
+		if err != nil {
+			return "", err
+		}
+
+		return strconv.FormatFloat(f*float64(unit.factor), 'g', -1, 64), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(number, base, 64)
+
+		if err != nil {
+			return "", err
+		}
+
+		if n != 0 && n*unit.factor/unit.factor != n {
+			return "", overflow
+		}
+
+		return strconv.FormatUint(n*unit.factor, formatBase), nil
+	default:
+		n, err := strconv.ParseInt(number, base, 64)
+
+		if err != nil {
+			return "", err
+		}
+
+		f := int64(unit.factor)
+
+		if f < 0 || (n != 0 && n*f/f != n) {
+			return "", overflow
+		}
+
+		return strconv.FormatInt(n*f, formatBase), nil
+	}
+}
@@ -1,6 +1,8 @@
 package flags
 
 import (
+	"errors"
+	"strings"
 	"testing"
 )
 
@@ -64,3 +66,83 @@ func TestIgnoreUnknownFlags(t *testing.T) {
 		t.Fatalf("Expected %v but got %v", exargs, args)
 	}
 }
+
+func TestUnknownOptionHandler(t *testing.T) {
+	var opts = struct {
+		Verbose bool   `short:"v" long:"verbose"`
+		Output  string `long:"output"`
+	}{}
+
+	var passed []string
+
+	p := NewParser(&opts, IgnoreUnknown)
+	p.UnknownOptionHandler = func(name string, arg SplitArgument, args []string) (bool, []string, error) {
+		switch {
+		case strings.HasPrefix(name, "X-"):
+			value, ok := arg.Value()
+
+			if !ok && len(args) > 0 {
+				value, args = args[0], args[1:]
+			}
+
+			passed = append(passed, arg.Name()+"="+value)
+			return true, args, nil
+		case name == "out":
+			return true, append([]string{"--output"}, args...), nil
+		case name == "fail":
+			return false, nil, errors.New("failed")
+		}
+
+		return false, args, nil
+	}
+
+	ret, err := p.ParseArgs([]string{"--X-a=1", "-v", "--X-b", "2", "--out", "file", "--other", "arg"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertStringArray(t, passed, []string{"--X-a=1", "--X-b=2"})
+	assertStringArray(t, ret, []string{"--other", "arg"})
+	assertString(t, opts.Output, "file")
+
+	if !opts.Verbose {
+		t.Errorf("Expected Verbose to be true")
+	}
+
+	_, err = p.ParseArgs([]string{"--fail"})
+	assertError(t, err, ErrUnknown, "failed")
+}
+
+func TestUnknownOptionHandlerShort(t *testing.T) {
+	var opts = struct {
+		Verbose bool `short:"v"`
+	}{}
+
+	var passed []string
+
+	p := NewParser(&opts, None)
+	p.UnknownOptionHandler = func(name string, arg SplitArgument, args []string) (bool, []string, error) {
+		value, ok := arg.Value()
+
+		if ok {
+			passed = append(passed, name+" "+arg.Name()+" "+value)
+		} else {
+			passed = append(passed, name+" "+arg.Name())
+		}
+
+		return true, args, nil
+	}
+
+	_, err := p.ParseArgs([]string{"-vxyz", "-vw", "-u"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertStringArray(t, passed, []string{"x -x yz", "w -w", "u -u"})
+
+	if !opts.Verbose {
+		t.Errorf("Expected Verbose to be true")
+	}
+}